@@ -0,0 +1,65 @@
+package main
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"local/mda/internal/events"
+
+	"github.com/google/uuid"
+)
+
+// runChirpScheduler publishes scheduled chirps once their publish_at has
+// passed. The UPDATE ... RETURNING claims each chirp exactly once, so several
+// instances can run the scheduler side by side.
+func (cfg *apiConfig) runChirpScheduler(ctx context.Context, every time.Duration) {
+	ticker := time.NewTicker(every)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := cfg.publishDueChirps(ctx); err != nil {
+				log.Printf("publishing scheduled chirps: %s", err)
+			}
+		}
+	}
+}
+
+// publishDueChirps publishes the due chirps and records their chirp.created
+// events in one transaction.
+func (cfg *apiConfig) publishDueChirps(ctx context.Context) error {
+	tx, err := cfg.sqlDB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	qtx := cfg.db.WithTx(tx)
+
+	rows, err := qtx.PublishDueChirps(ctx, time.Now().UTC())
+	if err != nil {
+		return err
+	}
+	if len(rows) == 0 {
+		return nil
+	}
+	chirps, err := cfg.chirpResponsesWith(ctx, qtx, uuid.Nil, rows)
+	if err != nil {
+		return err
+	}
+	for _, c := range chirps {
+		if err := cfg.recordEvent(ctx, qtx, events.ChirpCreated, c.UserId, c); err != nil {
+			return err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	for _, c := range chirps {
+		log.Printf("Published scheduled chirp %s", c.Id)
+	}
+	cfg.eventDispatcher.Kick()
+	return nil
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"context"
+	"log"
+
+	"local/mda/internal/database"
+	"local/mda/internal/events"
+
+	"github.com/google/uuid"
+)
+
+type chirpDeletedPayload struct {
+	Id     uuid.UUID `json:"id"`
+	UserId uuid.UUID `json:"user_id"`
+}
+
+// userEventPayload describes a change to an account. Changed lists the
+// fields that were updated, never their values.
+type userEventPayload struct {
+	UserId  uuid.UUID `json:"user_id"`
+	Changed []string  `json:"changed,omitempty"`
+}
+
+// recordEvent writes an event about userID to the domain_events outbox
+// through q, which should be the transaction making the change. Call
+// cfg.eventDispatcher.Kick after committing to deliver it promptly.
+func (cfg *apiConfig) recordEvent(ctx context.Context, q *database.Queries, eventType string, userID uuid.UUID, payload any) error {
+	e, err := events.New(eventType, userID, payload)
+	if err != nil {
+		return err
+	}
+	return events.Record(ctx, q, e)
+}
+
+// logEvent is an events.Handler that logs events as they are dispatched.
+func logEvent(ctx context.Context, e events.Event) error {
+	if e.Origin != "" {
+		return nil
+	}
+	log.Printf("Dispatched %s event %s for user %s", e.Type, e.ID, e.UserID)
+	return nil
+}
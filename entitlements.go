@@ -0,0 +1,87 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+	"unicode/utf8"
+
+	"local/mda/internal/chirps"
+	"local/mda/internal/database"
+	"local/mda/internal/entitlements"
+
+	"github.com/google/uuid"
+)
+
+// userPlan returns the plan userID is entitled to right now. It goes by the
+// subscription rather than users.is_chirpy_red, so a lapsed subscription
+// stops counting before the expiry job has caught up with it.
+func (cfg *apiConfig) userPlan(ctx context.Context, q *database.Queries, userID uuid.UUID) (entitlements.Plan, error) {
+	sub, err := q.GetSubscription(ctx, userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return entitlements.For(entitlements.PlanFree), nil
+	}
+	if err != nil {
+		return entitlements.Plan{}, err
+	}
+	return entitlements.ForSubscription(subscriptionState(sub), time.Now().UTC()), nil
+}
+
+// checkSchedule applies the plan's scheduling rules to publishAt. A nil or
+// past publishAt means now and is always allowed. Violations are *apiError.
+func checkSchedule(plan entitlements.Plan, publishAt *time.Time) error {
+	if publishAt == nil {
+		return nil
+	}
+	ahead := time.Until(*publishAt)
+	switch {
+	case ahead <= 0:
+	case !plan.Can(entitlements.ScheduleChirps):
+		return &apiError{Status: http.StatusForbidden, Message: "scheduling chirps isn't included in your plan"}
+	case plan.Limits.MaxScheduleAhead > 0 && ahead > plan.Limits.MaxScheduleAhead:
+		return &apiError{Status: http.StatusBadRequest, Message: chirps.ErrScheduleTooFar.Error()}
+	}
+	return nil
+}
+
+// checkChirpAllowance applies the plan's chirp limits to a new chirp. q
+// must be bound to the transaction that inserts it. Violations are
+// *apiError.
+func checkChirpAllowance(ctx context.Context, q *database.Queries, userID uuid.UUID, plan entitlements.Plan, body string, publishAt *time.Time) error {
+	limits := plan.Limits
+	if limits.MaxChirpLength > 0 && utf8.RuneCountInString(body) > limits.MaxChirpLength {
+		return &apiError{
+			Status:  http.StatusBadRequest,
+			Message: fmt.Sprintf("chirp is too long, the limit is %d characters", limits.MaxChirpLength),
+		}
+	}
+
+	if err := checkSchedule(plan, publishAt); err != nil {
+		return err
+	}
+
+	if limits.ChirpsPerDay > 0 {
+		// q is the new chirp's transaction; holding the author's quota lock
+		// until it commits stops concurrent posts all passing the count
+		if err := q.LockChirpQuota(ctx, userID); err != nil {
+			return &apiError{Status: http.StatusInternalServerError, Message: "couldn't check chirp quota", Err: err}
+		}
+		n, err := q.CountChirpsByAuthorSince(ctx, database.CountChirpsByAuthorSinceParams{
+			UserID:    userID,
+			CreatedAt: time.Now().UTC().Add(-24 * time.Hour),
+		})
+		if err != nil {
+			return &apiError{Status: http.StatusInternalServerError, Message: "couldn't check chirp quota", Err: err}
+		}
+		if n >= int64(limits.ChirpsPerDay) {
+			return &apiError{
+				Status:  http.StatusTooManyRequests,
+				Message: fmt.Sprintf("daily limit of %d chirps reached", limits.ChirpsPerDay),
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,247 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"local/mda/internal/accounts"
+	"local/mda/internal/events"
+
+	"github.com/google/uuid"
+)
+
+// handlerDeleteAccount schedules the caller's account for deletion. The
+// account disappears from the API right away and is purged once the grace
+// period has passed; logging in before then cancels the deletion.
+func (cfg *apiConfig) handlerDeleteAccount(w http.ResponseWriter, r *http.Request) {
+	userID, ok := cfg.authenticate(w, r)
+	if !ok {
+		return
+	}
+
+	ctx := r.Context()
+	tx, err := cfg.sqlDB.BeginTx(ctx, nil)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "couldn't start transaction", err)
+		return
+	}
+	defer tx.Rollback()
+	qtx := cfg.db.WithTx(tx)
+
+	user, err := accounts.Delete(ctx, qtx, userID, time.Now().UTC())
+	if errors.Is(err, accounts.ErrAlreadyDeleted) {
+		respondWithError(w, http.StatusConflict, err.Error(), nil)
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "couldn't delete account", err)
+		return
+	}
+
+	if err := cfg.recordEvent(ctx, qtx, events.UserDeleted, userID, userEventPayload{UserId: userID}); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "couldn't record event", err)
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "couldn't delete account", err)
+		return
+	}
+	cfg.eventDispatcher.Kick()
+
+	type deleteAccountResponse struct {
+		DeletedAt time.Time `json:"deleted_at"`
+		PurgeAt   time.Time `json:"purge_at"`
+	}
+	respondWithJSON(w, http.StatusAccepted, deleteAccountResponse{
+		DeletedAt: user.DeletedAt.Time,
+		PurgeAt:   cfg.deletionPolicy.PurgeAt(user.DeletedAt.Time),
+	})
+}
+
+type exportProfile struct {
+	Id          uuid.UUID `json:"id"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+	Email       string    `json:"email"`
+	IsChirpyRed bool      `json:"is_chirpy_red"`
+}
+
+type exportSubscriptionEvent struct {
+	Event            string     `json:"event"`
+	Status           string     `json:"status"`
+	CurrentPeriodEnd *time.Time `json:"current_period_end"`
+	OccurredAt       time.Time  `json:"occurred_at"`
+}
+
+type exportChirpyRed struct {
+	Active           bool                      `json:"active"`
+	Plan             string                    `json:"plan,omitempty"`
+	Status           string                    `json:"status,omitempty"`
+	CurrentPeriodEnd *time.Time                `json:"current_period_end,omitempty"`
+	History          []exportSubscriptionEvent `json:"history"`
+}
+
+type accountExport struct {
+	ExportedAt time.Time          `json:"exported_at"`
+	Profile    exportProfile      `json:"profile"`
+	Chirps     []Chirp            `json:"chirps"`
+	Sessions   []accounts.Session `json:"sessions"`
+	ChirpyRed  exportChirpyRed    `json:"chirpy_red"`
+}
+
+// handlerExportAccount returns everything stored about the caller, as a ZIP
+// archive of JSON files by default or as one JSON document with ?format=json.
+func (cfg *apiConfig) handlerExportAccount(w http.ResponseWriter, r *http.Request) {
+	userID, ok := cfg.authenticate(w, r)
+	if !ok {
+		return
+	}
+
+	export, err := cfg.buildAccountExport(r.Context(), userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		respondWithError(w, http.StatusNotFound, "user not found", nil)
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "couldn't export account", err)
+		return
+	}
+
+	switch r.URL.Query().Get("format") {
+	case "json":
+		respondWithJSON(w, http.StatusOK, export)
+	case "", "zip":
+		w.Header().Set("Content-Type", "application/zip")
+		w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="chirpy-export-%s.zip"`, userID))
+		w.WriteHeader(http.StatusOK)
+		if err := writeExportZip(w, export); err != nil {
+			// headers are gone already, all we can do is log
+			log.Printf("writing export for user %s: %s", userID, err)
+		}
+	default:
+		respondWithError(w, http.StatusBadRequest, "format must be zip or json", nil)
+	}
+}
+
+func (cfg *apiConfig) buildAccountExport(ctx context.Context, userID uuid.UUID) (accountExport, error) {
+	user, err := cfg.db.GetUserById(ctx, userID)
+	if err != nil {
+		return accountExport{}, err
+	}
+
+	chirps, err := cfg.db.ListAllChirpsByAuthor(ctx, userID)
+	if err != nil {
+		return accountExport{}, err
+	}
+
+	tokens, err := cfg.db.ListRefreshTokensByUser(ctx, userID)
+	if err != nil {
+		return accountExport{}, err
+	}
+
+	history, err := cfg.db.ListSubscriptionEvents(ctx, userID)
+	if err != nil {
+		return accountExport{}, err
+	}
+
+	export := accountExport{
+		ExportedAt: time.Now().UTC(),
+		Profile: exportProfile{
+			Id:          user.ID,
+			CreatedAt:   user.CreatedAt,
+			UpdatedAt:   user.UpdatedAt,
+			Email:       user.Email,
+			IsChirpyRed: user.IsChirpyRed,
+		},
+		Chirps: make([]Chirp, 0, len(chirps)),
+		// the token values are credentials, so only their lifecycle is exported
+		Sessions: accounts.Sessions(tokens),
+		ChirpyRed: exportChirpyRed{
+			Active:  user.IsChirpyRed,
+			History: make([]exportSubscriptionEvent, 0, len(history)),
+		},
+	}
+	sub, err := cfg.db.GetSubscription(ctx, userID)
+	switch {
+	case err == nil:
+		state := subscriptionState(sub)
+		export.ChirpyRed.Plan = state.Plan
+		export.ChirpyRed.Status = state.Status
+		export.ChirpyRed.CurrentPeriodEnd = state.CurrentPeriodEnd
+	case !errors.Is(err, sql.ErrNoRows):
+		return accountExport{}, err
+	}
+	for _, h := range history {
+		export.ChirpyRed.History = append(export.ChirpyRed.History, exportSubscriptionEvent{
+			Event:            h.Event,
+			Status:           h.Status,
+			CurrentPeriodEnd: timePtr(h.CurrentPeriodEnd),
+			OccurredAt:       h.OccurredAt,
+		})
+	}
+	for _, c := range chirps {
+		export.Chirps = append(export.Chirps, Chirp{
+			Id:        c.ID,
+			CreatedAt: c.CreatedAt,
+			UpdatedAt: c.UpdatedAt,
+			Body:      c.Body,
+			UserId:    c.UserID,
+		})
+	}
+
+	return export, nil
+}
+
+func writeExportZip(w http.ResponseWriter, export accountExport) error {
+	return accounts.WriteZip(w, export.ExportedAt, []accounts.File{
+		{Name: "profile.json", Data: export.Profile},
+		{Name: "chirps.json", Data: export.Chirps},
+		{Name: "sessions.json", Data: export.Sessions},
+		{Name: "chirpy_red.json", Data: export.ChirpyRed},
+	})
+}
+
+// runAccountPurger permanently removes accounts whose grace period is over.
+func (cfg *apiConfig) runAccountPurger(ctx context.Context, every time.Duration) {
+	ticker := time.NewTicker(every)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			n, err := cfg.purgeDeletedAccounts(ctx)
+			if err != nil {
+				log.Printf("purging deleted accounts: %s", err)
+				continue
+			}
+			if n > 0 {
+				log.Printf("purged %d deleted accounts", n)
+			}
+		}
+	}
+}
+
+func (cfg *apiConfig) purgeDeletedAccounts(ctx context.Context) (int64, error) {
+	tx, err := cfg.sqlDB.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	n, blobKeys, err := cfg.deletionPolicy.Purge(ctx, cfg.db.WithTx(tx), time.Now().UTC())
+	if err != nil {
+		return 0, err
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+	cfg.deleteBlobs(ctx, blobKeys)
+	return n, nil
+}
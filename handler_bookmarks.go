@@ -0,0 +1,332 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"local/mda/internal/database"
+	"local/mda/internal/paging"
+
+	"github.com/google/uuid"
+)
+
+const maxCollectionNameLength = 50
+
+type Bookmark struct {
+	CollectionId *uuid.UUID `json:"collection_id"`
+	CreatedAt    time.Time  `json:"created_at"`
+	Chirp        Chirp      `json:"chirp"`
+}
+
+type BookmarkCollection struct {
+	Id        uuid.UUID `json:"id"`
+	Name      string    `json:"name"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+func collectionFromRow(c database.BookmarkCollection) BookmarkCollection {
+	return BookmarkCollection{
+		Id:        c.ID,
+		Name:      c.Name,
+		CreatedAt: c.CreatedAt,
+		UpdatedAt: c.UpdatedAt,
+	}
+}
+
+// handlerGetBookmarks lists the viewer's bookmarks, optionally within one
+// collection, with the same sort/limit/offset parameters as GET /api/chirps.
+// Bookmarks are ordered by when they were saved.
+func (cfg *apiConfig) handlerGetBookmarks(w http.ResponseWriter, r *http.Request) {
+	userID, ok := cfg.authenticate(w, r)
+	if !ok {
+		return
+	}
+	page, err := paging.Parse(r.URL.Query())
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error(), nil)
+		return
+	}
+
+	var collectionID uuid.NullUUID
+	if v := r.URL.Query().Get("collection_id"); v != "" {
+		id, err := uuid.Parse(v)
+		if err != nil {
+			respondWithError(w, http.StatusBadRequest, "invalid collection_id", err)
+			return
+		}
+		collectionID = uuid.NullUUID{UUID: id, Valid: true}
+	}
+
+	ctx := r.Context()
+	rows, err := cfg.db.ListBookmarks(ctx, database.ListBookmarksParams{
+		UserID:       userID,
+		CollectionID: collectionID,
+		NewestFirst:  page.Desc,
+		PageLimit:    page.SQLLimit(),
+		PageOffset:   page.SQLOffset(),
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "couldn't fetch bookmarks", err)
+		return
+	}
+
+	ids := make([]uuid.UUID, 0, len(rows))
+	for _, b := range rows {
+		ids = append(ids, b.ChirpID)
+	}
+	chirpRows, err := cfg.db.GetChirpsByIds(ctx, ids)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "couldn't fetch chirps", err)
+		return
+	}
+	chirps, err := cfg.chirpResponses(ctx, userID, chirpRows)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "couldn't load chirp details", err)
+		return
+	}
+	byID := make(map[uuid.UUID]Chirp, len(chirps))
+	for _, c := range chirps {
+		byID[c.Id] = c
+	}
+
+	out := make([]Bookmark, 0, len(rows))
+	for _, b := range rows {
+		chirp, ok := byID[b.ChirpID]
+		if !ok {
+			// deleted between the two queries
+			continue
+		}
+		bm := Bookmark{CreatedAt: b.CreatedAt, Chirp: chirp}
+		if b.CollectionID.Valid {
+			id := b.CollectionID.UUID
+			bm.CollectionId = &id
+		}
+		out = append(out, bm)
+	}
+	respondWithJSON(w, http.StatusOK, out)
+}
+
+// handlerCreateBookmark saves a chirp, or moves an existing bookmark to
+// another collection.
+func (cfg *apiConfig) handlerCreateBookmark(w http.ResponseWriter, r *http.Request) {
+	type bookmarkRequest struct {
+		ChirpId      uuid.UUID  `json:"chirp_id"`
+		CollectionId *uuid.UUID `json:"collection_id"`
+	}
+
+	userID, ok := cfg.authenticate(w, r)
+	if !ok {
+		return
+	}
+	var params bookmarkRequest
+	if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Couldn't decode parameters", err)
+		return
+	}
+
+	ctx := r.Context()
+	chirp, err := cfg.visibleChirp(ctx, params.ChirpId, userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		respondWithError(w, http.StatusNotFound, "chirp not found", nil)
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "couldn't fetch chirp", err)
+		return
+	}
+
+	var collectionID uuid.NullUUID
+	if params.CollectionId != nil {
+		_, err := cfg.db.GetBookmarkCollection(ctx, database.GetBookmarkCollectionParams{
+			ID:     *params.CollectionId,
+			UserID: userID,
+		})
+		if errors.Is(err, sql.ErrNoRows) {
+			respondWithError(w, http.StatusNotFound, "collection not found", nil)
+			return
+		}
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "couldn't fetch collection", err)
+			return
+		}
+		collectionID = uuid.NullUUID{UUID: *params.CollectionId, Valid: true}
+	}
+
+	bookmark, err := cfg.db.UpsertBookmark(ctx, database.UpsertBookmarkParams{
+		UserID:       userID,
+		ChirpID:      chirp.ID,
+		CollectionID: collectionID,
+	})
+	if isForeignKeyViolation(err) {
+		// chirp or collection deleted in the meantime
+		respondWithError(w, http.StatusNotFound, "chirp or collection not found", nil)
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "couldn't save bookmark", err)
+		return
+	}
+
+	resp, err := cfg.chirpResponse(ctx, userID, chirp)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "couldn't load chirp details", err)
+		return
+	}
+	respondWithJSON(w, http.StatusCreated, Bookmark{
+		CollectionId: params.CollectionId,
+		CreatedAt:    bookmark.CreatedAt,
+		Chirp:        resp,
+	})
+}
+
+func (cfg *apiConfig) handlerDeleteBookmark(w http.ResponseWriter, r *http.Request) {
+	userID, ok := cfg.authenticate(w, r)
+	if !ok {
+		return
+	}
+	chirpID, err := uuid.Parse(r.PathValue("chirpId"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "invalid chirp id", err)
+		return
+	}
+
+	n, err := cfg.db.DeleteBookmark(r.Context(), database.DeleteBookmarkParams{UserID: userID, ChirpID: chirpID})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "couldn't delete bookmark", err)
+		return
+	}
+	if n == 0 {
+		respondWithError(w, http.StatusNotFound, "bookmark not found", nil)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func decodeCollectionName(w http.ResponseWriter, r *http.Request) (string, bool) {
+	var params struct {
+		Name string `json:"name"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Couldn't decode parameters", err)
+		return "", false
+	}
+	name := strings.TrimSpace(params.Name)
+	if name == "" || utf8.RuneCountInString(name) > maxCollectionNameLength {
+		respondWithValidationErrors(w, "invalid collection", []validationError{{
+			Field:   "name",
+			Code:    "length",
+			Message: "name must be between 1 and 50 characters",
+		}})
+		return "", false
+	}
+	return name, true
+}
+
+func (cfg *apiConfig) handlerGetBookmarkCollections(w http.ResponseWriter, r *http.Request) {
+	userID, ok := cfg.authenticate(w, r)
+	if !ok {
+		return
+	}
+
+	rows, err := cfg.db.ListBookmarkCollections(r.Context(), userID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "couldn't fetch collections", err)
+		return
+	}
+	out := make([]BookmarkCollection, 0, len(rows))
+	for _, c := range rows {
+		out = append(out, collectionFromRow(c))
+	}
+	respondWithJSON(w, http.StatusOK, out)
+}
+
+func (cfg *apiConfig) handlerCreateBookmarkCollection(w http.ResponseWriter, r *http.Request) {
+	userID, ok := cfg.authenticate(w, r)
+	if !ok {
+		return
+	}
+	name, ok := decodeCollectionName(w, r)
+	if !ok {
+		return
+	}
+
+	c, err := cfg.db.CreateBookmarkCollection(r.Context(), database.CreateBookmarkCollectionParams{
+		UserID: userID,
+		Name:   name,
+	})
+	if isUniqueViolation(err) {
+		respondWithError(w, http.StatusConflict, "you already have a collection with that name", nil)
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "couldn't create collection", err)
+		return
+	}
+	respondWithJSON(w, http.StatusCreated, collectionFromRow(c))
+}
+
+func (cfg *apiConfig) handlerRenameBookmarkCollection(w http.ResponseWriter, r *http.Request) {
+	userID, ok := cfg.authenticate(w, r)
+	if !ok {
+		return
+	}
+	id, err := uuid.Parse(r.PathValue("collectionId"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "invalid collection id", err)
+		return
+	}
+	name, ok := decodeCollectionName(w, r)
+	if !ok {
+		return
+	}
+
+	c, err := cfg.db.RenameBookmarkCollection(r.Context(), database.RenameBookmarkCollectionParams{
+		ID:     id,
+		UserID: userID,
+		Name:   name,
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		respondWithError(w, http.StatusNotFound, "collection not found", nil)
+		return
+	}
+	if isUniqueViolation(err) {
+		respondWithError(w, http.StatusConflict, "you already have a collection with that name", nil)
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "couldn't rename collection", err)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, collectionFromRow(c))
+}
+
+// handlerDeleteBookmarkCollection removes a collection; its bookmarks are
+// kept without a collection.
+func (cfg *apiConfig) handlerDeleteBookmarkCollection(w http.ResponseWriter, r *http.Request) {
+	userID, ok := cfg.authenticate(w, r)
+	if !ok {
+		return
+	}
+	id, err := uuid.Parse(r.PathValue("collectionId"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "invalid collection id", err)
+		return
+	}
+
+	n, err := cfg.db.DeleteBookmarkCollection(r.Context(), database.DeleteBookmarkCollectionParams{ID: id, UserID: userID})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "couldn't delete collection", err)
+		return
+	}
+	if n == 0 {
+		respondWithError(w, http.StatusNotFound, "collection not found", nil)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+
+	"local/mda/internal/database"
+	"local/mda/internal/media"
+
+	"github.com/google/uuid"
+)
+
+const maxMediaPerChirp = 4
+
+type ChirpMedia struct {
+	Id           uuid.UUID `json:"id"`
+	Url          string    `json:"url"`
+	ThumbnailUrl string    `json:"thumbnail_url"`
+	ContentType  string    `json:"content_type"`
+	Width        int32     `json:"width"`
+	Height       int32     `json:"height"`
+}
+
+func isMultipart(r *http.Request) bool {
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	return err == nil && mediaType == "multipart/form-data"
+}
+
+// parseChirpMultipart reads a multipart chirp: the text in the "body" field
+// and up to maxMediaPerChirp images in "media" fields. It writes the error
+// response itself and returns false on failure.
+func (cfg *apiConfig) parseChirpMultipart(w http.ResponseWriter, r *http.Request) (string, []media.Processed, bool) {
+	maxRequest := int64(maxMediaPerChirp)*cfg.mediaLimits.MaxBytes + 1<<20
+	r.Body = http.MaxBytesReader(w, r.Body, maxRequest)
+	if err := r.ParseMultipartForm(8 << 20); err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			respondWithError(w, http.StatusRequestEntityTooLarge, "upload is too large", nil)
+			return "", nil, false
+		}
+		respondWithError(w, http.StatusBadRequest, "couldn't parse multipart form", err)
+		return "", nil, false
+	}
+	defer r.MultipartForm.RemoveAll()
+
+	files := r.MultipartForm.File["media"]
+	if len(files) > maxMediaPerChirp {
+		respondWithError(w, http.StatusBadRequest, fmt.Sprintf("at most %d media files per chirp", maxMediaPerChirp), nil)
+		return "", nil, false
+	}
+
+	uploads := make([]media.Processed, 0, len(files))
+	for _, fh := range files {
+		if fh.Size > cfg.mediaLimits.MaxBytes {
+			respondWithError(w, http.StatusRequestEntityTooLarge, fmt.Sprintf("%s is too large", fh.Filename), nil)
+			return "", nil, false
+		}
+		f, err := fh.Open()
+		if err != nil {
+			respondWithError(w, http.StatusBadRequest, "couldn't read upload", err)
+			return "", nil, false
+		}
+		data, err := io.ReadAll(io.LimitReader(f, cfg.mediaLimits.MaxBytes+1))
+		f.Close()
+		if err != nil {
+			respondWithError(w, http.StatusBadRequest, "couldn't read upload", err)
+			return "", nil, false
+		}
+
+		processed, err := media.Process(data, cfg.mediaLimits)
+		switch {
+		case errors.Is(err, media.ErrTooLarge):
+			respondWithError(w, http.StatusRequestEntityTooLarge, fmt.Sprintf("%s is too large", fh.Filename), nil)
+			return "", nil, false
+		case errors.Is(err, media.ErrUnsupportedType):
+			respondWithError(w, http.StatusUnsupportedMediaType, "only JPEG, PNG and GIF images are supported", nil)
+			return "", nil, false
+		case errors.Is(err, media.ErrTooManyPixels):
+			respondWithError(w, http.StatusBadRequest, fmt.Sprintf("%s has too many pixels", fh.Filename), nil)
+			return "", nil, false
+		case err != nil:
+			respondWithError(w, http.StatusBadRequest, fmt.Sprintf("couldn't process %s", fh.Filename), err)
+			return "", nil, false
+		}
+		uploads = append(uploads, processed)
+	}
+
+	return r.FormValue("body"), uploads, true
+}
+
+// storeChirpMedia writes the blobs and records them against the chirp using
+// q, which should be bound to the chirp's transaction. It returns the keys
+// written so the caller can remove them if the transaction fails.
+func (cfg *apiConfig) storeChirpMedia(ctx context.Context, q *database.Queries, chirpID uuid.UUID, uploads []media.Processed) ([]string, error) {
+	var keys []string
+	for i, up := range uploads {
+		mediaID := uuid.New()
+		key := fmt.Sprintf("%s.%s", mediaID, up.Ext)
+		thumbKey := fmt.Sprintf("%s_thumb.%s", mediaID, up.ThumbnailExt)
+
+		if err := cfg.blobs.Put(ctx, key, bytes.NewReader(up.Data)); err != nil {
+			return keys, err
+		}
+		keys = append(keys, key)
+		if err := cfg.blobs.Put(ctx, thumbKey, bytes.NewReader(up.Thumbnail)); err != nil {
+			return keys, err
+		}
+		keys = append(keys, thumbKey)
+
+		_, err := q.CreateChirpMedia(ctx, database.CreateChirpMediaParams{
+			ID:           mediaID,
+			ChirpID:      chirpID,
+			Position:     int32(i),
+			ContentType:  up.ContentType,
+			SizeBytes:    int64(len(up.Data)),
+			Width:        int32(up.Width),
+			Height:       int32(up.Height),
+			StorageKey:   key,
+			ThumbnailKey: thumbKey,
+		})
+		if err != nil {
+			return keys, err
+		}
+	}
+	return keys, nil
+}
+
+// deleteBlobs is best effort; a leftover blob is only wasted space.
+func (cfg *apiConfig) deleteBlobs(ctx context.Context, keys []string) {
+	for _, key := range keys {
+		if err := cfg.blobs.Delete(ctx, key); err != nil {
+			log.Printf("deleting blob %s: %s", key, err)
+		}
+	}
+}
+
+func (cfg *apiConfig) mediaByChirp(ctx context.Context, q *database.Queries, chirpIDs []uuid.UUID) (map[uuid.UUID][]ChirpMedia, error) {
+	out := make(map[uuid.UUID][]ChirpMedia)
+	if len(chirpIDs) == 0 {
+		return out, nil
+	}
+
+	rows, err := q.ListMediaForChirps(ctx, chirpIDs)
+	if err != nil {
+		return nil, err
+	}
+	for _, m := range rows {
+		out[m.ChirpID] = append(out[m.ChirpID], ChirpMedia{
+			Id:           m.ID,
+			Url:          cfg.blobs.URL(m.StorageKey),
+			ThumbnailUrl: cfg.blobs.URL(m.ThumbnailKey),
+			ContentType:  m.ContentType,
+			Width:        m.Width,
+			Height:       m.Height,
+		})
+	}
+	return out, nil
+}
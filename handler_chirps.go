@@ -5,11 +5,17 @@ import (
 	"database/sql"
 	"encoding/json"
 	"errors"
-	"fmt"
-	"local/mda/internal/auth"
+	"local/mda/internal/chirps"
 	"local/mda/internal/database"
+	"local/mda/internal/events"
+	"local/mda/internal/linkpreview"
+	"local/mda/internal/media"
+	"local/mda/internal/notifications"
+	"local/mda/internal/paging"
+	"local/mda/internal/polls"
+	"local/mda/internal/profiles"
+	"local/mda/internal/relationships"
 	"net/http"
-	"sort"
 	"time"
 
 	"github.com/google/uuid"
@@ -21,52 +27,248 @@ type Chirp struct {
 	UpdatedAt time.Time `json:"updated_at"`
 	Body string `json:"body"`
 	UserId uuid.UUID `json:"user_id"`
+	PublishAt time.Time `json:"publish_at"`
+	Published bool `json:"published"`
+	Author *profiles.Author `json:"author,omitempty"`
+	Media []ChirpMedia `json:"media,omitempty"`
+	LinkPreview *LinkPreview `json:"link_preview,omitempty"`
+	Poll *polls.Poll `json:"poll,omitempty"`
+}
+
+// chirpResponses maps chirp rows to the API shape as seen by viewerID
+// (uuid.Nil when anonymous), loading authors, media, link previews and polls
+// for all of them in one query each.
+func (cfg *apiConfig) chirpResponses(ctx context.Context, viewerID uuid.UUID, rows []database.Chirp) ([]Chirp, error) {
+	return cfg.chirpResponsesWith(ctx, cfg.db, viewerID, rows)
+}
+
+// chirpResponsesWith is chirpResponses reading through q, so chirps written
+// in a transaction can be rendered before it commits.
+func (cfg *apiConfig) chirpResponsesWith(ctx context.Context, q *database.Queries, viewerID uuid.UUID, rows []database.Chirp) ([]Chirp, error) {
+	ids := make([]uuid.UUID, 0, len(rows))
+	chirpIDs := make([]uuid.UUID, 0, len(rows))
+	seen := make(map[uuid.UUID]bool)
+	for _, c := range rows {
+		chirpIDs = append(chirpIDs, c.ID)
+		if !seen[c.UserID] {
+			seen[c.UserID] = true
+			ids = append(ids, c.UserID)
+		}
+	}
+
+	attachments, err := cfg.mediaByChirp(ctx, q, chirpIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	previews, err := cfg.linkPreviewsByChirp(ctx, q, rows)
+	if err != nil {
+		return nil, err
+	}
+
+	pollViews, err := cfg.pollsByChirp(ctx, q, viewerID, chirpIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	authors := make(map[uuid.UUID]*profiles.Author, len(ids))
+	if len(ids) > 0 {
+		users, err := q.GetUsersByIds(ctx, ids)
+		if err != nil {
+			return nil, err
+		}
+		for _, u := range users {
+			author := profiles.AuthorOf(u)
+			authors[u.ID] = &author
+		}
+	}
+
+	out := make([]Chirp, 0, len(rows))
+	for _, c := range rows {
+		out = append(out, Chirp{
+			Id:          c.ID,
+			CreatedAt:   c.CreatedAt,
+			UpdatedAt:   c.UpdatedAt,
+			Body:        c.Body,
+			UserId:      c.UserID,
+			PublishAt:   c.PublishAt,
+			Published:   c.PublishedAt.Valid,
+			Author:      authors[c.UserID],
+			Media:       attachments[c.ID],
+			LinkPreview: previews[c.ID],
+			Poll:        pollViews[c.ID],
+		})
+	}
+	return out, nil
+}
+
+func (cfg *apiConfig) chirpResponse(ctx context.Context, viewerID uuid.UUID, row database.Chirp) (Chirp, error) {
+	out, err := cfg.chirpResponses(ctx, viewerID, []database.Chirp{row})
+	if err != nil {
+		return Chirp{}, err
+	}
+	return out[0], nil
 }
 
 func (cfg *apiConfig) handlerCreateChirp(w http.ResponseWriter, r *http.Request) {
 	type createChirpRequest struct {
 		Body string `json:"body"`
+		PublishAt *time.Time `json:"publish_at"`
+		Poll *polls.Request `json:"poll"`
 	}
 
-	decoder := json.NewDecoder(r.Body)
+	userId, ok := cfg.authenticate(w, r)
+	if !ok {
+		return
+	}
+
+	// JSON for text-only chirps, multipart when images are attached
 	params := createChirpRequest{}
-	err := decoder.Decode(&params)
+	var uploads []media.Processed
+	if isMultipart(r) {
+		var ok bool
+		params.Body, uploads, ok = cfg.parseChirpMultipart(w, r)
+		if !ok {
+			return
+		}
+		if v := r.FormValue("publish_at"); v != "" {
+			t, err := time.Parse(time.RFC3339, v)
+			if err != nil {
+				respondWithError(w, http.StatusBadRequest, "publish_at must be an RFC 3339 timestamp", err)
+				return
+			}
+			params.PublishAt = &t
+		}
+		if v := r.FormValue("poll"); v != "" {
+			params.Poll = &polls.Request{}
+			if err := json.Unmarshal([]byte(v), params.Poll); err != nil {
+				respondWithError(w, http.StatusBadRequest, "couldn't decode poll", err)
+				return
+			}
+		}
+	} else {
+		decoder := json.NewDecoder(r.Body)
+		err := decoder.Decode(&params)
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Couldn't decode parameters", err)
+			return
+		}
+	}
+
+	resp, err := cfg.createChirp(r.Context(), userId, chirpInput{
+		Body:      params.Body,
+		PublishAt: params.PublishAt,
+		Poll:      params.Poll,
+		Media:     uploads,
+	})
 	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, "Couldn't decode parameters", err)
+		respondWithAPIError(w, err)
 		return
 	}
+	respondWithJSON(w, http.StatusCreated, resp)
+}
+
+// chirpInput is a new chirp as received from any transport.
+type chirpInput struct {
+	Body      string
+	PublishAt *time.Time
+	Poll      *polls.Request
+	Media     []media.Processed
+}
 
-	bearer, err := auth.GetBearerToken(r.Header)
+// createChirp stores a chirp with its poll and media in one transaction and
+// runs the follow-up work. Errors meant for the client are *apiError.
+func (cfg *apiConfig) createChirp(ctx context.Context, userID uuid.UUID, in chirpInput) (Chirp, error) {
+	tx, err := cfg.sqlDB.BeginTx(ctx, nil)
 	if err != nil {
-		respondWithError(w, http.StatusUnauthorized, "Not authorized to access", nil)
-		return
+		return Chirp{}, &apiError{Status: http.StatusInternalServerError, Message: "couldn't start transaction", Err: err}
 	}
+	defer tx.Rollback()
+	qtx := cfg.db.WithTx(tx)
 
-	userId, err := auth.ValidateJWT(bearer, cfg.authSecret)
+	chirpEntity, err := cfg.insertChirp(ctx, qtx, userID, in.Body, in.PublishAt)
+	var apiErr *apiError
+	if errors.As(err, &apiErr) {
+		return Chirp{}, err
+	}
+	if errors.Is(err, chirps.ErrScheduleTooFar) {
+		return Chirp{}, &apiError{Status: http.StatusBadRequest, Message: err.Error()}
+	}
 	if err != nil {
-		respondWithError(w, http.StatusUnauthorized, "Not authorized to access", nil)
-		return
+		return Chirp{}, &apiError{Status: http.StatusInternalServerError, Message: "error creating chirp", Err: err}
 	}
 
-	chirp := cleanProfaneWords(params.Body)
+	if in.Poll != nil {
+		if errs := validatePoll(in.Poll, chirpEntity.PublishAt); len(errs) > 0 {
+			return Chirp{}, &apiError{Status: http.StatusBadRequest, Message: "invalid poll", Errors: errs}
+		}
+		if err := storePoll(ctx, qtx, chirpEntity.ID, in.Poll); err != nil {
+			return Chirp{}, &apiError{Status: http.StatusInternalServerError, Message: "couldn't create poll", Err: err}
+		}
+	}
 
-	chirpEntity, err := cfg.db.CreateChirp(context.Background(), database.CreateChirpParams{
-		Body: chirp,
-		UserID: userId,
-	})
+	blobKeys, err := cfg.storeChirpMedia(ctx, qtx, chirpEntity.ID, in.Media)
 	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, "error creating chirp: %w", err)
-		return
+		cfg.deleteBlobs(ctx, blobKeys)
+		return Chirp{}, &apiError{Status: http.StatusInternalServerError, Message: "couldn't store media", Err: err}
 	}
 
-	fmt.Printf("Created chirp for user: %s, message: '%s'\n", chirpEntity.UserID, chirpEntity.Body)
-	respondWithJSON(w, http.StatusCreated, Chirp {
-		Id: chirpEntity.ID,
-		CreatedAt: chirpEntity.CreatedAt,
-		UpdatedAt: chirpEntity.UpdatedAt,
-		Body: chirpEntity.Body,
-		UserId: chirpEntity.UserID,
-	})
+	resp, err := cfg.chirpCreated(ctx, qtx, chirpEntity)
+	if err != nil {
+		cfg.deleteBlobs(ctx, blobKeys)
+		return Chirp{}, &apiError{Status: http.StatusInternalServerError, Message: "couldn't load chirp details", Err: err}
+	}
+
+	if err := tx.Commit(); err != nil {
+		cfg.deleteBlobs(ctx, blobKeys)
+		return Chirp{}, &apiError{Status: http.StatusInternalServerError, Message: "error creating chirp", Err: err}
+	}
+	cfg.chirpCommitted(chirpEntity)
+	return resp, nil
+}
+
+// insertChirp is the single path every new chirp takes, whether posted
+// directly or published from a draft: the author's plan limits are checked
+// (violations are *apiError), then chirps.New cleans the body and decides
+// whether the chirp goes live now or waits for the scheduler.
+func (cfg *apiConfig) insertChirp(ctx context.Context, q *database.Queries, userID uuid.UUID, body string, publishAt *time.Time) (database.Chirp, error) {
+	plan, err := cfg.userPlan(ctx, q, userID)
+	if err != nil {
+		return database.Chirp{}, err
+	}
+	if err := checkChirpAllowance(ctx, q, userID, plan, body, publishAt); err != nil {
+		return database.Chirp{}, err
+	}
+
+	params, err := chirps.New(userID, body, publishAt, time.Now().UTC(), plan.Limits.MaxScheduleAhead)
+	if err != nil {
+		return database.Chirp{}, err
+	}
+	return q.CreateChirp(ctx, params)
+}
+
+// chirpCreated renders a chirp inserted through q, the transaction that
+// created it, and records chirp.created there if it is already published.
+func (cfg *apiConfig) chirpCreated(ctx context.Context, q *database.Queries, row database.Chirp) (Chirp, error) {
+	out, err := cfg.chirpResponsesWith(ctx, q, uuid.Nil, []database.Chirp{row})
+	if err != nil {
+		return Chirp{}, err
+	}
+	if row.PublishedAt.Valid {
+		if err := cfg.recordEvent(ctx, q, events.ChirpCreated, row.UserID, out[0]); err != nil {
+			return Chirp{}, err
+		}
+	}
+	return out[0], nil
+}
+
+// chirpCommitted runs the follow-up work once a new chirp's transaction has
+// committed.
+func (cfg *apiConfig) chirpCommitted(row database.Chirp) {
+	if u, ok := linkpreview.ExtractURL(row.Body); ok {
+		cfg.linkPreviews.Enqueue(u)
+	}
+	cfg.eventDispatcher.Kick()
 }
 
 func (cfg *apiConfig) handlerGetChirpById(w http.ResponseWriter, r *http.Request) {
@@ -77,7 +279,8 @@ func (cfg *apiConfig) handlerGetChirpById(w http.ResponseWriter, r *http.Request
 		return
 	}
 
-	chirp, err := cfg.db.GetChirpById(context.Background(), chirpUuid)
+	viewerID := cfg.optionalUserID(r)
+	chirp, err := cfg.visibleChirp(r.Context(), chirpUuid, viewerID)
 	if errors.Is(err, sql.ErrNoRows) {
 		respondWithError(w, http.StatusNotFound, "could not find chirp with that id", nil)
 		return
@@ -88,26 +291,19 @@ func (cfg *apiConfig) handlerGetChirpById(w http.ResponseWriter, r *http.Request
 		return
 	}
 
-	respondWithJSON(w, http.StatusOK, Chirp{
-		Id:        chirp.ID,
-		CreatedAt: chirp.CreatedAt,
-		UpdatedAt: chirp.UpdatedAt,
-		Body:      chirp.Body,
-		UserId:    chirp.UserID,
-	})
+	resp, err := cfg.chirpResponse(r.Context(), viewerID, chirp)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "couldn't load chirp details", err)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, resp)
 }
 
 
 func (cfg *apiConfig) handlerDeleteChirp(w http.ResponseWriter, r *http.Request) {
 	// 1) Require and validate access token
-	bearer, err := auth.GetBearerToken(r.Header)
-	if err != nil || bearer == "" {
-		respondWithError(w, http.StatusUnauthorized, "missing or invalid authorization header", nil)
-		return
-	}
-	userID, err := auth.ValidateJWT(bearer, cfg.authSecret) // returns uuid.UUID for the subject
-	if err != nil {
-		respondWithError(w, http.StatusUnauthorized, "invalid or expired token", nil)
+	userID, ok := cfg.authenticate(w, r)
+	if !ok {
 		return
 	}
 
@@ -119,43 +315,109 @@ func (cfg *apiConfig) handlerDeleteChirp(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	// 3) Load chirp (404 if not found)
-	chirp, err := cfg.db.GetChirpById(context.Background(), chirpUUID)
-	if err != nil {
-		if errors.Is(err, sql.ErrNoRows) {
-			respondWithError(w, http.StatusNotFound, "chirp not found", nil)
-			return
-		}
-		respondWithError(w, http.StatusInternalServerError, "couldn't fetch chirp", err)
+	// 3) Delete (204 on success)
+	if err := cfg.deleteChirp(r.Context(), userID, chirpUUID); err != nil {
+		respondWithAPIError(w, err)
 		return
 	}
+	w.WriteHeader(http.StatusNoContent) // 204
+}
+
+// deleteChirp removes one of userID's chirps. Media rows, polls and
+// bookmarks cascade; blobs are removed after the commit. Errors meant for
+// the client are *apiError.
+func (cfg *apiConfig) deleteChirp(ctx context.Context, userID, chirpID uuid.UUID) error {
+	// Load chirp (404 if not found)
+	chirp, err := cfg.visibleChirp(ctx, chirpID, userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return &apiError{Status: http.StatusNotFound, Message: "chirp not found"}
+	}
+	if err != nil {
+		return &apiError{Status: http.StatusInternalServerError, Message: "couldn't fetch chirp", Err: err}
+	}
 
-	// 4) Ownership check (403 if not author)
+	// Ownership check (403 if not author)
 	if chirp.UserID != userID {
-		respondWithError(w, http.StatusForbidden, "you are not allowed to delete this chirp", nil)
-		return
+		return &apiError{Status: http.StatusForbidden, Message: "you are not allowed to delete this chirp"}
 	}
 
-	// 5) Delete (204 on success)
-	if err := cfg.db.DeleteChirp(context.Background(), chirpUUID); err != nil {
-		respondWithError(w, http.StatusInternalServerError, "couldn't delete chirp", err)
-		return
+	attachments, err := cfg.db.ListMediaForChirps(ctx, []uuid.UUID{chirpID})
+	if err != nil {
+		return &apiError{Status: http.StatusInternalServerError, Message: "couldn't fetch chirp media", Err: err}
 	}
-	w.WriteHeader(http.StatusNoContent) // 204
+	tx, err := cfg.sqlDB.BeginTx(ctx, nil)
+	if err != nil {
+		return &apiError{Status: http.StatusInternalServerError, Message: "couldn't start transaction", Err: err}
+	}
+	defer tx.Rollback()
+	qtx := cfg.db.WithTx(tx)
+
+	// tell everyone who saved the chirp, before the cascade drops their bookmarks
+	bookmarkers, err := qtx.ListBookmarkersForChirp(ctx, chirpID)
+	if err != nil {
+		return &apiError{Status: http.StatusInternalServerError, Message: "couldn't fetch bookmarks", Err: err}
+	}
+	for _, uid := range bookmarkers {
+		if uid == userID {
+			continue
+		}
+		err := notifications.Notify(ctx, qtx, uid, notifications.BookmarkedChirpDeleted, map[string]any{
+			"chirp_id": chirpID,
+		})
+		if err != nil {
+			return &apiError{Status: http.StatusInternalServerError, Message: "couldn't notify bookmarkers", Err: err}
+		}
+	}
+
+	if err := qtx.DeleteChirp(ctx, chirpID); err != nil {
+		return &apiError{Status: http.StatusInternalServerError, Message: "couldn't delete chirp", Err: err}
+	}
+	// scheduled chirps were never announced, so there is nothing to retract
+	if chirp.PublishedAt.Valid {
+		err := cfg.recordEvent(ctx, qtx, events.ChirpDeleted, chirp.UserID, chirpDeletedPayload{Id: chirp.ID, UserId: chirp.UserID})
+		if err != nil {
+			return &apiError{Status: http.StatusInternalServerError, Message: "couldn't record event", Err: err}
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return &apiError{Status: http.StatusInternalServerError, Message: "couldn't delete chirp", Err: err}
+	}
+	cfg.eventDispatcher.Kick()
+	for _, m := range attachments {
+		cfg.deleteBlobs(ctx, []string{m.StorageKey, m.ThumbnailKey})
+	}
+	return nil
 }
 
 func (cfg *apiConfig) handlerGetChirps(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
+	viewerID := cfg.optionalUserID(r)
+
+	page, err := paging.Parse(r.URL.Query())
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error(), nil)
+		return
+	}
+
+	// muted and blocked authors drop out of every feed
+	hidden, err := cfg.hiddenAuthors(ctx, viewerID, relationships.HiddenInFeeds)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "couldn't fetch relationships", err)
+		return
+	}
 
 	authorParam := r.URL.Query().Get("author_id")
-	var (
-		rows []database.Chirp
-		err  error
-	)
+	var rows []database.Chirp
 
 	if authorParam == "" {
-		// No filter → all chirps, ASC by created_at
-		rows, err = cfg.db.GetChirps(ctx)
+		// No filter → all visible chirps, ASC by publish_at
+		rows, err = cfg.db.GetChirps(ctx, database.GetChirpsParams{
+			ViewerID:        viewerID,
+			HiddenAuthorIds: hidden,
+			NewestFirst:     page.Desc,
+			PageLimit:       page.SQLLimit(),
+			PageOffset:      page.SQLOffset(),
+		})
 		if err != nil {
 			respondWithError(w, http.StatusInternalServerError, "couldn't fetch chirps", err)
 			return
@@ -168,7 +430,14 @@ func (cfg *apiConfig) handlerGetChirps(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 
-		rows, err = cfg.db.GetChirpsByAuthor(ctx, authorID)
+		rows, err = cfg.db.GetChirpsByAuthor(ctx, database.GetChirpsByAuthorParams{
+			UserID:          authorID,
+			ViewerID:        viewerID,
+			HiddenAuthorIds: hidden,
+			NewestFirst:     page.Desc,
+			PageLimit:       page.SQLLimit(),
+			PageOffset:      page.SQLOffset(),
+		})
 		if err != nil {
 			respondWithError(w, http.StatusInternalServerError, "couldn't fetch chirps for author", err)
 			return
@@ -176,30 +445,11 @@ func (cfg *apiConfig) handlerGetChirps(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Map DB → API shape (omit sensitive fields)
-	out := make([]Chirp, 0, len(rows))
-	for _, c := range rows {
-		out = append(out, Chirp{
-			Id:        c.ID,
-			CreatedAt: c.CreatedAt,
-			UpdatedAt: c.UpdatedAt,
-			Body:      c.Body,
-			UserId:    c.UserID,
-		})
-	}
-
-	// 3) Check query param "sort" (default asc)
-	sortParam := r.URL.Query().Get("sort")
-	if sortParam != "desc" {
-		sortParam = "asc"
+	out, err := cfg.chirpResponses(ctx, viewerID, rows)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "couldn't load chirp details", err)
+		return
 	}
 
-	sort.Slice(out, func(i, j int) bool {
-		if sortParam == "asc" {
-			return out[i].CreatedAt.Before(out[j].CreatedAt)
-		}
-		return out[j].CreatedAt.Before(out[i].CreatedAt)
-	})
-
-	// 4) Respond
 	respondWithJSON(w, http.StatusOK, out)
 }
@@ -0,0 +1,428 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"local/mda/internal/conversations"
+	"local/mda/internal/database"
+	"local/mda/internal/paging"
+	"local/mda/internal/profiles"
+
+	"github.com/google/uuid"
+)
+
+const (
+	maxConversationMembers = 8
+	maxMessageLength       = 2000
+	defaultMessagePageSize = 50
+)
+
+type Conversation struct {
+	Id          uuid.UUID          `json:"id"`
+	IsGroup     bool               `json:"is_group"`
+	Members     []profiles.Profile `json:"members"`
+	LastMessage *Message           `json:"last_message"`
+	UnreadCount int64              `json:"unread_count"`
+	CreatedAt   time.Time          `json:"created_at"`
+	UpdatedAt   time.Time          `json:"updated_at"`
+}
+
+type Message struct {
+	Id             uuid.UUID `json:"id"`
+	ConversationId uuid.UUID `json:"conversation_id"`
+	SenderId       uuid.UUID `json:"sender_id"`
+	Body           string    `json:"body"`
+	CreatedAt      time.Time `json:"created_at"`
+}
+
+func messageFromRow(m database.Message) Message {
+	return Message{
+		Id:             m.ID,
+		ConversationId: m.ConversationID,
+		SenderId:       m.SenderID,
+		Body:           m.Body,
+		CreatedAt:      m.CreatedAt,
+	}
+}
+
+// conversationResponses maps conversations to the API shape for viewerID,
+// with members, the latest message and the viewer's unread count.
+func (cfg *apiConfig) conversationResponses(ctx context.Context, viewerID uuid.UUID, rows []database.Conversation) ([]Conversation, error) {
+	out := make([]Conversation, 0, len(rows))
+	if len(rows) == 0 {
+		return out, nil
+	}
+	ids := make([]uuid.UUID, 0, len(rows))
+	for _, c := range rows {
+		ids = append(ids, c.ID)
+	}
+
+	members, err := cfg.db.ListConversationMembers(ctx, ids)
+	if err != nil {
+		return nil, err
+	}
+	userIDs := make([]uuid.UUID, 0, len(members))
+	seen := make(map[uuid.UUID]bool)
+	for _, m := range members {
+		if !seen[m.UserID] {
+			seen[m.UserID] = true
+			userIDs = append(userIDs, m.UserID)
+		}
+	}
+	users, err := cfg.db.GetUsersByIds(ctx, userIDs)
+	if err != nil {
+		return nil, err
+	}
+	byID := make(map[uuid.UUID]profiles.Profile, len(users))
+	for _, u := range users {
+		byID[u.ID] = profiles.FromUser(u)
+	}
+	membersByConversation := make(map[uuid.UUID][]profiles.Profile)
+	for _, m := range members {
+		if p, ok := byID[m.UserID]; ok {
+			membersByConversation[m.ConversationID] = append(membersByConversation[m.ConversationID], p)
+		}
+	}
+
+	latest, err := cfg.db.LatestMessages(ctx, ids)
+	if err != nil {
+		return nil, err
+	}
+	latestByConversation := make(map[uuid.UUID]*Message, len(latest))
+	for _, m := range latest {
+		msg := messageFromRow(m)
+		latestByConversation[m.ConversationID] = &msg
+	}
+
+	unread, err := cfg.db.CountUnreadMessages(ctx, viewerID)
+	if err != nil {
+		return nil, err
+	}
+	unreadByConversation := make(map[uuid.UUID]int64, len(unread))
+	for _, u := range unread {
+		unreadByConversation[u.ConversationID] = u.Unread
+	}
+
+	for _, c := range rows {
+		out = append(out, Conversation{
+			Id:          c.ID,
+			IsGroup:     c.IsGroup,
+			Members:     membersByConversation[c.ID],
+			LastMessage: latestByConversation[c.ID],
+			UnreadCount: unreadByConversation[c.ID],
+			CreatedAt:   c.CreatedAt,
+			UpdatedAt:   c.UpdatedAt,
+		})
+	}
+	return out, nil
+}
+
+func validMessageBody(body string) (string, bool) {
+	body = strings.TrimSpace(body)
+	return body, body != "" && utf8.RuneCountInString(body) <= maxMessageLength
+}
+
+func (cfg *apiConfig) handlerGetConversations(w http.ResponseWriter, r *http.Request) {
+	userID, ok := cfg.authenticate(w, r)
+	if !ok {
+		return
+	}
+	page, err := paging.Parse(r.URL.Query())
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error(), nil)
+		return
+	}
+
+	ctx := r.Context()
+	rows, err := cfg.db.ListConversationsForUser(ctx, database.ListConversationsForUserParams{
+		UserID:      userID,
+		NewestFirst: page.Desc,
+		PageLimit:   page.SQLLimit(),
+		PageOffset:  page.SQLOffset(),
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "couldn't fetch conversations", err)
+		return
+	}
+
+	out, err := cfg.conversationResponses(ctx, userID, rows)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "couldn't load conversations", err)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, out)
+}
+
+// handlerCreateConversation starts a conversation with one or more users,
+// optionally with a first message. A one-to-one conversation that already
+// exists is reused rather than duplicated.
+func (cfg *apiConfig) handlerCreateConversation(w http.ResponseWriter, r *http.Request) {
+	type conversationRequest struct {
+		MemberIds []uuid.UUID `json:"member_ids"`
+		Body      string      `json:"body"`
+	}
+
+	userID, ok := cfg.authenticate(w, r)
+	if !ok {
+		return
+	}
+	var params conversationRequest
+	if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Couldn't decode parameters", err)
+		return
+	}
+
+	var others []uuid.UUID
+	seen := map[uuid.UUID]bool{userID: true}
+	for _, id := range params.MemberIds {
+		if !seen[id] {
+			seen[id] = true
+			others = append(others, id)
+		}
+	}
+	if len(others) == 0 || len(others) >= maxConversationMembers {
+		respondWithError(w, http.StatusBadRequest, fmt.Sprintf("a conversation needs 1 to %d other members", maxConversationMembers-1), nil)
+		return
+	}
+
+	body, hasBody := validMessageBody(params.Body)
+	if params.Body != "" && !hasBody {
+		respondWithError(w, http.StatusBadRequest, fmt.Sprintf("message must be at most %d characters", maxMessageLength), nil)
+		return
+	}
+
+	ctx := r.Context()
+	users, err := cfg.db.GetUsersByIds(ctx, others)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "couldn't fetch users", err)
+		return
+	}
+	active := 0
+	for _, u := range users {
+		if u.DeletedAt.Valid {
+			continue
+		}
+		active++
+		allowed, err := conversations.CanMessage(ctx, cfg.db, userID, u)
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "couldn't check messaging permissions", err)
+			return
+		}
+		if !allowed {
+			respondWithError(w, http.StatusForbidden, fmt.Sprintf("user %s doesn't accept messages from you", u.ID), nil)
+			return
+		}
+	}
+	if active != len(others) {
+		respondWithError(w, http.StatusNotFound, "user not found", nil)
+		return
+	}
+
+	tx, err := cfg.sqlDB.BeginTx(ctx, nil)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "couldn't start transaction", err)
+		return
+	}
+	defer tx.Rollback()
+	qtx := cfg.db.WithTx(tx)
+
+	conversation, created, err := conversations.Open(ctx, qtx, userID, others)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "couldn't create conversation", err)
+		return
+	}
+	status := http.StatusOK
+	if created {
+		status = http.StatusCreated
+	}
+
+	if hasBody {
+		_, err := qtx.CreateMessage(ctx, database.CreateMessageParams{
+			ConversationID: conversation.ID,
+			SenderID:       userID,
+			Body:           body,
+		})
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "couldn't send message", err)
+			return
+		}
+		if err := qtx.TouchConversation(ctx, conversation.ID); err != nil {
+			respondWithError(w, http.StatusInternalServerError, "couldn't update conversation", err)
+			return
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "couldn't create conversation", err)
+		return
+	}
+
+	out, err := cfg.conversationResponses(ctx, userID, []database.Conversation{conversation})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "couldn't load conversation", err)
+		return
+	}
+	respondWithJSON(w, status, out[0])
+}
+
+// memberConversation loads a conversation the user belongs to. Non-members
+// get the same 404 as a missing conversation.
+func (cfg *apiConfig) memberConversation(w http.ResponseWriter, r *http.Request, userID uuid.UUID) (database.Conversation, bool) {
+	id, err := uuid.Parse(r.PathValue("conversationId"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "invalid conversation id", err)
+		return database.Conversation{}, false
+	}
+	c, err := conversations.ForMember(r.Context(), cfg.db, id, userID)
+	if errors.Is(err, conversations.ErrNotFound) {
+		respondWithError(w, http.StatusNotFound, "conversation not found", nil)
+		return database.Conversation{}, false
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "couldn't fetch conversation", err)
+		return database.Conversation{}, false
+	}
+	return c, true
+}
+
+// handlerGetMessages pages through a conversation with the shared
+// sort/limit/offset parameters; sort=desc returns the newest first.
+func (cfg *apiConfig) handlerGetMessages(w http.ResponseWriter, r *http.Request) {
+	userID, ok := cfg.authenticate(w, r)
+	if !ok {
+		return
+	}
+	page, err := paging.Parse(r.URL.Query())
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error(), nil)
+		return
+	}
+	conversation, ok := cfg.memberConversation(w, r, userID)
+	if !ok {
+		return
+	}
+	if page.Limit == 0 {
+		page.Limit = defaultMessagePageSize
+	}
+
+	rows, err := cfg.db.ListMessages(r.Context(), database.ListMessagesParams{
+		ConversationID: conversation.ID,
+		NewestFirst:    page.Desc,
+		PageLimit:      int32(page.Limit),
+		PageOffset:     int32(page.Offset),
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "couldn't fetch messages", err)
+		return
+	}
+	out := make([]Message, 0, len(rows))
+	for _, m := range rows {
+		out = append(out, messageFromRow(m))
+	}
+	respondWithJSON(w, http.StatusOK, out)
+}
+
+func (cfg *apiConfig) handlerSendMessage(w http.ResponseWriter, r *http.Request) {
+	userID, ok := cfg.authenticate(w, r)
+	if !ok {
+		return
+	}
+	var params struct {
+		Body string `json:"body"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Couldn't decode parameters", err)
+		return
+	}
+	body, ok := validMessageBody(params.Body)
+	if !ok {
+		respondWithError(w, http.StatusBadRequest, fmt.Sprintf("message must be between 1 and %d characters", maxMessageLength), nil)
+		return
+	}
+	conversation, ok := cfg.memberConversation(w, r, userID)
+	if !ok {
+		return
+	}
+
+	ctx := r.Context()
+	// a block ends a one-to-one conversation; groups carry on
+	if !conversation.IsGroup {
+		members, err := cfg.db.ListConversationMembers(ctx, []uuid.UUID{conversation.ID})
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "couldn't fetch conversation members", err)
+			return
+		}
+		for _, m := range members {
+			if m.UserID == userID {
+				continue
+			}
+			blocked, err := cfg.db.IsBlockedBetween(ctx, database.IsBlockedBetweenParams{UserID: userID, TargetID: m.UserID})
+			if err != nil {
+				respondWithError(w, http.StatusInternalServerError, "couldn't check messaging permissions", err)
+				return
+			}
+			if blocked {
+				respondWithError(w, http.StatusForbidden, "you can't message this user", nil)
+				return
+			}
+		}
+	}
+
+	tx, err := cfg.sqlDB.BeginTx(ctx, nil)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "couldn't start transaction", err)
+		return
+	}
+	defer tx.Rollback()
+	qtx := cfg.db.WithTx(tx)
+
+	msg, err := qtx.CreateMessage(ctx, database.CreateMessageParams{
+		ConversationID: conversation.ID,
+		SenderID:       userID,
+		Body:           body,
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "couldn't send message", err)
+		return
+	}
+	if err := qtx.TouchConversation(ctx, conversation.ID); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "couldn't update conversation", err)
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "couldn't send message", err)
+		return
+	}
+	respondWithJSON(w, http.StatusCreated, messageFromRow(msg))
+}
+
+// handlerMarkConversationRead marks every message in the conversation up to
+// now as read by the caller.
+func (cfg *apiConfig) handlerMarkConversationRead(w http.ResponseWriter, r *http.Request) {
+	userID, ok := cfg.authenticate(w, r)
+	if !ok {
+		return
+	}
+	conversation, ok := cfg.memberConversation(w, r, userID)
+	if !ok {
+		return
+	}
+
+	err := cfg.db.MarkConversationRead(r.Context(), database.MarkConversationReadParams{
+		ReadAt:         time.Now().UTC(),
+		ConversationID: conversation.ID,
+		UserID:         userID,
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "couldn't mark conversation read", err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
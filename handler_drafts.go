@@ -0,0 +1,251 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+	"unicode/utf8"
+
+	"local/mda/internal/chirps"
+	"local/mda/internal/database"
+
+	"github.com/google/uuid"
+)
+
+const maxDraftLength = 5000
+
+type Draft struct {
+	Id        uuid.UUID  `json:"id"`
+	Body      string     `json:"body"`
+	PublishAt *time.Time `json:"publish_at"`
+	CreatedAt time.Time  `json:"created_at"`
+	UpdatedAt time.Time  `json:"updated_at"`
+}
+
+func draftFromRow(d database.Draft) Draft {
+	out := Draft{
+		Id:        d.ID,
+		Body:      d.Body,
+		CreatedAt: d.CreatedAt,
+		UpdatedAt: d.UpdatedAt,
+	}
+	if d.PublishAt.Valid {
+		t := d.PublishAt.Time
+		out.PublishAt = &t
+	}
+	return out
+}
+
+type draftRequest struct {
+	Body      string     `json:"body"`
+	PublishAt *time.Time `json:"publish_at"`
+}
+
+// decodeDraft reads and checks userID's draft body, holding publish_at to
+// their plan's scheduling rules. Drafts keep the text as typed; cleaning
+// happens when the draft is published.
+func (cfg *apiConfig) decodeDraft(w http.ResponseWriter, r *http.Request, userID uuid.UUID) (string, sql.NullTime, bool) {
+	var params draftRequest
+	if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Couldn't decode parameters", err)
+		return "", sql.NullTime{}, false
+	}
+	if utf8.RuneCountInString(params.Body) > maxDraftLength {
+		respondWithError(w, http.StatusBadRequest, "draft is too long", nil)
+		return "", sql.NullTime{}, false
+	}
+	if params.PublishAt == nil {
+		return params.Body, sql.NullTime{}, true
+	}
+	plan, err := cfg.userPlan(r.Context(), cfg.db, userID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "couldn't fetch plan", err)
+		return "", sql.NullTime{}, false
+	}
+	if err := checkSchedule(plan, params.PublishAt); err != nil {
+		respondWithAPIError(w, err)
+		return "", sql.NullTime{}, false
+	}
+	return params.Body, sql.NullTime{Time: params.PublishAt.UTC(), Valid: true}, true
+}
+
+func draftID(w http.ResponseWriter, r *http.Request) (uuid.UUID, bool) {
+	id, err := uuid.Parse(r.PathValue("draftId"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "invalid draft id", err)
+		return uuid.Nil, false
+	}
+	return id, true
+}
+
+func (cfg *apiConfig) handlerCreateDraft(w http.ResponseWriter, r *http.Request) {
+	userID, ok := cfg.authenticate(w, r)
+	if !ok {
+		return
+	}
+	body, publishAt, ok := cfg.decodeDraft(w, r, userID)
+	if !ok {
+		return
+	}
+
+	draft, err := cfg.db.CreateDraft(r.Context(), database.CreateDraftParams{
+		UserID:    userID,
+		Body:      body,
+		PublishAt: publishAt,
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "couldn't save draft", err)
+		return
+	}
+	respondWithJSON(w, http.StatusCreated, draftFromRow(draft))
+}
+
+func (cfg *apiConfig) handlerListDrafts(w http.ResponseWriter, r *http.Request) {
+	userID, ok := cfg.authenticate(w, r)
+	if !ok {
+		return
+	}
+
+	rows, err := cfg.db.ListDraftsByUser(r.Context(), userID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "couldn't fetch drafts", err)
+		return
+	}
+	out := make([]Draft, 0, len(rows))
+	for _, d := range rows {
+		out = append(out, draftFromRow(d))
+	}
+	respondWithJSON(w, http.StatusOK, out)
+}
+
+func (cfg *apiConfig) handlerGetDraft(w http.ResponseWriter, r *http.Request) {
+	userID, ok := cfg.authenticate(w, r)
+	if !ok {
+		return
+	}
+	id, ok := draftID(w, r)
+	if !ok {
+		return
+	}
+
+	draft, err := cfg.db.GetDraft(r.Context(), database.GetDraftParams{ID: id, UserID: userID})
+	if errors.Is(err, sql.ErrNoRows) {
+		respondWithError(w, http.StatusNotFound, "draft not found", nil)
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "couldn't fetch draft", err)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, draftFromRow(draft))
+}
+
+func (cfg *apiConfig) handlerUpdateDraft(w http.ResponseWriter, r *http.Request) {
+	userID, ok := cfg.authenticate(w, r)
+	if !ok {
+		return
+	}
+	id, ok := draftID(w, r)
+	if !ok {
+		return
+	}
+	body, publishAt, ok := cfg.decodeDraft(w, r, userID)
+	if !ok {
+		return
+	}
+
+	draft, err := cfg.db.UpdateDraft(r.Context(), database.UpdateDraftParams{
+		ID:        id,
+		UserID:    userID,
+		Body:      body,
+		PublishAt: publishAt,
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		respondWithError(w, http.StatusNotFound, "draft not found", nil)
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "couldn't save draft", err)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, draftFromRow(draft))
+}
+
+func (cfg *apiConfig) handlerDeleteDraft(w http.ResponseWriter, r *http.Request) {
+	userID, ok := cfg.authenticate(w, r)
+	if !ok {
+		return
+	}
+	id, ok := draftID(w, r)
+	if !ok {
+		return
+	}
+
+	n, err := cfg.db.DeleteDraft(r.Context(), database.DeleteDraftParams{ID: id, UserID: userID})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "couldn't delete draft", err)
+		return
+	}
+	if n == 0 {
+		respondWithError(w, http.StatusNotFound, "draft not found", nil)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handlerPublishDraft turns a draft into a chirp and deletes the draft in
+// one transaction, so a draft is published at most once.
+func (cfg *apiConfig) handlerPublishDraft(w http.ResponseWriter, r *http.Request) {
+	userID, ok := cfg.authenticate(w, r)
+	if !ok {
+		return
+	}
+	id, ok := draftID(w, r)
+	if !ok {
+		return
+	}
+
+	ctx := r.Context()
+	tx, err := cfg.sqlDB.BeginTx(ctx, nil)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "couldn't start transaction", err)
+		return
+	}
+	defer tx.Rollback()
+	qtx := cfg.db.WithTx(tx)
+
+	chirp, err := chirps.PublishDraft(ctx, qtx, userID, id, func(body string, publishAt *time.Time) (database.Chirp, error) {
+		return cfg.insertChirp(ctx, qtx, userID, body, publishAt)
+	})
+	var apiErr *apiError
+	if errors.As(err, &apiErr) {
+		respondWithAPIError(w, err)
+		return
+	}
+	if errors.Is(err, sql.ErrNoRows) {
+		respondWithError(w, http.StatusNotFound, "draft not found", nil)
+		return
+	}
+	if errors.Is(err, chirps.ErrScheduleTooFar) {
+		respondWithError(w, http.StatusBadRequest, err.Error(), nil)
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "couldn't publish draft", err)
+		return
+	}
+
+	resp, err := cfg.chirpCreated(ctx, qtx, chirp)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "couldn't load chirp details", err)
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "error creating chirp", err)
+		return
+	}
+	cfg.chirpCommitted(chirp)
+	respondWithJSON(w, http.StatusCreated, resp)
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"local/mda/internal/auth"
+	"local/mda/internal/database"
+	"local/mda/internal/events"
+	"local/mda/internal/mailer"
+)
+
+const emailChangeTTL = 24 * time.Hour
+
+// sendEmailChangeMails asks the new address for confirmation and warns the
+// old one. The change is already stored, so delivery failures are logged.
+func (cfg *apiConfig) sendEmailChangeMails(ctx context.Context, oldEmail, newEmail, token string) {
+	msgs := []mailer.Message{
+		{
+			To:      newEmail,
+			Subject: "Confirm your new Chirpy email",
+			Body: fmt.Sprintf("Confirm this address by sending the token below to POST /api/users/email/confirm within %s.\n\n%s\n",
+				cfg.emailChangePolicy.TTL, token),
+		},
+		{
+			To:      oldEmail,
+			Subject: "Your Chirpy email is being changed",
+			Body:    fmt.Sprintf("Someone asked to change your Chirpy email to %s. If this wasn't you, change your password now.\n", newEmail),
+		},
+	}
+	for _, msg := range msgs {
+		if err := cfg.mailer.Send(ctx, msg); err != nil {
+			log.Printf("sending %q to %s: %s", msg.Subject, msg.To, err)
+		}
+	}
+}
+
+// handlerConfirmEmailChange switches the account to the pending address. The
+// token itself is the credential, so no access token is needed.
+func (cfg *apiConfig) handlerConfirmEmailChange(w http.ResponseWriter, r *http.Request) {
+	type confirmRequest struct {
+		Token string `json:"token"`
+	}
+
+	var body confirmRequest
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		respondWithError(w, http.StatusBadRequest, "couldn't decode request body", err)
+		return
+	}
+	if body.Token == "" {
+		respondWithError(w, http.StatusBadRequest, "token is required", nil)
+		return
+	}
+
+	ctx := r.Context()
+	tx, err := cfg.sqlDB.BeginTx(ctx, nil)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "couldn't start transaction", err)
+		return
+	}
+	defer tx.Rollback()
+	qtx := cfg.db.WithTx(tx)
+
+	change, err := qtx.GetEmailChangeByTokenHash(ctx, auth.HashToken(body.Token))
+	if errors.Is(err, sql.ErrNoRows) {
+		respondWithError(w, http.StatusNotFound, "unknown or already used token", nil)
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "couldn't fetch email change", err)
+		return
+	}
+	if !cfg.emailChangePolicy.Confirmable(change, time.Now().UTC()) {
+		respondWithError(w, http.StatusGone, "confirmation token expired", nil)
+		return
+	}
+
+	user, err := qtx.UpdateUserEmail(ctx, database.UpdateUserEmailParams{
+		ID:    change.UserID,
+		Email: change.NewEmail,
+	})
+	if err != nil {
+		if isUniqueViolation(err) {
+			respondWithError(w, http.StatusConflict, "email already in use", nil)
+			return
+		}
+		respondWithError(w, http.StatusInternalServerError, "couldn't update email", err)
+		return
+	}
+
+	if err := qtx.DeleteEmailChangesForUser(ctx, change.UserID); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "couldn't clear email change", err)
+		return
+	}
+
+	err = cfg.recordEvent(ctx, qtx, events.UserUpdated, user.ID, userEventPayload{
+		UserId:  user.ID,
+		Changed: []string{"email"},
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "couldn't record event", err)
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "couldn't update email", err)
+		return
+	}
+	cfg.eventDispatcher.Kick()
+
+	respondWithJSON(w, http.StatusOK, accountFromUser(user))
+}
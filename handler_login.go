@@ -5,10 +5,14 @@ import (
 	"database/sql"
 	"encoding/json"
 	"errors"
+	"local/mda/internal/accounts"
 	"local/mda/internal/auth"
 	"local/mda/internal/database"
+	"log"
 	"net/http"
 	"time"
+
+	"github.com/google/uuid"
 )
 
 
@@ -26,9 +30,22 @@ func (cfg *apiConfig) handlerLogin(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// throttle before touching the password hash
+	ip := clientIP(r)
+	retryAfter, err := cfg.loginGuard.Check(r.Context(), params.Email, ip)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "could not check login attempts", err)
+		return
+	}
+	if retryAfter > 0 {
+		respondTooManyRequests(w, retryAfter, "Too many failed login attempts, try again later")
+		return
+	}
+
 	user, err := cfg.db.GetUserByEmail(context.Background(), params.Email)
 	if errors.Is(err, sql.ErrNoRows) {
-		respondWithError(w, http.StatusUnauthorized, "Incorrect email or password", nil)
+		// no account to protect; only the client's IP is charged
+		cfg.recordLoginFailure(w, r, "", ip)
 		return
 	}
 	if err != nil {
@@ -36,9 +53,30 @@ func (cfg *apiConfig) handlerLogin(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	err = auth.CheckPasswordHash(params.Password, user.HashedPassword)
+	needsRehash, err := cfg.passwordHasher.Verify(params.Password, user.HashedPassword)
 	if err != nil {
-		respondWithError(w, http.StatusUnauthorized, "Incorrect email or password", nil)
+		cfg.recordLoginFailure(w, r, params.Email, ip)
+		return
+	}
+	if needsRehash {
+		cfg.rehashPassword(r.Context(), user.ID, params.Password, user.HashedPassword)
+	}
+
+	// logging in during the grace period cancels a pending deletion; after
+	// it the account is as good as purged
+	if !accounts.Active(user) {
+		if !cfg.deletionPolicy.Restorable(user, time.Now().UTC()) {
+			cfg.recordLoginFailure(w, r, params.Email, ip)
+			return
+		}
+		if err := cfg.db.RestoreUser(r.Context(), user.ID); err != nil {
+			respondWithError(w, http.StatusInternalServerError, "could not restore account", err)
+			return
+		}
+	}
+
+	if err := cfg.loginGuard.RecordSuccess(r.Context(), params.Email); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "could not reset login attempts", err)
 		return
 	}
 
@@ -81,6 +119,40 @@ func (cfg *apiConfig) handlerLogin(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
+// recordLoginFailure counts the failed attempt and responds with 401, or 429
+// if this failure pushed the account into backoff.
+func (cfg *apiConfig) recordLoginFailure(w http.ResponseWriter, r *http.Request, email, ip string) {
+	delay, err := cfg.loginGuard.RecordFailure(r.Context(), email, ip)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "could not record login attempt", err)
+		return
+	}
+	if delay > 0 {
+		respondTooManyRequests(w, delay, "Too many failed login attempts, try again later")
+		return
+	}
+	respondWithError(w, http.StatusUnauthorized, "Incorrect email or password", nil)
+}
+
+// rehashPassword upgrades a stored hash to the current hasher settings. It is
+// best effort: the login has already succeeded, so failures are only logged.
+func (cfg *apiConfig) rehashPassword(ctx context.Context, userID uuid.UUID, password, oldHash string) {
+	newHash, err := cfg.passwordHasher.Hash(password)
+	if err != nil {
+		log.Printf("could not rehash password for user %s: %s", userID, err)
+		return
+	}
+
+	err = cfg.db.RehashUserPassword(ctx, database.RehashUserPasswordParams{
+		NewHash: newHash,
+		ID:      userID,
+		OldHash: oldHash,
+	})
+	if err != nil {
+		log.Printf("could not store rehashed password for user %s: %s", userID, err)
+	}
+}
+
 func (cfg *apiConfig) hanldlerRefreshToken(w http.ResponseWriter, r *http.Request) {
 	type refreshToken struct {
 		Token string `json:"token"`
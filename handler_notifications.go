@@ -0,0 +1,195 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"local/mda/internal/database"
+	"local/mda/internal/notifications"
+	"local/mda/internal/paging"
+
+	"github.com/google/uuid"
+)
+
+const defaultNotificationPageSize = 50
+
+type Notification struct {
+	Id        uuid.UUID       `json:"id"`
+	Type      string          `json:"type"`
+	Data      json.RawMessage `json:"data"`
+	CreatedAt time.Time       `json:"created_at"`
+	ReadAt    *time.Time      `json:"read_at"`
+}
+
+type notificationsResponse struct {
+	UnreadCount   int64          `json:"unread_count"`
+	Notifications []Notification `json:"notifications"`
+}
+
+// handlerGetNotifications pages through the caller's notifications with the
+// shared sort/limit/offset parameters; unread=true skips read ones.
+func (cfg *apiConfig) handlerGetNotifications(w http.ResponseWriter, r *http.Request) {
+	userID, ok := cfg.authenticate(w, r)
+	if !ok {
+		return
+	}
+	page, err := paging.Parse(r.URL.Query())
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error(), nil)
+		return
+	}
+	if page.Limit == 0 {
+		page.Limit = defaultNotificationPageSize
+	}
+
+	ctx := r.Context()
+	rows, err := cfg.db.ListNotifications(ctx, database.ListNotificationsParams{
+		UserID:      userID,
+		UnreadOnly:  r.URL.Query().Get("unread") == "true",
+		NewestFirst: page.Desc,
+		PageLimit:   int32(page.Limit),
+		PageOffset:  int32(page.Offset),
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "couldn't fetch notifications", err)
+		return
+	}
+	unread, err := cfg.db.CountUnreadNotifications(ctx, userID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "couldn't count notifications", err)
+		return
+	}
+
+	out := notificationsResponse{
+		UnreadCount:   unread,
+		Notifications: make([]Notification, 0, len(rows)),
+	}
+	for _, n := range rows {
+		item := Notification{
+			Id:        n.ID,
+			Type:      n.Type,
+			Data:      n.Data,
+			CreatedAt: n.CreatedAt,
+		}
+		if n.ReadAt.Valid {
+			t := n.ReadAt.Time
+			item.ReadAt = &t
+		}
+		out.Notifications = append(out.Notifications, item)
+	}
+	respondWithJSON(w, http.StatusOK, out)
+}
+
+// handlerMarkNotificationsRead marks the given notifications read, or all
+// of them when the body has no "ids". An empty "ids" marks nothing.
+func (cfg *apiConfig) handlerMarkNotificationsRead(w http.ResponseWriter, r *http.Request) {
+	userID, ok := cfg.authenticate(w, r)
+	if !ok {
+		return
+	}
+	var params struct {
+		Ids *[]uuid.UUID `json:"ids"`
+	}
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+			respondWithError(w, http.StatusBadRequest, "Couldn't decode parameters", err)
+			return
+		}
+	}
+
+	ctx := r.Context()
+	var ids []uuid.UUID
+	if params.Ids != nil {
+		ids = append([]uuid.UUID{}, *params.Ids...)
+	}
+	_, err := notifications.MarkRead(ctx, cfg.db, userID, ids, time.Now().UTC())
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "couldn't mark notifications read", err)
+		return
+	}
+	unread, err := cfg.db.CountUnreadNotifications(ctx, userID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "couldn't count notifications", err)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, map[string]int64{"unread_count": unread})
+}
+
+// handlerGetNotificationPreferences returns every notification type with
+// whether the caller receives it.
+func (cfg *apiConfig) handlerGetNotificationPreferences(w http.ResponseWriter, r *http.Request) {
+	userID, ok := cfg.authenticate(w, r)
+	if !ok {
+		return
+	}
+	cfg.respondWithNotificationPreferences(w, r, userID)
+}
+
+func (cfg *apiConfig) respondWithNotificationPreferences(w http.ResponseWriter, r *http.Request, userID uuid.UUID) {
+	rows, err := cfg.db.ListNotificationPreferences(r.Context(), userID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "couldn't fetch preferences", err)
+		return
+	}
+	prefs := make(map[string]bool, len(notifications.Types))
+	for _, t := range notifications.Types {
+		prefs[t] = true
+	}
+	for _, p := range rows {
+		if notifications.Known(p.Type) {
+			prefs[p.Type] = p.Enabled
+		}
+	}
+	respondWithJSON(w, http.StatusOK, prefs)
+}
+
+// handlerUpdateNotificationPreferences takes a map of type to enabled and
+// leaves types that aren't mentioned unchanged.
+func (cfg *apiConfig) handlerUpdateNotificationPreferences(w http.ResponseWriter, r *http.Request) {
+	userID, ok := cfg.authenticate(w, r)
+	if !ok {
+		return
+	}
+	var params map[string]bool
+	if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Couldn't decode parameters", err)
+		return
+	}
+	var errs []validationError
+	for kind := range params {
+		if !notifications.Known(kind) {
+			errs = append(errs, validationError{Field: kind, Code: "unknown", Message: "unknown notification type"})
+		}
+	}
+	if len(errs) > 0 {
+		respondWithValidationErrors(w, "invalid preferences", errs)
+		return
+	}
+
+	ctx := r.Context()
+	tx, err := cfg.sqlDB.BeginTx(ctx, nil)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "couldn't start transaction", err)
+		return
+	}
+	defer tx.Rollback()
+	qtx := cfg.db.WithTx(tx)
+
+	for kind, enabled := range params {
+		err := qtx.UpsertNotificationPreference(ctx, database.UpsertNotificationPreferenceParams{
+			UserID:  userID,
+			Type:    kind,
+			Enabled: enabled,
+		})
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "couldn't save preferences", err)
+			return
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "couldn't save preferences", err)
+		return
+	}
+	cfg.respondWithNotificationPreferences(w, r, userID)
+}
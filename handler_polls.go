@@ -0,0 +1,173 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"local/mda/internal/database"
+	"local/mda/internal/polls"
+
+	"github.com/google/uuid"
+)
+
+// validatePoll checks the options and that the poll runs for a sensible time
+// after the chirp goes live.
+func validatePoll(p *polls.Request, publishAt time.Time) []validationError {
+	var errs []validationError
+	for _, problem := range p.Validate(publishAt) {
+		errs = append(errs, validationError{
+			Field:   problem.Field,
+			Code:    problem.Code,
+			Message: problem.Message,
+		})
+	}
+	return errs
+}
+
+// storePoll records the poll using q, which should be bound to the chirp's
+// transaction.
+func storePoll(ctx context.Context, q *database.Queries, chirpID uuid.UUID, p *polls.Request) error {
+	err := q.CreatePoll(ctx, database.CreatePollParams{
+		ChirpID:  chirpID,
+		ClosesAt: p.ClosesAt.UTC(),
+	})
+	if err != nil {
+		return err
+	}
+	for i, label := range p.Labels() {
+		err := q.CreatePollOption(ctx, database.CreatePollOptionParams{
+			ChirpID:  chirpID,
+			Position: int32(i),
+			Label:    label,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// pollsByChirp loads the polls attached to chirpIDs as seen by viewerID,
+// which may be uuid.Nil for anonymous requests.
+func (cfg *apiConfig) pollsByChirp(ctx context.Context, q *database.Queries, viewerID uuid.UUID, chirpIDs []uuid.UUID) (map[uuid.UUID]*polls.Poll, error) {
+	out := make(map[uuid.UUID]*polls.Poll)
+	if len(chirpIDs) == 0 {
+		return out, nil
+	}
+
+	rows, err := q.ListPollsForChirps(ctx, chirpIDs)
+	if err != nil {
+		return nil, err
+	}
+	if len(rows) == 0 {
+		return out, nil
+	}
+	pollIDs := make([]uuid.UUID, 0, len(rows))
+	for _, p := range rows {
+		pollIDs = append(pollIDs, p.ChirpID)
+	}
+
+	options, err := q.ListPollOptionsForChirps(ctx, pollIDs)
+	if err != nil {
+		return nil, err
+	}
+	optionsByPoll := make(map[uuid.UUID][]database.PollOption)
+	for _, o := range options {
+		optionsByPoll[o.ChirpID] = append(optionsByPoll[o.ChirpID], o)
+	}
+	counts, err := q.CountPollVotes(ctx, pollIDs)
+	if err != nil {
+		return nil, err
+	}
+	votesByOption := make(map[uuid.UUID]int64, len(counts))
+	for _, c := range counts {
+		votesByOption[c.OptionID] = c.Votes
+	}
+
+	viewerVotes := make(map[uuid.UUID]uuid.UUID)
+	if viewerID != uuid.Nil {
+		votes, err := q.ListPollVotesByUser(ctx, database.ListPollVotesByUserParams{
+			ChirpIds: pollIDs,
+			UserID:   viewerID,
+		})
+		if err != nil {
+			return nil, err
+		}
+		for _, v := range votes {
+			viewerVotes[v.ChirpID] = v.OptionID
+		}
+	}
+
+	now := time.Now().UTC()
+	for _, p := range rows {
+		var viewerVote *uuid.UUID
+		if vote, ok := viewerVotes[p.ChirpID]; ok {
+			viewerVote = &vote
+		}
+		out[p.ChirpID] = polls.View(p, optionsByPoll[p.ChirpID], votesByOption, viewerVote, now)
+	}
+	return out, nil
+}
+
+func (cfg *apiConfig) handlerVotePoll(w http.ResponseWriter, r *http.Request) {
+	type voteRequest struct {
+		OptionId uuid.UUID `json:"option_id"`
+	}
+
+	userID, ok := cfg.authenticate(w, r)
+	if !ok {
+		return
+	}
+	chirpID, err := uuid.Parse(r.PathValue("chirpId"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "invalid chirp id", err)
+		return
+	}
+	var params voteRequest
+	if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Couldn't decode parameters", err)
+		return
+	}
+
+	ctx := r.Context()
+	chirp, err := cfg.visibleChirp(ctx, chirpID, userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		respondWithError(w, http.StatusNotFound, "chirp not found", nil)
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "couldn't fetch chirp", err)
+		return
+	}
+	if !chirp.PublishedAt.Valid {
+		respondWithError(w, http.StatusConflict, "poll isn't open yet", nil)
+		return
+	}
+
+	err = polls.Vote(ctx, cfg.db, chirpID, userID, params.OptionId, time.Now().UTC())
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		respondWithError(w, http.StatusNotFound, "chirp has no poll", nil)
+		return
+	case errors.Is(err, polls.ErrClosed), errors.Is(err, polls.ErrAlreadyVoted):
+		respondWithError(w, http.StatusConflict, err.Error(), nil)
+		return
+	case isForeignKeyViolation(err):
+		respondWithError(w, http.StatusBadRequest, "option is not part of this poll", nil)
+		return
+	case err != nil:
+		respondWithError(w, http.StatusInternalServerError, "couldn't record vote", err)
+		return
+	}
+
+	views, err := cfg.pollsByChirp(ctx, cfg.db, userID, []uuid.UUID{chirpID})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "couldn't load poll", err)
+		return
+	}
+	respondWithJSON(w, http.StatusCreated, views[chirpID])
+}
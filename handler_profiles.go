@@ -0,0 +1,337 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"local/mda/internal/accounts"
+	"local/mda/internal/auth"
+	"local/mda/internal/database"
+	"local/mda/internal/events"
+	"local/mda/internal/notifications"
+	"local/mda/internal/profiles"
+
+	"github.com/google/uuid"
+)
+
+// handlerGetProfile looks a user up by id or by handle ("alice" or "@alice").
+// "me" resolves to the authenticated user and includes their email.
+func (cfg *apiConfig) handlerGetProfile(w http.ResponseWriter, r *http.Request) {
+	key := profiles.ParseKey(r.PathValue("handleOrId"))
+
+	var (
+		user database.User
+		err  error
+	)
+	switch {
+	case key.Me:
+		userID, ok := cfg.authenticate(w, r)
+		if !ok {
+			return
+		}
+		user, err = cfg.db.GetUserById(r.Context(), userID)
+	case key.Handle != "":
+		user, err = cfg.db.GetUserByHandle(r.Context(), sql.NullString{String: key.Handle, Valid: true})
+	default:
+		user, err = cfg.db.GetUserById(r.Context(), key.ID)
+	}
+
+	if errors.Is(err, sql.ErrNoRows) || (err == nil && user.DeletedAt.Valid) {
+		respondWithError(w, http.StatusNotFound, "user not found", nil)
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "couldn't fetch user", err)
+		return
+	}
+
+	if key.Me {
+		respondWithJSON(w, http.StatusOK, accountFromUser(user))
+		return
+	}
+	respondWithJSON(w, http.StatusOK, profiles.FromUser(user))
+}
+
+type updateMeRequest struct {
+	profiles.Update
+	Email    *string `json:"email"`
+	Password *string `json:"password"`
+	// CurrentPassword is required when changing email or password.
+	CurrentPassword string `json:"current_password"`
+	// AllowStrangerDms controls whether users the caller has never written
+	// to can start a conversation with them.
+	AllowStrangerDms *bool `json:"allow_stranger_dms"`
+}
+
+// accountResponse is the caller's own view of their account.
+type accountResponse struct {
+	profiles.Profile
+	Email            string `json:"email"`
+	PendingEmail     string `json:"pending_email,omitempty"`
+	AllowStrangerDms bool   `json:"allow_stranger_dms"`
+}
+
+func accountFromUser(u database.User) accountResponse {
+	return accountResponse{
+		Profile:          profiles.FromUser(u),
+		Email:            u.Email,
+		AllowStrangerDms: u.AllowStrangerDms,
+	}
+}
+
+// handlerPatchMe updates only the fields present in the request body. A new
+// password takes effect immediately and revokes every refresh token of the
+// account, the caller's included, so clients must log in again once their
+// access token expires. A new email only takes effect once confirmed through
+// handlerConfirmEmailChange.
+func (cfg *apiConfig) handlerPatchMe(w http.ResponseWriter, r *http.Request) {
+	userID, ok := cfg.authenticate(w, r)
+	if !ok {
+		return
+	}
+
+	var body updateMeRequest
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		respondWithError(w, http.StatusBadRequest, "couldn't decode request body", err)
+		return
+	}
+	cfg.updateAccount(w, r, userID, body)
+}
+
+// updateAccount applies body to userID's account and responds with the
+// result.
+func (cfg *apiConfig) updateAccount(w http.ResponseWriter, r *http.Request, userID uuid.UUID, body updateMeRequest) {
+	ctx := r.Context()
+
+	errs := validateProfileUpdate(&body.Update)
+	if body.Email != nil {
+		email := strings.TrimSpace(*body.Email)
+		body.Email = &email
+		if !validEmail(email) {
+			errs = append(errs, validationError{
+				Field:   "email",
+				Code:    "invalid",
+				Message: "invalid email format",
+			})
+		}
+	}
+	if len(errs) > 0 {
+		respondWithValidationErrors(w, "invalid account update", errs)
+		return
+	}
+	if body.Password != nil && !cfg.checkPassword(w, *body.Password) {
+		return
+	}
+
+	user, err := cfg.db.GetUserById(ctx, userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		respondWithError(w, http.StatusNotFound, "user not found", nil)
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "couldn't fetch user", err)
+		return
+	}
+
+	creds := accounts.Credentials{
+		Email:           body.Email,
+		Password:        body.Password,
+		CurrentPassword: body.CurrentPassword,
+	}
+	creds.DropUnchangedEmail(user.Email)
+	body.Email = creds.Email
+
+	// sensitive changes need proof the caller knows the current password
+	switch err := creds.Authorize(cfg.passwordHasher, user.HashedPassword); {
+	case errors.Is(err, accounts.ErrCurrentPasswordRequired):
+		respondWithError(w, http.StatusBadRequest, err.Error(), nil)
+		return
+	case errors.Is(err, accounts.ErrWrongPassword):
+		respondWithError(w, http.StatusForbidden, err.Error(), nil)
+		return
+	}
+
+	if body.Email != nil {
+		_, err := cfg.db.GetUserByEmail(ctx, *body.Email)
+		if err == nil {
+			respondWithError(w, http.StatusConflict, "email already in use", nil)
+			return
+		}
+		if !errors.Is(err, sql.ErrNoRows) {
+			respondWithError(w, http.StatusInternalServerError, "couldn't check email", err)
+			return
+		}
+	}
+
+	tx, err := cfg.sqlDB.BeginTx(ctx, nil)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "couldn't start transaction", err)
+		return
+	}
+	defer tx.Rollback()
+	qtx := cfg.db.WithTx(tx)
+
+	p := body.Update
+	if !p.Empty() {
+		params := database.UpdateUserProfileParams{
+			ID:          user.ID,
+			Handle:      user.Handle,
+			DisplayName: user.DisplayName,
+			Bio:         user.Bio,
+			AvatarUrl:   user.AvatarUrl,
+		}
+		if p.Handle != nil {
+			params.Handle = sql.NullString{String: *p.Handle, Valid: *p.Handle != ""}
+		}
+		if p.DisplayName != nil {
+			params.DisplayName = *p.DisplayName
+		}
+		if p.Bio != nil {
+			params.Bio = *p.Bio
+		}
+		if p.AvatarUrl != nil {
+			params.AvatarUrl = *p.AvatarUrl
+		}
+
+		user, err = qtx.UpdateUserProfile(ctx, params)
+		if err != nil {
+			if isUniqueViolation(err) {
+				respondWithError(w, http.StatusConflict, "handle already taken", nil)
+				return
+			}
+			respondWithError(w, http.StatusInternalServerError, "couldn't update profile", err)
+			return
+		}
+	}
+
+	if body.Password != nil {
+		hashed, err := cfg.passwordHasher.Hash(*body.Password)
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "couldn't hash password", err)
+			return
+		}
+		err = qtx.UpdateUserPassword(ctx, database.UpdateUserPasswordParams{
+			ID:             user.ID,
+			HashedPassword: hashed,
+		})
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "couldn't update password", err)
+			return
+		}
+		if err := qtx.RevokeAllRefreshTokensForUser(ctx, user.ID); err != nil {
+			respondWithError(w, http.StatusInternalServerError, "couldn't revoke sessions", err)
+			return
+		}
+	}
+
+	if body.AllowStrangerDms != nil {
+		user, err = qtx.SetAllowStrangerDms(ctx, database.SetAllowStrangerDmsParams{
+			ID:               user.ID,
+			AllowStrangerDms: *body.AllowStrangerDms,
+		})
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "couldn't update messaging preference", err)
+			return
+		}
+	}
+
+	var confirmToken string
+	if body.Email != nil {
+		confirmToken, err = auth.MakeRefreshToken()
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "couldn't create confirmation token", err)
+			return
+		}
+		// only the latest requested address can be confirmed
+		if err := qtx.DeleteEmailChangesForUser(ctx, user.ID); err != nil {
+			respondWithError(w, http.StatusInternalServerError, "couldn't replace pending email change", err)
+			return
+		}
+		_, err = qtx.CreateEmailChange(ctx, database.CreateEmailChangeParams{
+			TokenHash: auth.HashToken(confirmToken),
+			UserID:    user.ID,
+			NewEmail:  *body.Email,
+			ExpiresAt: cfg.emailChangePolicy.ExpiresAt(time.Now().UTC()),
+		})
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "couldn't start email change", err)
+			return
+		}
+	}
+
+	var changed []string
+	if body.Password != nil {
+		changed = append(changed, "password")
+	}
+	if body.Email != nil {
+		changed = append(changed, "pending_email")
+	}
+	if len(changed) > 0 {
+		err := notifications.Notify(ctx, qtx, user.ID, notifications.AccountUpdated, map[string]any{
+			"changed": changed,
+		})
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "couldn't record notification", err)
+			return
+		}
+	}
+
+	// the email only changes once the new address is confirmed
+	var updated []string
+	for _, f := range []struct {
+		name string
+		set  bool
+	}{
+		{"handle", p.Handle != nil},
+		{"display_name", p.DisplayName != nil},
+		{"bio", p.Bio != nil},
+		{"avatar_url", p.AvatarUrl != nil},
+		{"password", body.Password != nil},
+		{"allow_stranger_dms", body.AllowStrangerDms != nil},
+	} {
+		if f.set {
+			updated = append(updated, f.name)
+		}
+	}
+	if len(updated) > 0 {
+		err := cfg.recordEvent(ctx, qtx, events.UserUpdated, user.ID, userEventPayload{
+			UserId:  user.ID,
+			Changed: updated,
+		})
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "couldn't record event", err)
+			return
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "couldn't update account", err)
+		return
+	}
+	cfg.eventDispatcher.Kick()
+
+	resp := accountFromUser(user)
+	if body.Email != nil {
+		cfg.sendEmailChangeMails(ctx, user.Email, *body.Email, confirmToken)
+		resp.PendingEmail = *body.Email
+	}
+	respondWithJSON(w, http.StatusOK, resp)
+}
+
+// validateProfileUpdate normalizes the fields in place and returns any
+// problems found. An empty handle clears it.
+func validateProfileUpdate(u *profiles.Update) []validationError {
+	var errs []validationError
+	for _, p := range u.Validate() {
+		errs = append(errs, validationError{
+			Field:   p.Field,
+			Code:    p.Code,
+			Message: p.Message,
+		})
+	}
+	return errs
+}
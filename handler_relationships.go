@@ -0,0 +1,139 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"local/mda/internal/database"
+	"local/mda/internal/profiles"
+	"local/mda/internal/relationships"
+
+	"github.com/google/uuid"
+)
+
+func (cfg *apiConfig) handlerListRelated(kind string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, ok := cfg.authenticate(w, r)
+		if !ok {
+			return
+		}
+
+		users, err := cfg.db.ListRelatedUsers(r.Context(), database.ListRelatedUsersParams{
+			UserID: userID,
+			Kind:   kind,
+		})
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "couldn't fetch users", err)
+			return
+		}
+		out := make([]profiles.Profile, 0, len(users))
+		for _, u := range users {
+			out = append(out, profiles.FromUser(u))
+		}
+		respondWithJSON(w, http.StatusOK, out)
+	}
+}
+
+// handlerAddRelated blocks or mutes a user. Repeating the request is a no-op.
+func (cfg *apiConfig) handlerAddRelated(kind string) http.HandlerFunc {
+	type relationRequest struct {
+		UserId uuid.UUID `json:"user_id"`
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, ok := cfg.authenticate(w, r)
+		if !ok {
+			return
+		}
+		var params relationRequest
+		if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+			respondWithError(w, http.StatusBadRequest, "Couldn't decode parameters", err)
+			return
+		}
+		if params.UserId == userID {
+			respondWithError(w, http.StatusBadRequest, "you can't "+kind+" yourself", nil)
+			return
+		}
+
+		target, err := cfg.db.GetUserById(r.Context(), params.UserId)
+		if errors.Is(err, sql.ErrNoRows) || (err == nil && target.DeletedAt.Valid) {
+			respondWithError(w, http.StatusNotFound, "user not found", nil)
+			return
+		}
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "couldn't fetch user", err)
+			return
+		}
+
+		err = cfg.db.CreateUserRelationship(r.Context(), database.CreateUserRelationshipParams{
+			UserID:   userID,
+			TargetID: target.ID,
+			Kind:     kind,
+		})
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "couldn't save "+kind, err)
+			return
+		}
+		respondWithJSON(w, http.StatusOK, profiles.FromUser(target))
+	}
+}
+
+func (cfg *apiConfig) handlerRemoveRelated(kind string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, ok := cfg.authenticate(w, r)
+		if !ok {
+			return
+		}
+		targetID, err := uuid.Parse(r.PathValue("userId"))
+		if err != nil {
+			respondWithError(w, http.StatusBadRequest, "invalid user id", err)
+			return
+		}
+
+		n, err := cfg.db.DeleteUserRelationship(r.Context(), database.DeleteUserRelationshipParams{
+			UserID:   userID,
+			TargetID: targetID,
+			Kind:     kind,
+		})
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "couldn't remove "+kind, err)
+			return
+		}
+		if n == 0 {
+			respondWithError(w, http.StatusNotFound, kind+" not found", nil)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// hiddenAuthors applies rule to viewerID's relationships. Anonymous viewers
+// have none, so nobody is hidden from them.
+func (cfg *apiConfig) hiddenAuthors(ctx context.Context, viewerID uuid.UUID, rule relationships.Rule) ([]uuid.UUID, error) {
+	if viewerID == uuid.Nil {
+		return nil, nil
+	}
+	rels, err := cfg.db.ListRelationshipsInvolving(ctx, viewerID)
+	if err != nil {
+		return nil, err
+	}
+	return rule(viewerID, rels), nil
+}
+
+// visibleChirp loads a chirp the way viewerID may open it by link. It
+// returns sql.ErrNoRows when the chirp doesn't exist, isn't published yet
+// or its author blocked viewerID.
+func (cfg *apiConfig) visibleChirp(ctx context.Context, chirpID, viewerID uuid.UUID) (database.Chirp, error) {
+	hidden, err := cfg.hiddenAuthors(ctx, viewerID, relationships.HiddenByLink)
+	if err != nil {
+		return database.Chirp{}, err
+	}
+	return cfg.db.GetChirpById(ctx, database.GetChirpByIdParams{
+		ID:              chirpID,
+		ViewerID:        viewerID,
+		HiddenAuthorIds: hidden,
+	})
+}
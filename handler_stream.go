@@ -0,0 +1,124 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"local/mda/internal/relationships"
+	"local/mda/internal/stream"
+
+	"github.com/google/uuid"
+)
+
+const streamHeartbeat = 25 * time.Second
+
+// streamFilter builds a stream filter from the author_id (repeatable or
+// comma separated) and q parameters. Authenticated viewers never see
+// authors they muted or blocked, or who blocked them.
+func (cfg *apiConfig) streamFilter(ctx context.Context, viewerID uuid.UUID, authorIDs []string, keyword string) (stream.Filter, error) {
+	f := stream.Filter{Keyword: strings.TrimSpace(keyword)}
+	for _, v := range authorIDs {
+		for _, part := range strings.Split(v, ",") {
+			if part = strings.TrimSpace(part); part == "" {
+				continue
+			}
+			id, err := uuid.Parse(part)
+			if err != nil {
+				return stream.Filter{}, fmt.Errorf("invalid author_id %q", part)
+			}
+			if f.Authors == nil {
+				f.Authors = make(map[uuid.UUID]bool)
+			}
+			f.Authors[id] = true
+		}
+	}
+
+	hidden, err := cfg.hiddenAuthors(ctx, viewerID, relationships.HiddenInFeeds)
+	if err != nil {
+		return stream.Filter{}, err
+	}
+	if len(hidden) > 0 {
+		f.Hidden = make(map[uuid.UUID]bool, len(hidden))
+		for _, id := range hidden {
+			f.Hidden[id] = true
+		}
+	}
+	return f, nil
+}
+
+// handlerStream pushes chirp.created and chirp.deleted events as Server-Sent
+// Events. Clients resume with the Last-Event-ID header (or last_event_id
+// parameter); a "reset" event means some events were missed and the client
+// should refetch. Slow clients are disconnected rather than buffered
+// without bound, and can resume the same way.
+func (cfg *apiConfig) handlerStream(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	filter, err := cfg.streamFilter(r.Context(), cfg.optionalUserID(r), q["author_id"], q.Get("q"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error(), nil)
+		return
+	}
+
+	lastEventID := r.Header.Get("Last-Event-ID")
+	if lastEventID == "" {
+		lastEventID = q.Get("last_event_id")
+	}
+	var lastID uint64
+	if lastEventID != "" {
+		lastID, err = strconv.ParseUint(lastEventID, 10, 64)
+		if err != nil {
+			respondWithError(w, http.StatusBadRequest, "invalid Last-Event-ID", err)
+			return
+		}
+	}
+
+	rc := http.NewResponseController(w)
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	sub, backlog, complete := cfg.streamHub.Subscribe(lastID)
+	defer cfg.streamHub.Unsubscribe(sub)
+
+	fmt.Fprint(w, "retry: 3000\n\n")
+	if !complete {
+		fmt.Fprint(w, "event: reset\ndata: {}\n\n")
+	}
+	for _, msg := range backlog {
+		writeStreamMessage(w, filter, msg)
+	}
+	if err := rc.Flush(); err != nil {
+		return
+	}
+
+	heartbeat := time.NewTicker(streamHeartbeat)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-heartbeat.C:
+			fmt.Fprint(w, ": ping\n\n")
+		case msg, ok := <-sub.C:
+			if !ok {
+				return
+			}
+			writeStreamMessage(w, filter, msg)
+		}
+		if err := rc.Flush(); err != nil {
+			return
+		}
+	}
+}
+
+func writeStreamMessage(w http.ResponseWriter, filter stream.Filter, msg stream.Message) {
+	if !filter.Match(msg.Event) {
+		return
+	}
+	fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", msg.ID, msg.Event.Type, msg.Event.Payload)
+}
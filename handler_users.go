@@ -1,17 +1,17 @@
 package main
 
 import (
-	"context"
 	"encoding/json"
+	"errors"
 	"net/http"
-	"regexp"
 	"time"
 
-	"local/mda/internal/auth"
 	"local/mda/internal/database"
+	"local/mda/internal/events"
+	"local/mda/internal/notifications"
 
 	"github.com/google/uuid"
-	"golang.org/x/crypto/bcrypt"
+	"github.com/lib/pq"
 )
 
 type User struct {
@@ -40,12 +40,26 @@ func (cfg *apiConfig) handlerCreateUser(w http.ResponseWriter, r *http.Request)
 		return
 	}
 	email := params.Email
-	hashedPassword, err := auth.HashPassword(params.Password)
+	if !cfg.checkPassword(w, params.Password) {
+		return
+	}
+
+	hashedPassword, err := cfg.passwordHasher.Hash(params.Password)
 	if err != nil {
 		respondWithError(w, http.StatusInternalServerError, "There was a problem with your password", err)
+		return
+	}
+
+	ctx := r.Context()
+	tx, err := cfg.sqlDB.BeginTx(ctx, nil)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "couldn't start transaction", err)
+		return
 	}
+	defer tx.Rollback()
+	qtx := cfg.db.WithTx(tx)
 
-	user, err := cfg.db.CreateUser(context.Background(), database.CreateUserParams{
+	user, err := qtx.CreateUser(ctx, database.CreateUserParams{
 		Email: email,
 		HashedPassword: hashedPassword,
 	})
@@ -53,6 +67,15 @@ func (cfg *apiConfig) handlerCreateUser(w http.ResponseWriter, r *http.Request)
 		respondWithError(w, http.StatusInternalServerError, "Internal Error creating user", err)
 		return
 	}
+	if err := cfg.recordEvent(ctx, qtx, events.UserCreated, user.ID, userEventPayload{UserId: user.ID}); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "couldn't record event", err)
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Internal Error creating user", err)
+		return
+	}
+	cfg.eventDispatcher.Kick()
 
 	respondWithJSON(w, http.StatusCreated, User{
 		Id: user.ID,
@@ -75,17 +98,17 @@ type userResponse struct {
 	Email     string    `json:"email"`
 }
 
+// handlerUpdateUser is the original whole-account update. It keeps its
+// contract for existing clients: both fields are required and the email
+// changes immediately. It is deprecated in favour of PATCH /api/users/me,
+// which asks for the current password and confirms new addresses.
 func (cfg *apiConfig) handlerUpdateUser(w http.ResponseWriter, r *http.Request) {
-	// 1) Require access token
-	bearer, err := auth.GetBearerToken(r.Header)
-	if err != nil || bearer == "" {
-		respondWithError(w, http.StatusUnauthorized, "missing or invalid authorization header", nil)
-		return
-	}
+	w.Header().Set("Deprecation", "true")
+	w.Header().Set("Link", `</api/users/me>; rel="successor-version"`)
 
-	userID, err := auth.ValidateJWT(bearer, cfg.authSecret) // returns uuid.UUID if valid
-	if err != nil {
-		respondWithError(w, http.StatusUnauthorized, "invalid or expired token", nil)
+	// 1) Require access token
+	userID, ok := cfg.authenticate(w, r)
+	if !ok {
 		return
 	}
 
@@ -100,31 +123,37 @@ func (cfg *apiConfig) handlerUpdateUser(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	// Minimal email check
-	var emailRe = regexp.MustCompile(`^[^\s@]+@[^\s@]+\.[^\s@]+$`)
-	if !emailRe.MatchString(body.Email) {
+	if !validEmail(body.Email) {
 		respondWithError(w, http.StatusBadRequest, "invalid email format", nil)
 		return
 	}
-	if len(body.Password) < 8 {
-		respondWithError(w, http.StatusBadRequest, "password must be at least 8 characters", nil)
+	if !cfg.checkPassword(w, body.Password) {
 		return
 	}
 
 	// 3) Hash new password
-	hashed, err := bcrypt.GenerateFromPassword([]byte(body.Password), bcrypt.DefaultCost)
+	hashed, err := cfg.passwordHasher.Hash(body.Password)
 	if err != nil {
 		respondWithError(w, http.StatusInternalServerError, "couldn't hash password", err)
 		return
 	}
 
-	// 4) Update DB (only the authenticated user)
-	u, err := cfg.db.UpdateUserEmailAndPassword(
-		context.Background(),
+	// 4) Update DB (only the authenticated user), with a security notice
+	ctx := r.Context()
+	tx, err := cfg.sqlDB.BeginTx(ctx, nil)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "couldn't start transaction", err)
+		return
+	}
+	defer tx.Rollback()
+	qtx := cfg.db.WithTx(tx)
+
+	u, err := qtx.UpdateUserEmailAndPassword(
+		ctx,
 		database.UpdateUserEmailAndPasswordParams{
 			ID:             userID,
 			Email:          body.Email,
-			HashedPassword: string(hashed),
+			HashedPassword: hashed,
 		},
 	)
 	if err != nil {
@@ -135,6 +164,32 @@ func (cfg *apiConfig) handlerUpdateUser(w http.ResponseWriter, r *http.Request)
 		respondWithError(w, http.StatusInternalServerError, "couldn't update user", err)
 		return
 	}
+	// the address was set directly, so an older pending change must not
+	// overwrite it when confirmed
+	if err := qtx.DeleteEmailChangesForUser(ctx, u.ID); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "couldn't clear pending email change", err)
+		return
+	}
+	err = notifications.Notify(ctx, qtx, u.ID, notifications.AccountUpdated, map[string]any{
+		"changed": []string{"email", "password"},
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "couldn't record notification", err)
+		return
+	}
+	err = cfg.recordEvent(ctx, qtx, events.UserUpdated, u.ID, userEventPayload{
+		UserId:  u.ID,
+		Changed: []string{"email", "password"},
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "couldn't record event", err)
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "couldn't update user", err)
+		return
+	}
+	cfg.eventDispatcher.Kick()
 
 	// 5) Respond (omit password)
 	respondWithJSON(w, http.StatusOK, userResponse{
@@ -145,8 +200,14 @@ func (cfg *apiConfig) handlerUpdateUser(w http.ResponseWriter, r *http.Request)
 	})
 }
 
-// Driver-specific helpers (implement for your driver)
+// isUniqueViolation reports whether err is a Postgres unique_violation.
 func isUniqueViolation(err error) bool {
-	// e.g., for lib/pq: pqErr.Code == "23505"
-	return false
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == "23505"
+}
+
+// isForeignKeyViolation reports whether err is a Postgres foreign_key_violation.
+func isForeignKeyViolation(err error) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == "23503"
 }
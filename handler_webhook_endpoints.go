@@ -0,0 +1,409 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"slices"
+	"time"
+
+	"local/mda/internal/database"
+	"local/mda/internal/entitlements"
+	"local/mda/internal/events"
+	"local/mda/internal/paging"
+	"local/mda/internal/webhooks"
+
+	"github.com/google/uuid"
+)
+
+const (
+	maxWebhookURLLength     = 2048
+	defaultDeliveryPageSize = 50
+)
+
+// webhookEventTypes are the events endpoints can subscribe to. Each is
+// delivered to the endpoints of the user it concerns.
+var webhookEventTypes = []string{events.ChirpCreated, events.ChirpDeleted, events.UserUpgraded, events.UserDowngraded}
+
+type WebhookEndpoint struct {
+	Id         uuid.UUID `json:"id"`
+	CreatedAt  time.Time `json:"created_at"`
+	UpdatedAt  time.Time `json:"updated_at"`
+	Url        string    `json:"url"`
+	EventTypes []string  `json:"event_types"`
+	Active     bool      `json:"active"`
+	// Secret is only returned when the endpoint is created.
+	Secret string `json:"secret,omitempty"`
+}
+
+type WebhookDelivery struct {
+	Id             uuid.UUID       `json:"id"`
+	EventId        uuid.UUID       `json:"event_id"`
+	EventType      string          `json:"event_type"`
+	Status         string          `json:"status"`
+	Attempts       int32           `json:"attempts"`
+	NextAttemptAt  *time.Time      `json:"next_attempt_at"`
+	LastAttemptAt  *time.Time      `json:"last_attempt_at"`
+	ResponseStatus *int32          `json:"response_status"`
+	LastError      *string         `json:"last_error"`
+	CreatedAt      time.Time       `json:"created_at"`
+	Payload        json.RawMessage `json:"payload"`
+}
+
+func endpointFromRow(e database.WebhookEndpoint) WebhookEndpoint {
+	return WebhookEndpoint{
+		Id:         e.ID,
+		CreatedAt:  e.CreatedAt,
+		UpdatedAt:  e.UpdatedAt,
+		Url:        e.Url,
+		EventTypes: e.EventTypes,
+		Active:     e.Active,
+	}
+}
+
+func deliveryFromRow(d database.WebhookDelivery) WebhookDelivery {
+	out := WebhookDelivery{
+		Id:        d.ID,
+		EventId:   d.EventID,
+		EventType: d.EventType,
+		Status:    d.Status,
+		Attempts:  d.Attempts,
+		CreatedAt: d.CreatedAt,
+		Payload:   d.Payload,
+	}
+	if d.Status == deliveryPending {
+		t := d.NextAttemptAt
+		out.NextAttemptAt = &t
+	}
+	if d.LastAttemptAt.Valid {
+		t := d.LastAttemptAt.Time
+		out.LastAttemptAt = &t
+	}
+	if d.ResponseStatus.Valid {
+		s := d.ResponseStatus.Int32
+		out.ResponseStatus = &s
+	}
+	if d.LastError.Valid {
+		s := d.LastError.String
+		out.LastError = &s
+	}
+	return out
+}
+
+type webhookEndpointRequest struct {
+	Url        string   `json:"url"`
+	EventTypes []string `json:"event_types"`
+	Active     *bool    `json:"active"`
+}
+
+// decodeWebhookEndpoint reads and validates an endpoint. Plain http is only
+// accepted on the dev platform.
+func (cfg *apiConfig) decodeWebhookEndpoint(w http.ResponseWriter, r *http.Request) (webhookEndpointRequest, bool) {
+	var params webhookEndpointRequest
+	if err := json.NewDecoder(r.Body).Decode(&params); err != nil {
+		respondWithError(w, http.StatusBadRequest, "Couldn't decode parameters", err)
+		return params, false
+	}
+
+	var errs []validationError
+	u, err := url.Parse(params.Url)
+	switch {
+	case err != nil || u.Host == "" || (u.Scheme != "https" && u.Scheme != "http"):
+		errs = append(errs, validationError{Field: "url", Code: "invalid", Message: "url must be an absolute http(s) URL"})
+	case u.Scheme == "http" && cfg.platform != "dev":
+		errs = append(errs, validationError{Field: "url", Code: "insecure", Message: "url must use https"})
+	case len(params.Url) > maxWebhookURLLength:
+		errs = append(errs, validationError{Field: "url", Code: "length", Message: "url must be at most 2048 characters"})
+	}
+
+	var types []string
+	for _, t := range params.EventTypes {
+		if !slices.Contains(webhookEventTypes, t) {
+			errs = append(errs, validationError{Field: "event_types", Code: "unknown", Message: "unknown event type " + t})
+			continue
+		}
+		if !slices.Contains(types, t) {
+			types = append(types, t)
+		}
+	}
+	if len(params.EventTypes) == 0 {
+		errs = append(errs, validationError{Field: "event_types", Code: "required", Message: "at least one event type is required"})
+	}
+	if len(errs) > 0 {
+		respondWithValidationErrors(w, "invalid webhook endpoint", errs)
+		return params, false
+	}
+	params.EventTypes = types
+	return params, true
+}
+
+func pathUUID(w http.ResponseWriter, r *http.Request, name, what string) (uuid.UUID, bool) {
+	id, err := uuid.Parse(r.PathValue(name))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "invalid "+what+" id", err)
+		return uuid.Nil, false
+	}
+	return id, true
+}
+
+func (cfg *apiConfig) handlerGetWebhookEndpoints(w http.ResponseWriter, r *http.Request) {
+	userID, ok := cfg.authenticate(w, r)
+	if !ok {
+		return
+	}
+	rows, err := cfg.db.ListWebhookEndpoints(r.Context(), userID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "couldn't fetch webhook endpoints", err)
+		return
+	}
+	out := make([]WebhookEndpoint, 0, len(rows))
+	for _, e := range rows {
+		out = append(out, endpointFromRow(e))
+	}
+	respondWithJSON(w, http.StatusOK, out)
+}
+
+// handlerCreateWebhookEndpoint registers an endpoint and returns its signing
+// secret, which is not shown again.
+func (cfg *apiConfig) handlerCreateWebhookEndpoint(w http.ResponseWriter, r *http.Request) {
+	userID, ok := cfg.authenticate(w, r)
+	if !ok {
+		return
+	}
+	params, ok := cfg.decodeWebhookEndpoint(w, r)
+	if !ok {
+		return
+	}
+
+	ctx := r.Context()
+	plan, err := cfg.userPlan(ctx, cfg.db, userID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "couldn't load plan", err)
+		return
+	}
+	if !plan.Can(entitlements.OutboundWebhooks) {
+		respondWithError(w, http.StatusForbidden, "webhook endpoints require Chirpy Red", nil)
+		return
+	}
+	count, err := cfg.db.CountWebhookEndpoints(ctx, userID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "couldn't count webhook endpoints", err)
+		return
+	}
+	if limit := plan.Limits.MaxWebhookEndpoints; limit > 0 && count >= int64(limit) {
+		respondWithError(w, http.StatusConflict, "webhook endpoint limit reached", nil)
+		return
+	}
+
+	secret, err := webhooks.NewSecret()
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "couldn't generate secret", err)
+		return
+	}
+	e, err := cfg.db.CreateWebhookEndpoint(ctx, database.CreateWebhookEndpointParams{
+		UserID:     userID,
+		Url:        params.Url,
+		Secret:     secret,
+		EventTypes: params.EventTypes,
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "couldn't create webhook endpoint", err)
+		return
+	}
+	out := endpointFromRow(e)
+	out.Secret = e.Secret
+	respondWithJSON(w, http.StatusCreated, out)
+}
+
+func (cfg *apiConfig) handlerGetWebhookEndpoint(w http.ResponseWriter, r *http.Request) {
+	userID, ok := cfg.authenticate(w, r)
+	if !ok {
+		return
+	}
+	id, ok := pathUUID(w, r, "endpointId", "endpoint")
+	if !ok {
+		return
+	}
+	e, err := cfg.db.GetWebhookEndpoint(r.Context(), database.GetWebhookEndpointParams{ID: id, UserID: userID})
+	if errors.Is(err, sql.ErrNoRows) {
+		respondWithError(w, http.StatusNotFound, "webhook endpoint not found", nil)
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "couldn't fetch webhook endpoint", err)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, endpointFromRow(e))
+}
+
+// handlerUpdateWebhookEndpoint replaces an endpoint's URL and event types;
+// active defaults to true and needs a plan with outbound webhooks.
+// Deliveries already queued are unaffected.
+func (cfg *apiConfig) handlerUpdateWebhookEndpoint(w http.ResponseWriter, r *http.Request) {
+	userID, ok := cfg.authenticate(w, r)
+	if !ok {
+		return
+	}
+	id, ok := pathUUID(w, r, "endpointId", "endpoint")
+	if !ok {
+		return
+	}
+	params, ok := cfg.decodeWebhookEndpoint(w, r)
+	if !ok {
+		return
+	}
+	active := true
+	if params.Active != nil {
+		active = *params.Active
+	}
+
+	ctx := r.Context()
+	if active {
+		// a downgraded user can still edit or pause endpoints, but not
+		// switch them back on
+		plan, err := cfg.userPlan(ctx, cfg.db, userID)
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "couldn't load plan", err)
+			return
+		}
+		if !plan.Can(entitlements.OutboundWebhooks) {
+			respondWithError(w, http.StatusForbidden, "webhook endpoints require Chirpy Red", nil)
+			return
+		}
+	}
+
+	e, err := cfg.db.UpdateWebhookEndpoint(ctx, database.UpdateWebhookEndpointParams{
+		ID:         id,
+		UserID:     userID,
+		Url:        params.Url,
+		EventTypes: params.EventTypes,
+		Active:     active,
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		respondWithError(w, http.StatusNotFound, "webhook endpoint not found", nil)
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "couldn't update webhook endpoint", err)
+		return
+	}
+	respondWithJSON(w, http.StatusOK, endpointFromRow(e))
+}
+
+// handlerDeleteWebhookEndpoint removes an endpoint along with its delivery
+// log.
+func (cfg *apiConfig) handlerDeleteWebhookEndpoint(w http.ResponseWriter, r *http.Request) {
+	userID, ok := cfg.authenticate(w, r)
+	if !ok {
+		return
+	}
+	id, ok := pathUUID(w, r, "endpointId", "endpoint")
+	if !ok {
+		return
+	}
+	n, err := cfg.db.DeleteWebhookEndpoint(r.Context(), database.DeleteWebhookEndpointParams{ID: id, UserID: userID})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "couldn't delete webhook endpoint", err)
+		return
+	}
+	if n == 0 {
+		respondWithError(w, http.StatusNotFound, "webhook endpoint not found", nil)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handlerGetWebhookDeliveries pages through an endpoint's delivery log with
+// the shared sort/limit/offset parameters, newest first by default;
+// status=pending|succeeded|failed narrows it.
+func (cfg *apiConfig) handlerGetWebhookDeliveries(w http.ResponseWriter, r *http.Request) {
+	userID, ok := cfg.authenticate(w, r)
+	if !ok {
+		return
+	}
+	id, ok := pathUUID(w, r, "endpointId", "endpoint")
+	if !ok {
+		return
+	}
+	page, err := paging.Parse(r.URL.Query())
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error(), nil)
+		return
+	}
+	if page.Limit == 0 {
+		page.Limit = defaultDeliveryPageSize
+	}
+	if r.URL.Query().Get("sort") == "" {
+		page.Desc = true
+	}
+	status := r.URL.Query().Get("status")
+	if status != "" && status != deliveryPending && status != deliverySucceeded && status != deliveryFailed {
+		respondWithError(w, http.StatusBadRequest, "status must be pending, succeeded or failed", nil)
+		return
+	}
+
+	ctx := r.Context()
+	if _, err := cfg.db.GetWebhookEndpoint(ctx, database.GetWebhookEndpointParams{ID: id, UserID: userID}); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			respondWithError(w, http.StatusNotFound, "webhook endpoint not found", nil)
+			return
+		}
+		respondWithError(w, http.StatusInternalServerError, "couldn't fetch webhook endpoint", err)
+		return
+	}
+	rows, err := cfg.db.ListWebhookDeliveries(ctx, database.ListWebhookDeliveriesParams{
+		EndpointID:  id,
+		Status:      status,
+		NewestFirst: page.Desc,
+		PageLimit:   int32(page.Limit),
+		PageOffset:  int32(page.Offset),
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "couldn't fetch deliveries", err)
+		return
+	}
+	out := make([]WebhookDelivery, 0, len(rows))
+	for _, d := range rows {
+		out = append(out, deliveryFromRow(d))
+	}
+	respondWithJSON(w, http.StatusOK, out)
+}
+
+// handlerRetryWebhookDelivery puts a failed delivery back in the queue with a
+// fresh retry budget.
+func (cfg *apiConfig) handlerRetryWebhookDelivery(w http.ResponseWriter, r *http.Request) {
+	userID, ok := cfg.authenticate(w, r)
+	if !ok {
+		return
+	}
+	endpointID, ok := pathUUID(w, r, "endpointId", "endpoint")
+	if !ok {
+		return
+	}
+	deliveryID, ok := pathUUID(w, r, "deliveryId", "delivery")
+	if !ok {
+		return
+	}
+
+	ctx := r.Context()
+	if _, err := cfg.db.GetWebhookEndpoint(ctx, database.GetWebhookEndpointParams{ID: endpointID, UserID: userID}); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			respondWithError(w, http.StatusNotFound, "webhook endpoint not found", nil)
+			return
+		}
+		respondWithError(w, http.StatusInternalServerError, "couldn't fetch webhook endpoint", err)
+		return
+	}
+	d, err := cfg.db.RetryWebhookDelivery(ctx, database.RetryWebhookDeliveryParams{ID: deliveryID, EndpointID: endpointID})
+	if errors.Is(err, sql.ErrNoRows) {
+		respondWithError(w, http.StatusNotFound, "no failed delivery with that id", nil)
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "couldn't retry delivery", err)
+		return
+	}
+	respondWithJSON(w, http.StatusAccepted, deliveryFromRow(d))
+}
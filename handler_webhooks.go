@@ -3,52 +3,134 @@ package main
 import (
 	"context"
 	"database/sql"
-	"encoding/json"
-	"local/mda/internal/auth"
+	"errors"
+	"io"
+	"local/mda/internal/database"
+	"local/mda/internal/webhooks"
+	"log"
 	"net/http"
+	"time"
+)
 
-	"github.com/google/uuid"
+const (
+	// signed deliveries older (or newer) than this are rejected as replays
+	webhookReplayWindow = 5 * time.Minute
+	// receipts outlive the replay window so a retry that was signed again
+	// later is still recognized
+	webhookReceiptRetention = 30 * 24 * time.Hour
+	maxWebhookBodySize      = 1 << 20
 )
 
+// handlerPolkaWebhook keeps Polka's original URL working.
 func (cfg *apiConfig) handlerPolkaWebhook(w http.ResponseWriter, r *http.Request) {
-	type requestWebhook struct {
-		Event string `json:"event"`
-		Data  struct {
-			UserId uuid.UUID `json:"user_id"`
-		} `json:"data"`
+	cfg.receiveProviderWebhook(w, r, "polka")
+}
+
+func (cfg *apiConfig) handlerProviderWebhook(w http.ResponseWriter, r *http.Request) {
+	cfg.receiveProviderWebhook(w, r, r.PathValue("provider"))
+}
+
+// receiveProviderWebhook applies a payment provider's billing event to the
+// user's subscription. Events the provider doesn't map are acknowledged and
+// ignored.
+func (cfg *apiConfig) receiveProviderWebhook(w http.ResponseWriter, r *http.Request, name string) {
+	provider, ok := cfg.paymentProviders.Lookup(name)
+	if !ok {
+		respondWithError(w, http.StatusNotFound, "unknown webhook provider", nil)
+		return
 	}
 
-	ctx := context.Background()
+	ctx := r.Context()
 
-	// 1. Validate API key
-	apiKey, err := auth.GetAPIKey(r.Header)
-	if err != nil || apiKey != cfg.polkaKey { 
+	// 1. Authenticate; signatures cover the exact bytes sent
+	raw, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxWebhookBodySize))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "couldn't read request body", err)
+		return
+	}
+	err = provider.Verify(r.Header, raw, time.Now())
+	switch {
+	case errors.Is(err, webhooks.ErrInvalidAPIKey):
 		respondWithError(w, http.StatusUnauthorized, "invalid API key", nil)
 		return
+	case errors.Is(err, webhooks.ErrSignatureExpired):
+		respondWithError(w, http.StatusUnauthorized, "signature timestamp outside the replay window", nil)
+		return
+	case errors.Is(err, webhooks.ErrMissingDeliveryID):
+		respondWithError(w, http.StatusBadRequest, "missing delivery ID", nil)
+		return
+	case err != nil:
+		respondWithError(w, http.StatusUnauthorized, "invalid signature", nil)
+		return
 	}
 
-	// 2) Parse body (both fields required)
-	var body requestWebhook
-	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+	// 2) Parse body into a billing event
+	event, err := provider.Parse(r.Header, raw)
+	if errors.Is(err, webhooks.ErrIgnoredEvent) {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	if err != nil {
 		respondWithError(w, http.StatusBadRequest, "couldn't decode request body", err)
 		return
 	}
 
-	if body.Event != "user.upgraded" {
-		respondWithJSON(w, http.StatusNoContent, nil)
+	tx, err := cfg.sqlDB.BeginTx(ctx, nil)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "couldn't start transaction", err)
 		return
-	}	
+	}
+	defer tx.Rollback()
+	qtx := cfg.db.WithTx(tx)
+
+	// 3) Acknowledge retries without reprocessing; the receipt commits with
+	// the subscription change, so a failed attempt can still be retried
+	if event.DeliveryID != "" {
+		n, err := qtx.RecordWebhookReceipt(ctx, database.RecordWebhookReceiptParams{
+			Provider:   name,
+			DeliveryID: event.DeliveryID,
+			Event:      event.Type,
+		})
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "couldn't record delivery", err)
+			return
+		}
+		if n == 0 {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+	}
 
-	_, err = cfg.db.SetUserToChirpyRed(ctx, body.Data.UserId)
+	err = cfg.applySubscriptionEvent(ctx, qtx, event.UserID, event.Type, event.CurrentPeriodEnd, event.OccurredAt)
 	switch {
-	case err == sql.ErrNoRows:
+	case errors.Is(err, sql.ErrNoRows):
 		respondWithError(w, http.StatusNotFound, "user not found", nil)
 		return
 	case err != nil:
-		respondWithError(w, http.StatusInternalServerError, "failed to update user", err)
+		respondWithError(w, http.StatusInternalServerError, "failed to update subscription", err)
 		return
-	default:
-		w.WriteHeader(http.StatusNoContent) // success, empty body
+	}
+	if err := tx.Commit(); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "failed to update subscription", err)
 		return
 	}
-}
\ No newline at end of file
+	cfg.eventDispatcher.Kick()
+	w.WriteHeader(http.StatusNoContent) // success, empty body
+}
+
+func (cfg *apiConfig) runWebhookReceiptPruner(ctx context.Context, every time.Duration) {
+	ticker := time.NewTicker(every)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			cutoff := time.Now().UTC().Add(-webhookReceiptRetention)
+			if _, err := cfg.db.PruneWebhookReceipts(ctx, cutoff); err != nil {
+				log.Printf("pruning webhook receipts: %s", err)
+			}
+		}
+	}
+}
@@ -0,0 +1,476 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"math"
+	"net/http"
+	"sync"
+	"time"
+
+	"local/mda/internal/auth"
+	"local/mda/internal/polls"
+	"local/mda/internal/stream"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/websocket"
+)
+
+const (
+	wsWriteWait        = 10 * time.Second
+	wsPongWait         = 60 * time.Second
+	wsPingPeriod       = 30 * time.Second
+	wsMaxMessageSize   = 64 << 10
+	wsSendBuffer       = 64
+	wsMaxSubscriptions = 16
+)
+
+var wsUpgrader = websocket.Upgrader{
+	ReadBufferSize:  1024,
+	WriteBufferSize: 1024,
+	// Credentials travel in the Authorization header or in-band, never in
+	// cookies, so a cross-origin page gains nothing by opening a socket.
+	CheckOrigin: func(r *http.Request) bool { return true },
+}
+
+// wsClientMessage is any frame a client sends; Type selects which of the
+// other fields apply. ID is echoed in the reply so clients can correlate.
+type wsClientMessage struct {
+	Type string `json:"type"`
+	ID   string `json:"id,omitempty"`
+
+	// auth
+	Token string `json:"token,omitempty"`
+	// subscribe, unsubscribe
+	Subscription string   `json:"subscription,omitempty"`
+	AuthorIDs    []string `json:"author_ids,omitempty"`
+	Q            string   `json:"q,omitempty"`
+	// create_chirp
+	Body      string         `json:"body,omitempty"`
+	PublishAt *time.Time     `json:"publish_at,omitempty"`
+	Poll      *polls.Request `json:"poll,omitempty"`
+	// delete_chirp
+	ChirpID uuid.UUID `json:"chirp_id,omitempty"`
+}
+
+type wsServerMessage struct {
+	Type         string            `json:"type"`
+	ID           string            `json:"id,omitempty"`
+	Subscription string            `json:"subscription,omitempty"`
+	EventID      uint64            `json:"event_id,omitempty"`
+	Event        string            `json:"event,omitempty"`
+	Data         any               `json:"data,omitempty"`
+	ExpiresAt    *time.Time        `json:"expires_at,omitempty"`
+	Status       int               `json:"status,omitempty"`
+	Error        string            `json:"error,omitempty"`
+	Errors       []validationError `json:"errors,omitempty"`
+	RetryAfter   int               `json:"retry_after,omitempty"`
+}
+
+type wsSubscription struct {
+	authorIDs []string
+	keyword   string
+	filter    stream.Filter
+}
+
+// wsConn is one gateway connection. The read loop runs on the handler's
+// goroutine, writes go through send to a single writer, and hub events are
+// matched against the connection's subscriptions on a third goroutine.
+type wsConn struct {
+	cfg  *apiConfig
+	conn *websocket.Conn
+	send chan wsServerMessage
+	done chan struct{}
+	once sync.Once
+
+	mu        sync.Mutex
+	userID    uuid.UUID
+	expiresAt time.Time
+	expiry    *time.Timer
+	subs      map[string]*wsSubscription
+}
+
+// handlerWebSocket upgrades to the WebSocket gateway at /api/ws. Clients
+// authenticate with the usual Bearer header or with an in-band
+// {"type":"auth"} message, which they repeat with a fresh token before the
+// current one expires. Chirp events are delivered per named subscription;
+// create_chirp and delete_chirp run the same logic as the HTTP endpoints.
+// Clients that can't keep up are disconnected.
+func (cfg *apiConfig) handlerWebSocket(w http.ResponseWriter, r *http.Request) {
+	var userID uuid.UUID
+	var expiresAt time.Time
+	if bearer, err := auth.GetBearerToken(r.Header); err == nil {
+		userID, expiresAt, err = auth.ParseJWT(bearer, cfg.authSecret)
+		if err != nil {
+			respondWithError(w, http.StatusUnauthorized, "invalid or expired token", nil)
+			return
+		}
+		if err := cfg.checkActive(r.Context(), userID); err != nil {
+			respondWithAPIError(w, err)
+			return
+		}
+	}
+
+	conn, err := wsUpgrader.Upgrade(w, r, nil)
+	if err != nil {
+		// the upgrader has already written the error response
+		return
+	}
+	c := &wsConn{
+		cfg:  cfg,
+		conn: conn,
+		send: make(chan wsServerMessage, wsSendBuffer),
+		done: make(chan struct{}),
+		subs: make(map[string]*wsSubscription),
+	}
+	defer c.close(websocket.CloseNormalClosure, "")
+	if userID != uuid.Nil {
+		c.setAuth(userID, expiresAt)
+	}
+
+	sub, _, _ := cfg.streamHub.Subscribe(0)
+	defer cfg.streamHub.Unsubscribe(sub)
+
+	go c.writeLoop()
+	go c.eventLoop(sub)
+	c.readLoop(r.Context())
+}
+
+func (c *wsConn) readLoop(ctx context.Context) {
+	c.conn.SetReadLimit(wsMaxMessageSize)
+	c.conn.SetReadDeadline(time.Now().Add(wsPongWait))
+	c.conn.SetPongHandler(func(string) error {
+		return c.conn.SetReadDeadline(time.Now().Add(wsPongWait))
+	})
+
+	for {
+		_, data, err := c.conn.ReadMessage()
+		if err != nil {
+			return
+		}
+		var msg wsClientMessage
+		if err := json.Unmarshal(data, &msg); err != nil {
+			c.reply(wsServerMessage{Type: "error", Status: http.StatusBadRequest, Error: "couldn't decode message"})
+			continue
+		}
+		c.handle(ctx, msg)
+	}
+}
+
+func (c *wsConn) handle(ctx context.Context, msg wsClientMessage) {
+	switch msg.Type {
+	case "ping":
+		c.reply(wsServerMessage{Type: "pong", ID: msg.ID})
+	case "auth":
+		c.handleAuth(ctx, msg)
+	case "subscribe":
+		c.handleSubscribe(ctx, msg)
+	case "unsubscribe":
+		c.mu.Lock()
+		delete(c.subs, msg.Subscription)
+		c.mu.Unlock()
+		c.reply(wsServerMessage{Type: "unsubscribed", ID: msg.ID, Subscription: msg.Subscription})
+	case "create_chirp":
+		c.handleCreateChirp(ctx, msg)
+	case "delete_chirp":
+		c.handleDeleteChirp(ctx, msg)
+	default:
+		c.replyError(msg.ID, &apiError{Status: http.StatusBadRequest, Message: "unknown message type"})
+	}
+}
+
+func (c *wsConn) handleAuth(ctx context.Context, msg wsClientMessage) {
+	userID, expiresAt, err := auth.ParseJWT(msg.Token, c.cfg.authSecret)
+	if err != nil {
+		c.replyError(msg.ID, &apiError{Status: http.StatusUnauthorized, Message: "invalid or expired token"})
+		return
+	}
+	if err := c.cfg.checkActive(ctx, userID); err != nil {
+		c.replyError(msg.ID, err)
+		return
+	}
+	c.mu.Lock()
+	previous := c.userID
+	c.mu.Unlock()
+	if previous != uuid.Nil && previous != userID {
+		c.replyError(msg.ID, &apiError{Status: http.StatusForbidden, Message: "token belongs to a different user"})
+		return
+	}
+
+	c.setAuth(userID, expiresAt)
+	if previous == uuid.Nil {
+		// subscriptions made anonymously now hide blocked and muted authors
+		if err := c.refreshFilters(ctx); err != nil {
+			c.replyError(msg.ID, &apiError{Status: http.StatusInternalServerError, Message: "couldn't load subscriptions", Err: err})
+			return
+		}
+	}
+	reply := wsServerMessage{Type: "auth_ok", ID: msg.ID, Data: map[string]uuid.UUID{"user_id": userID}}
+	if !expiresAt.IsZero() {
+		reply.ExpiresAt = &expiresAt
+	}
+	c.reply(reply)
+}
+
+// setAuth records the authenticated user and arms a timer that tells the
+// client when the token lapses. Subscriptions keep running after that;
+// only commands need a current token.
+func (c *wsConn) setAuth(userID uuid.UUID, expiresAt time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.userID = userID
+	c.expiresAt = expiresAt
+	if c.expiry != nil {
+		c.expiry.Stop()
+		c.expiry = nil
+	}
+	if expiresAt.IsZero() {
+		return
+	}
+	c.expiry = time.AfterFunc(time.Until(expiresAt), func() {
+		c.mu.Lock()
+		current := c.expiresAt.Equal(expiresAt)
+		c.mu.Unlock()
+		if current {
+			c.reply(wsServerMessage{Type: "auth_expired"})
+		}
+	})
+}
+
+// currentUser returns the authenticated user, or an error if there is none
+// or the token has expired.
+func (c *wsConn) currentUser(ctx context.Context) (uuid.UUID, error) {
+	c.mu.Lock()
+	userID, expiresAt := c.userID, c.expiresAt
+	c.mu.Unlock()
+	if userID == uuid.Nil {
+		return uuid.Nil, &apiError{Status: http.StatusUnauthorized, Message: "authentication required"}
+	}
+	if !expiresAt.IsZero() && !time.Now().Before(expiresAt) {
+		return uuid.Nil, &apiError{Status: http.StatusUnauthorized, Message: "token expired, re-authenticate"}
+	}
+	// the account may have been deleted since the connection authenticated
+	if err := c.cfg.checkActive(ctx, userID); err != nil {
+		return uuid.Nil, err
+	}
+	return userID, nil
+}
+
+func (c *wsConn) handleSubscribe(ctx context.Context, msg wsClientMessage) {
+	if msg.Subscription == "" {
+		c.replyError(msg.ID, &apiError{Status: http.StatusBadRequest, Message: "subscription name is required"})
+		return
+	}
+	c.mu.Lock()
+	viewerID := c.userID
+	_, exists := c.subs[msg.Subscription]
+	count := len(c.subs)
+	c.mu.Unlock()
+	if !exists && count >= wsMaxSubscriptions {
+		c.replyError(msg.ID, &apiError{Status: http.StatusBadRequest, Message: "too many subscriptions"})
+		return
+	}
+
+	filter, err := c.cfg.streamFilter(ctx, viewerID, msg.AuthorIDs, msg.Q)
+	if err != nil {
+		c.replyError(msg.ID, &apiError{Status: http.StatusBadRequest, Message: err.Error()})
+		return
+	}
+	c.mu.Lock()
+	c.subs[msg.Subscription] = &wsSubscription{authorIDs: msg.AuthorIDs, keyword: msg.Q, filter: filter}
+	c.mu.Unlock()
+	c.reply(wsServerMessage{Type: "subscribed", ID: msg.ID, Subscription: msg.Subscription})
+}
+
+// refreshFilters rebuilds every subscription's filter for the current user.
+func (c *wsConn) refreshFilters(ctx context.Context) error {
+	c.mu.Lock()
+	viewerID := c.userID
+	subs := make(map[string]*wsSubscription, len(c.subs))
+	for name, s := range c.subs {
+		subs[name] = s
+	}
+	c.mu.Unlock()
+
+	for name, s := range subs {
+		filter, err := c.cfg.streamFilter(ctx, viewerID, s.authorIDs, s.keyword)
+		if err != nil {
+			return err
+		}
+		c.mu.Lock()
+		if c.subs[name] == s {
+			c.subs[name] = &wsSubscription{authorIDs: s.authorIDs, keyword: s.keyword, filter: filter}
+		}
+		c.mu.Unlock()
+	}
+	return nil
+}
+
+func (c *wsConn) handleCreateChirp(ctx context.Context, msg wsClientMessage) {
+	userID, err := c.currentUser(ctx)
+	if err == nil {
+		err = c.allow(ctx, "POST /api/chirps", userID)
+	}
+	if err != nil {
+		c.replyError(msg.ID, err)
+		return
+	}
+	chirp, err := c.cfg.createChirp(ctx, userID, chirpInput{
+		Body:      msg.Body,
+		PublishAt: msg.PublishAt,
+		Poll:      msg.Poll,
+	})
+	if err != nil {
+		c.replyError(msg.ID, err)
+		return
+	}
+	c.reply(wsServerMessage{Type: "chirp_created", ID: msg.ID, Data: chirp})
+}
+
+func (c *wsConn) handleDeleteChirp(ctx context.Context, msg wsClientMessage) {
+	userID, err := c.currentUser(ctx)
+	if err == nil {
+		err = c.allow(ctx, "DELETE /api/chirps/{chirpId}", userID)
+	}
+	if err != nil {
+		c.replyError(msg.ID, err)
+		return
+	}
+	if err := c.cfg.deleteChirp(ctx, userID, msg.ChirpID); err != nil {
+		c.replyError(msg.ID, err)
+		return
+	}
+	c.reply(wsServerMessage{Type: "chirp_deleted", ID: msg.ID, Data: map[string]uuid.UUID{"chirp_id": msg.ChirpID}})
+}
+
+// allow applies the rate limits of the equivalent HTTP route, so commands
+// can't be used to get around them.
+func (c *wsConn) allow(ctx context.Context, pattern string, userID uuid.UUID) error {
+	res, ok, err := c.cfg.rateLimiter.Allow(ctx, pattern, "user:"+userID.String())
+	if err != nil {
+		// fail open, like the HTTP middleware
+		log.Printf("rate limiter error: %s", err)
+		return nil
+	}
+	if ok && !res.Allowed {
+		return &wsRateLimited{retryAfter: res.RetryAfter}
+	}
+	return nil
+}
+
+type wsRateLimited struct {
+	retryAfter time.Duration
+}
+
+func (e *wsRateLimited) Error() string { return "Rate limit exceeded" }
+
+// eventLoop fans hub messages out to matching subscriptions. If the hub
+// drops the connection for falling behind, so does the gateway.
+func (c *wsConn) eventLoop(sub *stream.Subscription) {
+	for {
+		select {
+		case <-c.done:
+			return
+		case msg, ok := <-sub.C:
+			if !ok {
+				c.close(websocket.CloseTryAgainLater, "too slow")
+				return
+			}
+			c.mu.Lock()
+			var matched []string
+			for name, s := range c.subs {
+				if s.filter.Match(msg.Event) {
+					matched = append(matched, name)
+				}
+			}
+			c.mu.Unlock()
+			for _, name := range matched {
+				c.reply(wsServerMessage{
+					Type:         "event",
+					Subscription: name,
+					EventID:      msg.ID,
+					Event:        msg.Event.Type,
+					Data:         msg.Event.Payload,
+				})
+			}
+		}
+	}
+}
+
+// writeLoop is the connection's only writer. It also sends the pings that
+// keep the read deadline alive.
+func (c *wsConn) writeLoop() {
+	ping := time.NewTicker(wsPingPeriod)
+	defer ping.Stop()
+	for {
+		select {
+		case <-c.done:
+			return
+		case msg := <-c.send:
+			c.conn.SetWriteDeadline(time.Now().Add(wsWriteWait))
+			if err := c.conn.WriteJSON(msg); err != nil {
+				c.close(websocket.CloseAbnormalClosure, "")
+				return
+			}
+		case <-ping.C:
+			if err := c.conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(wsWriteWait)); err != nil {
+				c.close(websocket.CloseAbnormalClosure, "")
+				return
+			}
+		}
+	}
+}
+
+// reply queues msg without blocking. A full queue means the client isn't
+// reading, and it is disconnected rather than buffered without bound.
+func (c *wsConn) reply(msg wsServerMessage) {
+	select {
+	case <-c.done:
+	case c.send <- msg:
+	default:
+		c.close(websocket.CloseTryAgainLater, "too slow")
+	}
+}
+
+func (c *wsConn) replyError(id string, err error) {
+	msg := wsServerMessage{Type: "error", ID: id}
+	var apiErr *apiError
+	var limited *wsRateLimited
+	switch {
+	case errors.As(err, &limited):
+		msg.Status = http.StatusTooManyRequests
+		msg.Error = limited.Error()
+		msg.RetryAfter = int(math.Ceil(limited.retryAfter.Seconds()))
+	case errors.As(err, &apiErr):
+		msg.Status = apiErr.Status
+		msg.Error = apiErr.Message
+		msg.Errors = apiErr.Errors
+		if apiErr.Err != nil {
+			log.Println(apiErr.Err)
+		}
+	default:
+		msg.Status = http.StatusInternalServerError
+		msg.Error = "internal error"
+		log.Println(err)
+	}
+	c.reply(msg)
+}
+
+// close tears the connection down once, sending code to the client when
+// it is a code that may appear on the wire.
+func (c *wsConn) close(code int, text string) {
+	c.once.Do(func() {
+		close(c.done)
+		c.mu.Lock()
+		if c.expiry != nil {
+			c.expiry.Stop()
+		}
+		c.mu.Unlock()
+		if code != websocket.CloseAbnormalClosure {
+			c.conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(code, text), time.Now().Add(wsWriteWait))
+		}
+		c.conn.Close()
+	})
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+
+	"local/mda/internal/accounts"
+	"local/mda/internal/auth"
+
+	"github.com/google/uuid"
+)
+
+// clientIP returns the address of the directly connected peer.
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// authenticate returns the user behind the request's access token, or writes
+// a 401 and returns false.
+func (cfg *apiConfig) authenticate(w http.ResponseWriter, r *http.Request) (uuid.UUID, bool) {
+	userID, err := accounts.Authenticate(r.Context(), cfg.db, r.Header, cfg.authSecret)
+	switch {
+	case errors.Is(err, accounts.ErrMissingToken),
+		errors.Is(err, accounts.ErrInvalidToken),
+		errors.Is(err, accounts.ErrDeleted):
+		respondWithError(w, http.StatusUnauthorized, err.Error(), nil)
+		return uuid.Nil, false
+	case err != nil:
+		respondWithError(w, http.StatusInternalServerError, "couldn't load account", err)
+		return uuid.Nil, false
+	}
+	return userID, true
+}
+
+// checkActive rejects users whose account is scheduled for deletion. Their
+// refresh tokens are revoked on delete, but access tokens stay valid until
+// they expire. Errors are *apiError.
+func (cfg *apiConfig) checkActive(ctx context.Context, userID uuid.UUID) error {
+	err := accounts.CheckActive(ctx, cfg.db, userID)
+	if errors.Is(err, accounts.ErrDeleted) {
+		return &apiError{Status: http.StatusUnauthorized, Message: err.Error()}
+	}
+	if err != nil {
+		return &apiError{Status: http.StatusInternalServerError, Message: "couldn't load account", Err: err}
+	}
+	return nil
+}
+
+// optionalUserID returns the user behind the request's access token, or
+// uuid.Nil for anonymous requests and tokens that don't validate.
+func (cfg *apiConfig) optionalUserID(r *http.Request) uuid.UUID {
+	bearer, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		return uuid.Nil
+	}
+	userID, err := auth.ValidateJWT(bearer, cfg.authSecret)
+	if err != nil {
+		return uuid.Nil
+	}
+	return userID
+}
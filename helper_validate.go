@@ -1,33 +1,42 @@
 package main
 
 import (
-	"strings"
-	"unicode"
+	"errors"
+	"net/http"
+	"regexp"
+
+	"local/mda/internal/auth"
 )
 
-func cleanProfaneWords(input string) string {
-	profaneWords := []string{
-		"kerfuffle",
-		"sharbert",
-		"fornax",
-	}
-	return hideProfanity(input, profaneWords)
+// Minimal email check
+var emailRe = regexp.MustCompile(`^[^\s@]+@[^\s@]+\.[^\s@]+$`)
+
+func validEmail(email string) bool {
+	return emailRe.MatchString(email)
 }
 
-func hideProfanity(input string, profaneWords []string) string {
-	words := strings.Fields(input)
-	for i, w := range words {
-		base := strings.TrimRightFunc(w, func(r rune) bool {
-			return unicode.IsPunct(r)
-		})
-		trailing := w[len(base):]
+// checkPassword applies the password policy and writes the error response if
+// the password is rejected.
+func (cfg *apiConfig) checkPassword(w http.ResponseWriter, password string) bool {
+	err := cfg.passwordPolicy.Validate(password)
+	if err == nil {
+		return true
+	}
 
-		for _, bad := range profaneWords {
-			if strings.Contains(strings.ToLower(base), strings.ToLower(bad)) {
-				words[i] = "****" + trailing
-				break
-			}
-		}
+	var policyErr *auth.PasswordPolicyError
+	if !errors.As(err, &policyErr) {
+		respondWithError(w, http.StatusInternalServerError, "couldn't validate password", err)
+		return false
 	}
-	return strings.Join(words, " ")
-}
\ No newline at end of file
+
+	errs := make([]validationError, 0, len(policyErr.Violations))
+	for _, v := range policyErr.Violations {
+		errs = append(errs, validationError{
+			Field:   "password",
+			Code:    v.Code,
+			Message: v.Message,
+		})
+	}
+	respondWithValidationErrors(w, "password does not meet requirements", errs)
+	return false
+}
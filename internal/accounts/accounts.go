@@ -0,0 +1,250 @@
+package accounts
+
+import (
+	"archive/zip"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"local/mda/internal/auth"
+	"local/mda/internal/database"
+
+	"github.com/google/uuid"
+)
+
+var (
+	ErrCurrentPasswordRequired = errors.New("current_password is required to change email or password")
+	ErrWrongPassword           = errors.New("current password is incorrect")
+
+	ErrMissingToken   = errors.New("missing or invalid authorization header")
+	ErrInvalidToken   = errors.New("invalid or expired token")
+	ErrDeleted        = errors.New("account has been deleted")
+	ErrAlreadyDeleted = errors.New("account is already scheduled for deletion")
+)
+
+// Active reports whether u can use the API: accounts scheduled for deletion
+// can't, even with an access token issued before the deletion.
+func Active(u database.User) bool {
+	return !u.DeletedAt.Valid
+}
+
+// DeletionPolicy decides what happens to accounts scheduled for deletion.
+type DeletionPolicy struct {
+	// Grace is how long a deleted account can still be restored by
+	// logging in before it is purged.
+	Grace time.Duration
+}
+
+// PurgeAt returns when an account deleted at deletedAt is purged.
+func (p DeletionPolicy) PurgeAt(deletedAt time.Time) time.Time {
+	return deletedAt.Add(p.Grace)
+}
+
+// PurgeCutoff is the deleted_at before which accounts are purged at now.
+func (p DeletionPolicy) PurgeCutoff(now time.Time) time.Time {
+	return now.Add(-p.Grace)
+}
+
+// Purgeable reports whether the purge job removes u at now.
+func (p DeletionPolicy) Purgeable(u database.User, now time.Time) bool {
+	return u.DeletedAt.Valid && u.DeletedAt.Time.Before(p.PurgeCutoff(now))
+}
+
+// Restorable reports whether logging in at now restores u. Once the grace
+// period is over the account is treated as gone, even if the purge job
+// hasn't removed it yet.
+func (p DeletionPolicy) Restorable(u database.User, now time.Time) bool {
+	return u.DeletedAt.Valid && !p.Purgeable(u, now)
+}
+
+type PurgeQueries interface {
+	ListMediaKeysForPurge(ctx context.Context, cutoff time.Time) ([]database.ListMediaKeysForPurgeRow, error)
+	PurgeDeletedUsers(ctx context.Context, cutoff time.Time) (int64, error)
+}
+
+// Purge removes the accounts that are purgeable at now. Chirps and refresh
+// tokens go with them through ON DELETE CASCADE. The cascade drops the
+// chirp_media rows too, so their blob keys are collected first and
+// returned; the caller deletes the blobs once q's transaction commits.
+func (p DeletionPolicy) Purge(ctx context.Context, q PurgeQueries, now time.Time) (n int64, blobKeys []string, err error) {
+	cutoff := p.PurgeCutoff(now)
+	media, err := q.ListMediaKeysForPurge(ctx, cutoff)
+	if err != nil {
+		return 0, nil, err
+	}
+	n, err = q.PurgeDeletedUsers(ctx, cutoff)
+	if err != nil {
+		return 0, nil, err
+	}
+	for _, m := range media {
+		blobKeys = append(blobKeys, m.StorageKey, m.ThumbnailKey)
+	}
+	return n, blobKeys, nil
+}
+
+type DeleteQueries interface {
+	SoftDeleteUser(ctx context.Context, arg database.SoftDeleteUserParams) (database.User, error)
+	RevokeAllRefreshTokensForUser(ctx context.Context, userID uuid.UUID) error
+}
+
+// Delete schedules userID's account for deletion at now and revokes its
+// refresh tokens. Access tokens stay valid until they expire, which is why
+// Authenticate checks the account as well.
+func Delete(ctx context.Context, q DeleteQueries, userID uuid.UUID, now time.Time) (database.User, error) {
+	u, err := q.SoftDeleteUser(ctx, database.SoftDeleteUserParams{
+		DeletedAt: now,
+		ID:        userID,
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		return database.User{}, ErrAlreadyDeleted
+	}
+	if err != nil {
+		return database.User{}, err
+	}
+	if err := q.RevokeAllRefreshTokensForUser(ctx, userID); err != nil {
+		return database.User{}, err
+	}
+	return u, nil
+}
+
+type ActiveQueries interface {
+	UserIsActive(ctx context.Context, id uuid.UUID) (bool, error)
+}
+
+// CheckActive returns ErrDeleted for accounts scheduled for deletion.
+func CheckActive(ctx context.Context, q ActiveQueries, userID uuid.UUID) error {
+	active, err := q.UserIsActive(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if !active {
+		return ErrDeleted
+	}
+	return nil
+}
+
+// Authenticate returns the user behind the access token in h. Tokens of
+// accounts scheduled for deletion are rejected with ErrDeleted, even when
+// they were issued before the deletion.
+func Authenticate(ctx context.Context, q ActiveQueries, h http.Header, secret string) (uuid.UUID, error) {
+	bearer, err := auth.GetBearerToken(h)
+	if err != nil {
+		return uuid.Nil, ErrMissingToken
+	}
+	userID, err := auth.ValidateJWT(bearer, secret)
+	if err != nil {
+		return uuid.Nil, ErrInvalidToken
+	}
+	if err := CheckActive(ctx, q, userID); err != nil {
+		return uuid.Nil, err
+	}
+	return userID, nil
+}
+
+// Credentials is the part of an account update that needs proof the caller
+// knows the current password.
+type Credentials struct {
+	Email           *string
+	Password        *string
+	CurrentPassword string
+}
+
+// DropUnchangedEmail forgets a requested email equal to the current one, so
+// resubmitting a whole form doesn't start an email change.
+func (c *Credentials) DropUnchangedEmail(current string) {
+	if c.Email != nil && strings.EqualFold(*c.Email, current) {
+		c.Email = nil
+	}
+}
+
+// Sensitive reports whether the update changes the email or password.
+func (c Credentials) Sensitive() bool {
+	return c.Email != nil || c.Password != nil
+}
+
+// Authorize checks CurrentPassword against hashed when the update is
+// sensitive.
+func (c Credentials) Authorize(h auth.PasswordHasher, hashed string) error {
+	if !c.Sensitive() {
+		return nil
+	}
+	if c.CurrentPassword == "" {
+		return ErrCurrentPasswordRequired
+	}
+	if _, err := h.Verify(c.CurrentPassword, hashed); err != nil {
+		return ErrWrongPassword
+	}
+	return nil
+}
+
+// EmailChangePolicy decides how long a requested email change can be
+// confirmed.
+type EmailChangePolicy struct {
+	TTL time.Duration
+}
+
+func (p EmailChangePolicy) ExpiresAt(requestedAt time.Time) time.Time {
+	return requestedAt.Add(p.TTL)
+}
+
+// Confirmable reports whether change can still be confirmed at now.
+func (p EmailChangePolicy) Confirmable(change database.EmailChange, now time.Time) bool {
+	return change.ExpiresAt.After(now)
+}
+
+// Session is a refresh token as exported: the token value is a credential,
+// so only its lifecycle is included.
+type Session struct {
+	CreatedAt time.Time  `json:"created_at"`
+	ExpiresAt time.Time  `json:"expires_at"`
+	RevokedAt *time.Time `json:"revoked_at"`
+}
+
+func Sessions(tokens []database.RefreshToken) []Session {
+	out := make([]Session, 0, len(tokens))
+	for _, t := range tokens {
+		s := Session{
+			CreatedAt: t.CreatedAt,
+			ExpiresAt: t.ExpiresAt,
+		}
+		if t.RevokedAt.Valid {
+			revoked := t.RevokedAt.Time
+			s.RevokedAt = &revoked
+		}
+		out = append(out, s)
+	}
+	return out
+}
+
+// File is one JSON document in an export archive.
+type File struct {
+	Name string
+	Data any
+}
+
+// WriteZip writes files to w as a ZIP archive of indented JSON documents,
+// all stamped with modified.
+func WriteZip(w io.Writer, modified time.Time, files []File) error {
+	zw := zip.NewWriter(w)
+	for _, f := range files {
+		fw, err := zw.CreateHeader(&zip.FileHeader{
+			Name:     f.Name,
+			Method:   zip.Deflate,
+			Modified: modified,
+		})
+		if err != nil {
+			return err
+		}
+		enc := json.NewEncoder(fw)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(f.Data); err != nil {
+			return err
+		}
+	}
+	return zw.Close()
+}
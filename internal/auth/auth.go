@@ -2,6 +2,7 @@ package auth
 
 import (
 	"crypto/rand"
+	"crypto/sha256"
 	"encoding/hex"
 	"errors"
 	"fmt"
@@ -11,20 +12,18 @@ import (
 
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/google/uuid"
-	"golang.org/x/crypto/bcrypt"
 )
 
 
+// HashPassword hashes with DefaultPasswordHasher.
 func HashPassword(password string) (string, error) {
-	hashedBytes, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
-	if err != nil {
-		return "", err
-	}
-	return string(hashedBytes), nil	
+	return DefaultPasswordHasher().Hash(password)
 }
 
+// CheckPasswordHash accepts any hash format PasswordHasher understands.
 func CheckPasswordHash(password, hash string) error {
-	return bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
+	_, err := DefaultPasswordHasher().Verify(password, hash)
+	return err
 }
 
 func MakeJWT(userID uuid.UUID, tokenSecret string, expiresIn time.Duration) (string, error) {
@@ -49,6 +48,14 @@ func MakeJWT(userID uuid.UUID, tokenSecret string, expiresIn time.Duration) (str
 }
 
 func ValidateJWT(tokenString, tokenSecret string) (uuid.UUID, error) {
+	uid, _, err := ParseJWT(tokenString, tokenSecret)
+	return uid, err
+}
+
+// ParseJWT validates the token like ValidateJWT and also returns when it
+// expires (zero if it doesn't), for long-lived connections that must stop
+// trusting it then.
+func ParseJWT(tokenString, tokenSecret string) (uuid.UUID, time.Time, error) {
 	claims := &jwt.RegisteredClaims{}
 
 	token, err := jwt.ParseWithClaims(
@@ -65,22 +72,26 @@ func ValidateJWT(tokenString, tokenSecret string) (uuid.UUID, error) {
 		jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}),
 	)
 	if err != nil {
-		return uuid.UUID{}, fmt.Errorf("invalid token: %w", err)
+		return uuid.UUID{}, time.Time{}, fmt.Errorf("invalid token: %w", err)
 	}
 	if !token.Valid {
-		return uuid.UUID{}, fmt.Errorf("invalid token")
+		return uuid.UUID{}, time.Time{}, fmt.Errorf("invalid token")
 	}
 
 	// Optional: enforce issuer if you want stricter validation
 	if claims.Issuer != "chirpy" {
-		return uuid.UUID{}, fmt.Errorf("unexpected issuer: %s", claims.Issuer)
+		return uuid.UUID{}, time.Time{}, fmt.Errorf("unexpected issuer: %s", claims.Issuer)
 	}
 
 	uid, err := uuid.Parse(claims.Subject)
 	if err != nil {
-		return uuid.UUID{}, fmt.Errorf("invalid subject uuid: %w", err)
+		return uuid.UUID{}, time.Time{}, fmt.Errorf("invalid subject uuid: %w", err)
 	}
-	return uid, nil
+	var expiresAt time.Time
+	if claims.ExpiresAt != nil {
+		expiresAt = claims.ExpiresAt.Time
+	}
+	return uid, expiresAt, nil
 }
 
 func GetBearerToken(headers http.Header) (string, error) {
@@ -131,3 +142,10 @@ func GetAPIKey(headers http.Header) (string, error) {
 
 	return strings.TrimSpace(strings.TrimPrefix(authHeader, prefix)), nil
 }
+
+// HashToken returns the hex SHA-256 of an opaque token, for storing tokens
+// that are only ever looked up, never read back.
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,165 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+type HashAlgorithm string
+
+const (
+	HashBcrypt   HashAlgorithm = "bcrypt"
+	HashArgon2id HashAlgorithm = "argon2id"
+)
+
+var (
+	ErrPasswordMismatch = errors.New("password does not match hash")
+	ErrUnknownHash      = errors.New("unrecognized password hash format")
+)
+
+type Argon2Params struct {
+	Memory      uint32 // KiB
+	Iterations  uint32
+	Parallelism uint8
+	SaltLength  uint32
+	KeyLength   uint32
+}
+
+// PasswordHasher produces self-describing hashes: bcrypt's "$2a$<cost>$..."
+// or the PHC string "$argon2id$v=19$m=...,t=...,p=...$<salt>$<key>". Hashes
+// made with other settings still verify and are reported as needing a rehash.
+type PasswordHasher struct {
+	Algorithm  HashAlgorithm
+	BcryptCost int
+	Argon2     Argon2Params
+}
+
+func DefaultPasswordHasher() PasswordHasher {
+	return PasswordHasher{
+		Algorithm:  HashArgon2id,
+		BcryptCost: bcrypt.DefaultCost,
+		// OWASP baseline for Argon2id
+		Argon2: Argon2Params{
+			Memory:      19 * 1024,
+			Iterations:  2,
+			Parallelism: 1,
+			SaltLength:  16,
+			KeyLength:   32,
+		},
+	}
+}
+
+func (h PasswordHasher) Hash(password string) (string, error) {
+	switch h.Algorithm {
+	case HashBcrypt:
+		hashed, err := bcrypt.GenerateFromPassword([]byte(password), h.BcryptCost)
+		if err != nil {
+			return "", err
+		}
+		return string(hashed), nil
+	case HashArgon2id:
+		salt := make([]byte, h.Argon2.SaltLength)
+		if _, err := rand.Read(salt); err != nil {
+			return "", fmt.Errorf("could not generate salt: %w", err)
+		}
+		key := argon2.IDKey([]byte(password), salt, h.Argon2.Iterations, h.Argon2.Memory, h.Argon2.Parallelism, h.Argon2.KeyLength)
+		return encodeArgon2id(h.Argon2, salt, key), nil
+	default:
+		return "", fmt.Errorf("unsupported hash algorithm: %s", h.Algorithm)
+	}
+}
+
+// Verify checks password against encoded. On a match it also reports whether
+// encoded should be replaced by a hash made with the current settings.
+func (h PasswordHasher) Verify(password, encoded string) (needsRehash bool, err error) {
+	switch {
+	case strings.HasPrefix(encoded, "$argon2id$"):
+		params, salt, key, err := decodeArgon2id(encoded)
+		if err != nil {
+			return false, err
+		}
+		got := argon2.IDKey([]byte(password), salt, params.Iterations, params.Memory, params.Parallelism, uint32(len(key)))
+		if subtle.ConstantTimeCompare(got, key) != 1 {
+			return false, ErrPasswordMismatch
+		}
+		if h.Algorithm != HashArgon2id {
+			return true, nil
+		}
+		current := h.Argon2
+		return params.Memory != current.Memory ||
+			params.Iterations != current.Iterations ||
+			params.Parallelism != current.Parallelism ||
+			uint32(len(salt)) != current.SaltLength ||
+			uint32(len(key)) != current.KeyLength, nil
+
+	case strings.HasPrefix(encoded, "$2"):
+		err := bcrypt.CompareHashAndPassword([]byte(encoded), []byte(password))
+		if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+			return false, ErrPasswordMismatch
+		}
+		if err != nil {
+			return false, err
+		}
+		if h.Algorithm != HashBcrypt {
+			return true, nil
+		}
+		cost, err := bcrypt.Cost([]byte(encoded))
+		if err != nil {
+			return false, err
+		}
+		return cost != h.BcryptCost, nil
+
+	default:
+		return false, ErrUnknownHash
+	}
+}
+
+func encodeArgon2id(p Argon2Params, salt, key []byte) string {
+	return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s",
+		argon2.Version,
+		p.Memory, p.Iterations, p.Parallelism,
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(key),
+	)
+}
+
+func decodeArgon2id(encoded string) (Argon2Params, []byte, []byte, error) {
+	// "", "argon2id", "v=19", "m=...,t=...,p=...", salt, key
+	parts := strings.Split(encoded, "$")
+	if len(parts) != 6 {
+		return Argon2Params{}, nil, nil, ErrUnknownHash
+	}
+
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil {
+		return Argon2Params{}, nil, nil, ErrUnknownHash
+	}
+	if version != argon2.Version {
+		return Argon2Params{}, nil, nil, fmt.Errorf("unsupported argon2 version: %d", version)
+	}
+
+	var p Argon2Params
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &p.Memory, &p.Iterations, &p.Parallelism); err != nil {
+		return Argon2Params{}, nil, nil, ErrUnknownHash
+	}
+
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return Argon2Params{}, nil, nil, ErrUnknownHash
+	}
+	key, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil {
+		return Argon2Params{}, nil, nil, ErrUnknownHash
+	}
+	p.SaltLength = uint32(len(salt))
+	p.KeyLength = uint32(len(key))
+
+	return p, salt, key, nil
+}
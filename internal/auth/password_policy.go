@@ -0,0 +1,189 @@
+package auth
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// PasswordPolicy describes what a password must satisfy before it is hashed.
+type PasswordPolicy struct {
+	MinLength int
+	// MaxLength, in bytes, caps what a single request can make the hasher
+	// chew through. The default of 72 also fits bcrypt, which ignores
+	// anything longer, in case PASSWORD_HASH_ALGORITHM selects it.
+	MaxLength int
+	// MinEntropyBits is checked against PasswordEntropy.
+	MinEntropyBits float64
+	// Breached is consulted last; nil skips the check.
+	Breached BreachedChecker
+}
+
+func DefaultPasswordPolicy() PasswordPolicy {
+	return PasswordPolicy{
+		MinLength:      8,
+		MaxLength:      72,
+		MinEntropyBits: 28,
+	}
+}
+
+type PolicyViolation struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// PasswordPolicyError lists every rule the password broke.
+type PasswordPolicyError struct {
+	Violations []PolicyViolation
+}
+
+func (e *PasswordPolicyError) Error() string {
+	msgs := make([]string, 0, len(e.Violations))
+	for _, v := range e.Violations {
+		msgs = append(msgs, v.Message)
+	}
+	return "password policy: " + strings.Join(msgs, "; ")
+}
+
+// Validate returns a *PasswordPolicyError if the password breaks the policy,
+// or another error if the breached-password lookup itself failed.
+func (p PasswordPolicy) Validate(password string) error {
+	var violations []PolicyViolation
+
+	length := utf8.RuneCountInString(password)
+	if length < p.MinLength {
+		violations = append(violations, PolicyViolation{
+			Code:    "too_short",
+			Message: fmt.Sprintf("password must be at least %d characters", p.MinLength),
+		})
+	}
+	if p.MaxLength > 0 && len(password) > p.MaxLength {
+		violations = append(violations, PolicyViolation{
+			Code:    "too_long",
+			Message: fmt.Sprintf("password must be at most %d bytes", p.MaxLength),
+		})
+	}
+	if length > 0 && PasswordEntropy(password) < p.MinEntropyBits {
+		violations = append(violations, PolicyViolation{
+			Code:    "too_weak",
+			Message: "password is too predictable, use a longer or more varied password",
+		})
+	}
+
+	if len(violations) == 0 && p.Breached != nil {
+		breached, err := p.Breached.IsBreached(password)
+		if err != nil {
+			return fmt.Errorf("could not check breached passwords: %w", err)
+		}
+		if breached {
+			violations = append(violations, PolicyViolation{
+				Code:    "breached",
+				Message: "password has appeared in a data breach, choose a different one",
+			})
+		}
+	}
+
+	if len(violations) > 0 {
+		return &PasswordPolicyError{Violations: violations}
+	}
+	return nil
+}
+
+// PasswordEntropy estimates the strength of a password in bits from the
+// character classes it uses. Repeated characters only count half.
+func PasswordEntropy(password string) float64 {
+	var lower, upper, digit, symbol, other bool
+	seen := make(map[rune]bool)
+	effective := 0.0
+
+	for _, r := range password {
+		switch {
+		case r < unicode.MaxASCII && unicode.IsLower(r):
+			lower = true
+		case r < unicode.MaxASCII && unicode.IsUpper(r):
+			upper = true
+		case r < unicode.MaxASCII && unicode.IsDigit(r):
+			digit = true
+		case r < unicode.MaxASCII:
+			symbol = true
+		default:
+			other = true
+		}
+
+		if seen[r] {
+			effective += 0.5
+		} else {
+			effective++
+			seen[r] = true
+		}
+	}
+
+	pool := 0
+	if lower {
+		pool += 26
+	}
+	if upper {
+		pool += 26
+	}
+	if digit {
+		pool += 10
+	}
+	if symbol {
+		pool += 33
+	}
+	if other {
+		pool += 100
+	}
+	if pool == 0 {
+		return 0
+	}
+	return effective * math.Log2(float64(pool))
+}
+
+type BreachedChecker interface {
+	IsBreached(password string) (bool, error)
+}
+
+// BreachedCorpus looks passwords up in a local copy of a k-anonymity range
+// corpus: one file per 5-character SHA-1 prefix (e.g. "5BAA6.txt"), each line
+// holding the remaining 35 hex characters of a hash and a count, "SUFFIX:COUNT".
+type BreachedCorpus struct {
+	dir string
+}
+
+func NewBreachedCorpus(dir string) *BreachedCorpus {
+	return &BreachedCorpus{dir: dir}
+}
+
+func (c *BreachedCorpus) IsBreached(password string) (bool, error) {
+	sum := sha1.Sum([]byte(password))
+	hash := strings.ToUpper(hex.EncodeToString(sum[:]))
+	prefix, suffix := hash[:5], hash[5:]
+
+	f, err := os.Open(filepath.Join(c.dir, prefix+".txt"))
+	if errors.Is(err, os.ErrNotExist) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		candidate, _, _ := strings.Cut(line, ":")
+		if strings.EqualFold(candidate, suffix) {
+			return true, nil
+		}
+	}
+	return false, scanner.Err()
+}
@@ -0,0 +1,93 @@
+package chirps
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+	"unicode"
+
+	"local/mda/internal/database"
+
+	"github.com/google/uuid"
+)
+
+var ErrScheduleTooFar = errors.New("publish_at is too far in the future")
+
+var profaneWords = []string{
+	"kerfuffle",
+	"sharbert",
+	"fornax",
+}
+
+// CleanBody replaces every word containing a profane word with "****",
+// keeping trailing punctuation.
+func CleanBody(input string) string {
+	words := strings.Fields(input)
+	for i, w := range words {
+		base := strings.TrimRightFunc(w, func(r rune) bool {
+			return unicode.IsPunct(r)
+		})
+		trailing := w[len(base):]
+
+		for _, bad := range profaneWords {
+			if strings.Contains(strings.ToLower(base), strings.ToLower(bad)) {
+				words[i] = "****" + trailing
+				break
+			}
+		}
+	}
+	return strings.Join(words, " ")
+}
+
+// New builds the row for a new chirp. publishAt decides whether the chirp
+// goes live now or waits for the scheduler; one in the past (or a little
+// clock skew) publishes right away. A maxAhead of zero puts no bound on how
+// far ahead it can be.
+func New(userID uuid.UUID, body string, publishAt *time.Time, now time.Time, maxAhead time.Duration) (database.CreateChirpParams, error) {
+	at := now
+	if publishAt != nil && publishAt.After(now) {
+		if maxAhead > 0 && publishAt.Sub(now) > maxAhead {
+			return database.CreateChirpParams{}, ErrScheduleTooFar
+		}
+		at = publishAt.UTC()
+	}
+	return database.CreateChirpParams{
+		Body:        CleanBody(body),
+		UserID:      userID,
+		PublishAt:   at,
+		PublishedAt: sql.NullTime{Time: now, Valid: !at.After(now)},
+	}, nil
+}
+
+// DraftQueries is what PublishDraft needs from *database.Queries.
+type DraftQueries interface {
+	GetDraftForUpdate(ctx context.Context, arg database.GetDraftForUpdateParams) (database.Draft, error)
+	DeleteDraft(ctx context.Context, arg database.DeleteDraftParams) (int64, error)
+}
+
+// PublishDraft turns userID's draft into a chirp through insert, the same
+// path new chirps take, then deletes the draft. q and insert must share one
+// transaction: the draft row stays locked until it commits, a rejected
+// chirp keeps the draft and a failed delete doesn't leave both behind.
+func PublishDraft(ctx context.Context, q DraftQueries, userID, draftID uuid.UUID, insert func(body string, publishAt *time.Time) (database.Chirp, error)) (database.Chirp, error) {
+	draft, err := q.GetDraftForUpdate(ctx, database.GetDraftForUpdateParams{ID: draftID, UserID: userID})
+	if err != nil {
+		return database.Chirp{}, err
+	}
+
+	var publishAt *time.Time
+	if draft.PublishAt.Valid {
+		publishAt = &draft.PublishAt.Time
+	}
+	chirp, err := insert(draft.Body, publishAt)
+	if err != nil {
+		return database.Chirp{}, err
+	}
+
+	if _, err := q.DeleteDraft(ctx, database.DeleteDraftParams{ID: draftID, UserID: userID}); err != nil {
+		return database.Chirp{}, err
+	}
+	return chirp, nil
+}
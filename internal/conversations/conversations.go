@@ -0,0 +1,113 @@
+package conversations
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"local/mda/internal/database"
+
+	"github.com/google/uuid"
+)
+
+var ErrNotFound = errors.New("conversation not found")
+
+// PairKey names the one-to-one conversation between a and b. It is the same
+// whichever of them starts it.
+func PairKey(a, b uuid.UUID) string {
+	if b.String() < a.String() {
+		a, b = b, a
+	}
+	return a.String() + ":" + b.String()
+}
+
+// OpenQueries is what Open needs; q should be bound to a transaction so the
+// pair lock is held until it commits.
+type OpenQueries interface {
+	LockDirectPair(ctx context.Context, pairKey string) error
+	FindDirectConversation(ctx context.Context, arg database.FindDirectConversationParams) (database.Conversation, error)
+	CreateConversation(ctx context.Context, arg database.CreateConversationParams) (database.Conversation, error)
+	AddConversationMember(ctx context.Context, arg database.AddConversationMemberParams) error
+}
+
+// Open starts a conversation between creator and others. With a single
+// other member it reuses their existing conversation, reporting created as
+// false; the pair is locked first so two concurrent requests can't both
+// miss it and create two.
+func Open(ctx context.Context, q OpenQueries, creator uuid.UUID, others []uuid.UUID) (c database.Conversation, created bool, err error) {
+	if len(others) == 1 {
+		if err := q.LockDirectPair(ctx, PairKey(creator, others[0])); err != nil {
+			return database.Conversation{}, false, err
+		}
+		c, err := q.FindDirectConversation(ctx, database.FindDirectConversationParams{
+			UserID:  creator,
+			OtherID: others[0],
+		})
+		if err == nil {
+			return c, false, nil
+		}
+		if !errors.Is(err, sql.ErrNoRows) {
+			return database.Conversation{}, false, err
+		}
+	}
+
+	c, err = q.CreateConversation(ctx, database.CreateConversationParams{
+		IsGroup:   len(others) > 1,
+		CreatedBy: uuid.NullUUID{UUID: creator, Valid: true},
+	})
+	if err != nil {
+		return database.Conversation{}, false, err
+	}
+	for _, id := range append([]uuid.UUID{creator}, others...) {
+		err := q.AddConversationMember(ctx, database.AddConversationMemberParams{
+			ConversationID: c.ID,
+			UserID:         id,
+		})
+		if err != nil {
+			return database.Conversation{}, false, err
+		}
+	}
+	return c, true, nil
+}
+
+type PermissionQueries interface {
+	IsBlockedBetween(ctx context.Context, arg database.IsBlockedBetweenParams) (bool, error)
+	HasWrittenTo(ctx context.Context, arg database.HasWrittenToParams) (bool, error)
+}
+
+// CanMessage reports whether sender may start a conversation with recipient.
+// Blocks in either direction always prevent it. Recipients who opted out of
+// messages from strangers only accept senders they have written to before.
+func CanMessage(ctx context.Context, q PermissionQueries, senderID uuid.UUID, recipient database.User) (bool, error) {
+	blocked, err := q.IsBlockedBetween(ctx, database.IsBlockedBetweenParams{
+		UserID:   senderID,
+		TargetID: recipient.ID,
+	})
+	if err != nil || blocked {
+		return false, err
+	}
+	if recipient.AllowStrangerDms {
+		return true, nil
+	}
+	return q.HasWrittenTo(ctx, database.HasWrittenToParams{
+		AuthorID: recipient.ID,
+		ReaderID: senderID,
+	})
+}
+
+type MemberQueries interface {
+	GetConversationForMember(ctx context.Context, arg database.GetConversationForMemberParams) (database.Conversation, error)
+}
+
+// ForMember loads conversation id for userID. Non-members get ErrNotFound,
+// the same as for a conversation that doesn't exist, so ids can't be probed.
+func ForMember(ctx context.Context, q MemberQueries, id, userID uuid.UUID) (database.Conversation, error) {
+	c, err := q.GetConversationForMember(ctx, database.GetConversationForMemberParams{
+		ID:     id,
+		UserID: userID,
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		return database.Conversation{}, ErrNotFound
+	}
+	return c, err
+}
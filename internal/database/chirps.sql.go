@@ -7,29 +7,58 @@ package database
 
 import (
 	"context"
+	"database/sql"
+	"time"
 
 	"github.com/google/uuid"
+	"github.com/lib/pq"
 )
 
+const countChirpsByAuthorSince = `-- name: CountChirpsByAuthorSince :one
+SELECT COUNT(*) FROM chirps
+WHERE user_id = $1 AND created_at >= $2
+`
+
+type CountChirpsByAuthorSinceParams struct {
+	UserID    uuid.UUID
+	CreatedAt time.Time
+}
+
+func (q *Queries) CountChirpsByAuthorSince(ctx context.Context, arg CountChirpsByAuthorSinceParams) (int64, error) {
+	row := q.db.QueryRowContext(ctx, countChirpsByAuthorSince, arg.UserID, arg.CreatedAt)
+	var count int64
+	err := row.Scan(&count)
+	return count, err
+}
+
 const createChirp = `-- name: CreateChirp :one
-INSERT INTO chirps (id, created_at, updated_at, body, user_id)
+INSERT INTO chirps (id, created_at, updated_at, body, user_id, publish_at, published_at)
 VALUES (
     gen_random_uuid(),
     NOW(),
     NOW(),
     $1,
-    $2
+    $2,
+    $3,
+    $4
 )
-RETURNING id, created_at, updated_at, body, user_id
+RETURNING id, created_at, updated_at, body, user_id, publish_at, published_at
 `
 
 type CreateChirpParams struct {
-	Body   string
-	UserID uuid.UUID
+	Body        string
+	UserID      uuid.UUID
+	PublishAt   time.Time
+	PublishedAt sql.NullTime
 }
 
 func (q *Queries) CreateChirp(ctx context.Context, arg CreateChirpParams) (Chirp, error) {
-	row := q.db.QueryRowContext(ctx, createChirp, arg.Body, arg.UserID)
+	row := q.db.QueryRowContext(ctx, createChirp,
+		arg.Body,
+		arg.UserID,
+		arg.PublishAt,
+		arg.PublishedAt,
+	)
 	var i Chirp
 	err := row.Scan(
 		&i.ID,
@@ -37,6 +66,8 @@ func (q *Queries) CreateChirp(ctx context.Context, arg CreateChirpParams) (Chirp
 		&i.UpdatedAt,
 		&i.Body,
 		&i.UserID,
+		&i.PublishAt,
+		&i.PublishedAt,
 	)
 	return i, err
 }
@@ -52,12 +83,21 @@ func (q *Queries) DeleteChirp(ctx context.Context, id uuid.UUID) error {
 }
 
 const getChirpById = `-- name: GetChirpById :one
-SELECT id, created_at, updated_at, body, user_id FROM chirps
-WHERE id = $1
+SELECT chirps.id, chirps.created_at, chirps.updated_at, chirps.body, chirps.user_id, chirps.publish_at, chirps.published_at FROM chirps
+JOIN users ON users.id = chirps.user_id
+WHERE chirps.id = $1 AND users.deleted_at IS NULL
+  AND (chirps.published_at IS NOT NULL OR chirps.user_id = $2)
+  AND chirps.user_id <> ALL(coalesce($3::uuid[], '{}'))
 `
 
-func (q *Queries) GetChirpById(ctx context.Context, id uuid.UUID) (Chirp, error) {
-	row := q.db.QueryRowContext(ctx, getChirpById, id)
+type GetChirpByIdParams struct {
+	ID              uuid.UUID
+	ViewerID        uuid.UUID
+	HiddenAuthorIds []uuid.UUID
+}
+
+func (q *Queries) GetChirpById(ctx context.Context, arg GetChirpByIdParams) (Chirp, error) {
+	row := q.db.QueryRowContext(ctx, getChirpById, arg.ID, arg.ViewerID, pq.Array(arg.HiddenAuthorIds))
 	var i Chirp
 	err := row.Scan(
 		&i.ID,
@@ -65,17 +105,41 @@ func (q *Queries) GetChirpById(ctx context.Context, id uuid.UUID) (Chirp, error)
 		&i.UpdatedAt,
 		&i.Body,
 		&i.UserID,
+		&i.PublishAt,
+		&i.PublishedAt,
 	)
 	return i, err
 }
 
 const getChirps = `-- name: GetChirps :many
-SELECT id, created_at, updated_at, body, user_id FROM chirps
-ORDER BY created_at ASC
+SELECT chirps.id, chirps.created_at, chirps.updated_at, chirps.body, chirps.user_id, chirps.publish_at, chirps.published_at FROM chirps
+JOIN users ON users.id = chirps.user_id
+WHERE users.deleted_at IS NULL
+  AND (chirps.published_at IS NOT NULL OR chirps.user_id = $1)
+  AND chirps.user_id <> ALL(coalesce($2::uuid[], '{}'))
+ORDER BY
+    CASE WHEN $3::bool THEN chirps.publish_at END DESC,
+    CASE WHEN NOT $3::bool THEN chirps.publish_at END ASC,
+    chirps.id
+LIMIT $4 OFFSET $5
 `
 
-func (q *Queries) GetChirps(ctx context.Context) ([]Chirp, error) {
-	rows, err := q.db.QueryContext(ctx, getChirps)
+type GetChirpsParams struct {
+	ViewerID        uuid.UUID
+	HiddenAuthorIds []uuid.UUID
+	NewestFirst     bool
+	PageLimit       sql.NullInt32
+	PageOffset      int32
+}
+
+func (q *Queries) GetChirps(ctx context.Context, arg GetChirpsParams) ([]Chirp, error) {
+	rows, err := q.db.QueryContext(ctx, getChirps,
+		arg.ViewerID,
+		pq.Array(arg.HiddenAuthorIds),
+		arg.NewestFirst,
+		arg.PageLimit,
+		arg.PageOffset,
+	)
 	if err != nil {
 		return nil, err
 	}
@@ -89,6 +153,8 @@ func (q *Queries) GetChirps(ctx context.Context) ([]Chirp, error) {
 			&i.UpdatedAt,
 			&i.Body,
 			&i.UserID,
+			&i.PublishAt,
+			&i.PublishedAt,
 		); err != nil {
 			return nil, err
 		}
@@ -104,14 +170,162 @@ func (q *Queries) GetChirps(ctx context.Context) ([]Chirp, error) {
 }
 
 const getChirpsByAuthor = `-- name: GetChirpsByAuthor :many
-SELECT id, created_at, updated_at, body, user_id
+SELECT chirps.id, chirps.created_at, chirps.updated_at, chirps.body, chirps.user_id, chirps.publish_at, chirps.published_at
 FROM chirps
+JOIN users ON users.id = chirps.user_id
+WHERE chirps.user_id = $1 AND users.deleted_at IS NULL
+  AND (chirps.published_at IS NOT NULL OR chirps.user_id = $2)
+  AND chirps.user_id <> ALL(coalesce($3::uuid[], '{}'))
+ORDER BY
+    CASE WHEN $4::bool THEN chirps.publish_at END DESC,
+    CASE WHEN NOT $4::bool THEN chirps.publish_at END ASC,
+    chirps.id
+LIMIT $5 OFFSET $6
+`
+
+type GetChirpsByAuthorParams struct {
+	UserID          uuid.UUID
+	ViewerID        uuid.UUID
+	HiddenAuthorIds []uuid.UUID
+	NewestFirst     bool
+	PageLimit       sql.NullInt32
+	PageOffset      int32
+}
+
+func (q *Queries) GetChirpsByAuthor(ctx context.Context, arg GetChirpsByAuthorParams) ([]Chirp, error) {
+	rows, err := q.db.QueryContext(ctx, getChirpsByAuthor,
+		arg.UserID,
+		arg.ViewerID,
+		pq.Array(arg.HiddenAuthorIds),
+		arg.NewestFirst,
+		arg.PageLimit,
+		arg.PageOffset,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Chirp
+	for rows.Next() {
+		var i Chirp
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Body,
+			&i.UserID,
+			&i.PublishAt,
+			&i.PublishedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getChirpsByIds = `-- name: GetChirpsByIds :many
+SELECT id, created_at, updated_at, body, user_id, publish_at, published_at FROM chirps
+WHERE id = ANY($1::uuid[])
+`
+
+func (q *Queries) GetChirpsByIds(ctx context.Context, ids []uuid.UUID) ([]Chirp, error) {
+	rows, err := q.db.QueryContext(ctx, getChirpsByIds, pq.Array(ids))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Chirp
+	for rows.Next() {
+		var i Chirp
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Body,
+			&i.UserID,
+			&i.PublishAt,
+			&i.PublishedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listAllChirpsByAuthor = `-- name: ListAllChirpsByAuthor :many
+SELECT id, created_at, updated_at, body, user_id, publish_at, published_at FROM chirps
 WHERE user_id = $1
 ORDER BY created_at ASC
 `
 
-func (q *Queries) GetChirpsByAuthor(ctx context.Context, userID uuid.UUID) ([]Chirp, error) {
-	rows, err := q.db.QueryContext(ctx, getChirpsByAuthor, userID)
+func (q *Queries) ListAllChirpsByAuthor(ctx context.Context, userID uuid.UUID) ([]Chirp, error) {
+	rows, err := q.db.QueryContext(ctx, listAllChirpsByAuthor, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Chirp
+	for rows.Next() {
+		var i Chirp
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Body,
+			&i.UserID,
+			&i.PublishAt,
+			&i.PublishedAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const lockChirpQuota = `-- name: LockChirpQuota :exec
+SELECT pg_advisory_xact_lock(hashtext('chirp_quota:' || $1::text))
+`
+
+func (q *Queries) LockChirpQuota(ctx context.Context, userID uuid.UUID) error {
+	_, err := q.db.ExecContext(ctx, lockChirpQuota, userID)
+	return err
+}
+
+const publishDueChirps = `-- name: PublishDueChirps :many
+UPDATE chirps
+SET
+    published_at = $1::timestamp,
+    updated_at   = NOW()
+WHERE published_at IS NULL AND publish_at <= $1::timestamp
+  -- accounts pending deletion keep their scheduled chirps back; they go
+  -- out on the next run if the account is restored
+  AND user_id IN (SELECT id FROM users WHERE deleted_at IS NULL)
+RETURNING id, created_at, updated_at, body, user_id, publish_at, published_at
+`
+
+func (q *Queries) PublishDueChirps(ctx context.Context, now time.Time) ([]Chirp, error) {
+	rows, err := q.db.QueryContext(ctx, publishDueChirps, now)
 	if err != nil {
 		return nil, err
 	}
@@ -125,6 +339,8 @@ func (q *Queries) GetChirpsByAuthor(ctx context.Context, userID uuid.UUID) ([]Ch
 			&i.UpdatedAt,
 			&i.Body,
 			&i.UserID,
+			&i.PublishAt,
+			&i.PublishedAt,
 		); err != nil {
 			return nil, err
 		}
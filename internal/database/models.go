@@ -6,17 +6,161 @@ package database
 
 import (
 	"database/sql"
+	"encoding/json"
 	"time"
 
 	"github.com/google/uuid"
 )
 
+type Bookmark struct {
+	UserID       uuid.UUID
+	ChirpID      uuid.UUID
+	CollectionID uuid.NullUUID
+	CreatedAt    time.Time
+}
+
+type BookmarkCollection struct {
+	ID        uuid.UUID
+	UserID    uuid.UUID
+	Name      string
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
 type Chirp struct {
+	ID          uuid.UUID
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+	Body        string
+	UserID      uuid.UUID
+	PublishAt   time.Time
+	PublishedAt sql.NullTime
+}
+
+type ChirpMedium struct {
+	ID           uuid.UUID
+	ChirpID      uuid.UUID
+	Position     int32
+	ContentType  string
+	SizeBytes    int64
+	Width        int32
+	Height       int32
+	StorageKey   string
+	ThumbnailKey string
+	CreatedAt    time.Time
+}
+
+type Conversation struct {
 	ID        uuid.UUID
+	IsGroup   bool
+	CreatedBy uuid.NullUUID
 	CreatedAt time.Time
 	UpdatedAt time.Time
+}
+
+type ConversationMember struct {
+	ConversationID uuid.UUID
+	UserID         uuid.UUID
+	JoinedAt       time.Time
+	LastReadAt     sql.NullTime
+}
+
+type DomainEvent struct {
+	ID            uuid.UUID
+	Type          string
+	UserID        uuid.UUID
+	Payload       json.RawMessage
+	OccurredAt    time.Time
+	NextAttemptAt time.Time
+	DispatchedAt  sql.NullTime
+}
+
+type Draft struct {
+	ID        uuid.UUID
+	UserID    uuid.UUID
 	Body      string
+	PublishAt sql.NullTime
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+type EmailChange struct {
+	TokenHash string
 	UserID    uuid.UUID
+	NewEmail  string
+	CreatedAt time.Time
+	ExpiresAt time.Time
+}
+
+type LinkPreview struct {
+	Url         string
+	Title       string
+	Description string
+	ImageUrl    string
+	Failed      bool
+	FetchedAt   time.Time
+}
+
+type LoginFailure struct {
+	Email        string
+	Failures     int32
+	LastFailedAt time.Time
+	LockedUntil  sql.NullTime
+}
+
+type LoginIpAttempt struct {
+	ID          int64
+	Ip          string
+	AttemptedAt time.Time
+}
+
+type Message struct {
+	ID             uuid.UUID
+	ConversationID uuid.UUID
+	SenderID       uuid.UUID
+	Body           string
+	CreatedAt      time.Time
+}
+
+type Notification struct {
+	ID        uuid.UUID
+	UserID    uuid.UUID
+	Type      string
+	Data      json.RawMessage
+	CreatedAt time.Time
+	ReadAt    sql.NullTime
+}
+
+type NotificationPreference struct {
+	UserID  uuid.UUID
+	Type    string
+	Enabled bool
+}
+
+type Poll struct {
+	ChirpID   uuid.UUID
+	ClosesAt  time.Time
+	CreatedAt time.Time
+}
+
+type PollOption struct {
+	ID       uuid.UUID
+	ChirpID  uuid.UUID
+	Position int32
+	Label    string
+}
+
+type PollVote struct {
+	ChirpID   uuid.UUID
+	UserID    uuid.UUID
+	OptionID  uuid.UUID
+	CreatedAt time.Time
+}
+
+type RateLimitBucket struct {
+	Key       string
+	Tokens    float64
+	UpdatedAt time.Time
 }
 
 type RefreshToken struct {
@@ -28,11 +172,77 @@ type RefreshToken struct {
 	RevokedAt sql.NullTime
 }
 
+type Subscription struct {
+	UserID           uuid.UUID
+	Plan             string
+	Status           string
+	CurrentPeriodEnd sql.NullTime
+	CreatedAt        time.Time
+	UpdatedAt        time.Time
+	LastEventAt      sql.NullTime
+}
+
+type SubscriptionEvent struct {
+	ID               uuid.UUID
+	UserID           uuid.UUID
+	Event            string
+	Plan             string
+	Status           string
+	CurrentPeriodEnd sql.NullTime
+	OccurredAt       time.Time
+}
+
 type User struct {
+	ID               uuid.UUID
+	CreatedAt        time.Time
+	UpdatedAt        time.Time
+	Email            string
+	HashedPassword   string
+	IsChirpyRed      bool
+	DeletedAt        sql.NullTime
+	Handle           sql.NullString
+	DisplayName      string
+	Bio              string
+	AvatarUrl        string
+	AllowStrangerDms bool
+}
+
+type UserRelationship struct {
+	UserID    uuid.UUID
+	TargetID  uuid.UUID
+	Kind      string
+	CreatedAt time.Time
+}
+
+type WebhookDelivery struct {
 	ID             uuid.UUID
+	EndpointID     uuid.UUID
+	EventID        uuid.UUID
+	EventType      string
+	Payload        json.RawMessage
+	Status         string
+	Attempts       int32
+	NextAttemptAt  time.Time
+	LastAttemptAt  sql.NullTime
+	ResponseStatus sql.NullInt32
+	LastError      sql.NullString
 	CreatedAt      time.Time
-	UpdatedAt      time.Time
-	Email          string
-	HashedPassword string
-	IsChirpyRed    bool
+}
+
+type WebhookEndpoint struct {
+	ID         uuid.UUID
+	CreatedAt  time.Time
+	UpdatedAt  time.Time
+	UserID     uuid.UUID
+	Url        string
+	Secret     string
+	EventTypes []string
+	Active     bool
+}
+
+type WebhookReceipt struct {
+	Provider   string
+	DeliveryID string
+	Event      string
+	ReceivedAt time.Time
 }
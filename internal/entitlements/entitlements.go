@@ -0,0 +1,83 @@
+package entitlements
+
+import (
+	"slices"
+	"time"
+
+	"local/mda/internal/subscriptions"
+)
+
+// PlanFree is what users without an entitled subscription get.
+const PlanFree = "free"
+
+// Capability is a feature a plan either has or doesn't.
+type Capability string
+
+const (
+	// ScheduleChirps allows a publish_at in the future, up to
+	// Limits.MaxScheduleAhead.
+	ScheduleChirps Capability = "schedule_chirps"
+	// OutboundWebhooks allows registering webhook endpoints, up to
+	// Limits.MaxWebhookEndpoints.
+	OutboundWebhooks Capability = "outbound_webhooks"
+)
+
+// Limits are a plan's quotas. Zero means unlimited.
+type Limits struct {
+	// MaxChirpLength is in characters.
+	MaxChirpLength int
+	// ChirpsPerDay counts chirps created in the last 24 hours, scheduled
+	// ones included.
+	ChirpsPerDay        int
+	MaxScheduleAhead    time.Duration
+	MaxWebhookEndpoints int
+}
+
+type Plan struct {
+	Name         string
+	Capabilities []Capability
+	Limits       Limits
+}
+
+// Can reports whether the plan includes c.
+func (p Plan) Can(c Capability) bool {
+	return slices.Contains(p.Capabilities, c)
+}
+
+var plans = map[string]Plan{
+	PlanFree: {
+		Name:         PlanFree,
+		Capabilities: []Capability{ScheduleChirps},
+		Limits: Limits{
+			MaxChirpLength:   140,
+			ChirpsPerDay:     50,
+			MaxScheduleAhead: 30 * 24 * time.Hour,
+		},
+	},
+	subscriptions.PlanChirpyRed: {
+		Name:         subscriptions.PlanChirpyRed,
+		Capabilities: []Capability{ScheduleChirps, OutboundWebhooks},
+		Limits: Limits{
+			MaxChirpLength:      1000,
+			MaxScheduleAhead:    365 * 24 * time.Hour,
+			MaxWebhookEndpoints: 10,
+		},
+	},
+}
+
+// For returns the named plan, or the free plan for names it doesn't know.
+func For(name string) Plan {
+	if p, ok := plans[name]; ok {
+		return p
+	}
+	return plans[PlanFree]
+}
+
+// ForSubscription returns the plan s grants at now: its own while it is
+// entitled, the free plan otherwise.
+func ForSubscription(s subscriptions.State, now time.Time) Plan {
+	if !s.Entitled(now) {
+		return For(PlanFree)
+	}
+	return For(s.Plan)
+}
@@ -0,0 +1,103 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	ChirpCreated   = "chirp.created"
+	ChirpDeleted   = "chirp.deleted"
+	UserCreated    = "user.created"
+	UserUpdated    = "user.updated"
+	UserUpgraded   = "user.upgraded"
+	UserDowngraded = "user.downgraded"
+	UserDeleted    = "user.deleted"
+)
+
+// Event is something that happened to a resource. UserID is the user the
+// event concerns (for chirps, the author) and Payload is its JSON body as
+// served by the API.
+type Event struct {
+	ID         uuid.UUID       `json:"id"`
+	Type       string          `json:"type"`
+	UserID     uuid.UUID       `json:"user_id"`
+	OccurredAt time.Time       `json:"occurred_at"`
+	Payload    json.RawMessage `json:"payload"`
+	// Origin is the instance that published the event when it arrived from
+	// another instance through a Relay, and empty for local events.
+	Origin string `json:"-"`
+}
+
+// New builds an event, marshalling payload to JSON.
+func New(eventType string, userID uuid.UUID, payload any) (Event, error) {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return Event{}, err
+	}
+	return Event{
+		ID:         uuid.New(),
+		Type:       eventType,
+		UserID:     userID,
+		OccurredAt: time.Now().UTC(),
+		Payload:    data,
+	}, nil
+}
+
+// Handler reacts to an event. An error means the handler's work wasn't
+// done, and the dispatcher delivers the event again later.
+type Handler func(ctx context.Context, e Event) error
+
+// Bus fans events out to in-process subscribers. Handlers run synchronously
+// in the publisher's goroutine, so slow work should be handed off.
+type Bus struct {
+	mu       sync.RWMutex
+	handlers map[string][]Handler
+}
+
+func NewBus() *Bus {
+	return &Bus{handlers: make(map[string][]Handler)}
+}
+
+// Subscribe registers h for eventType, or for every event when eventType is
+// "*".
+func (b *Bus) Subscribe(eventType string, h Handler) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.handlers[eventType] = append(b.handlers[eventType], h)
+}
+
+// Publish delivers e to its subscribers and returns their errors joined. A
+// panicking handler counts as failed and does not stop delivery to the
+// others.
+func (b *Bus) Publish(ctx context.Context, e Event) error {
+	b.mu.RLock()
+	hs := make([]Handler, 0, len(b.handlers[e.Type])+len(b.handlers["*"]))
+	hs = append(hs, b.handlers[e.Type]...)
+	hs = append(hs, b.handlers["*"]...)
+	b.mu.RUnlock()
+
+	var errs []error
+	for _, h := range hs {
+		err := func() (err error) {
+			defer func() {
+				if r := recover(); r != nil {
+					log.Printf("event handler for %s panicked: %v", e.Type, r)
+					err = fmt.Errorf("event handler for %s panicked: %v", e.Type, r)
+				}
+			}()
+			return h(ctx, e)
+		}()
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
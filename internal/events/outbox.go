@@ -0,0 +1,188 @@
+package events
+
+import (
+	"context"
+	"database/sql"
+	"log"
+	"time"
+
+	"local/mda/internal/database"
+
+	"github.com/google/uuid"
+)
+
+// Record writes e to the domain_events outbox through q. Pass the
+// transaction's queries so the event commits or rolls back with the change
+// it describes.
+func Record(ctx context.Context, q *database.Queries, e Event) error {
+	return q.CreateDomainEvent(ctx, database.CreateDomainEventParams{
+		ID:         e.ID,
+		Type:       e.Type,
+		UserID:     e.UserID,
+		Payload:    e.Payload,
+		OccurredAt: e.OccurredAt,
+	})
+}
+
+// OutboxStore hands out recorded events for dispatch. Claim must not return
+// the same event to two callers until lease has passed, so a dispatcher
+// that dies mid-batch only delays its events.
+type OutboxStore interface {
+	Claim(ctx context.Context, now time.Time, lease time.Duration, limit int) ([]Event, error)
+	MarkDispatched(ctx context.Context, e Event, at time.Time) error
+	Prune(ctx context.Context, before time.Time) error
+}
+
+// PostgresOutbox reads the domain_events table. Claims use FOR UPDATE SKIP
+// LOCKED, so every instance can run a dispatcher.
+type PostgresOutbox struct {
+	q *database.Queries
+}
+
+func NewPostgresOutbox(q *database.Queries) *PostgresOutbox {
+	return &PostgresOutbox{q: q}
+}
+
+func (o *PostgresOutbox) Claim(ctx context.Context, now time.Time, lease time.Duration, limit int) ([]Event, error) {
+	rows, err := o.q.ClaimDomainEvents(ctx, database.ClaimDomainEventsParams{
+		LeaseUntil: now.Add(lease),
+		Now:        now,
+		BatchSize:  int32(limit),
+	})
+	if err != nil {
+		return nil, err
+	}
+	out := make([]Event, 0, len(rows))
+	for _, r := range rows {
+		out = append(out, Event{
+			ID:         r.ID,
+			Type:       r.Type,
+			UserID:     r.UserID,
+			OccurredAt: r.OccurredAt,
+			Payload:    r.Payload,
+		})
+	}
+	return out, nil
+}
+
+// Load reads a recorded event back, for relays receiving it by reference.
+func (o *PostgresOutbox) Load(ctx context.Context, id uuid.UUID) (Event, error) {
+	r, err := o.q.GetDomainEvent(ctx, id)
+	if err != nil {
+		return Event{}, err
+	}
+	return Event{
+		ID:         r.ID,
+		Type:       r.Type,
+		UserID:     r.UserID,
+		OccurredAt: r.OccurredAt,
+		Payload:    r.Payload,
+	}, nil
+}
+
+func (o *PostgresOutbox) MarkDispatched(ctx context.Context, e Event, at time.Time) error {
+	return o.q.MarkDomainEventDispatched(ctx, database.MarkDomainEventDispatchedParams{
+		ID:           e.ID,
+		DispatchedAt: sql.NullTime{Time: at, Valid: true},
+	})
+}
+
+func (o *PostgresOutbox) Prune(ctx context.Context, before time.Time) error {
+	_, err := o.q.PruneDomainEvents(ctx, sql.NullTime{Time: before, Valid: true})
+	return err
+}
+
+// Dispatcher publishes outbox events on the bus, oldest first, and marks
+// them dispatched once every handler has succeeded. Delivery is at least
+// once: an event a handler failed on, or whose instance fails before
+// marking it, is published again once its lease expires, so subscribers
+// must tolerate duplicates (Event.ID is stable).
+type Dispatcher struct {
+	store OutboxStore
+	bus   *Bus
+	kick  chan struct{}
+	now   func() time.Time
+
+	BatchSize int
+	Lease     time.Duration
+	// Retention is how long dispatched events are kept before pruning.
+	Retention time.Duration
+}
+
+func NewDispatcher(store OutboxStore, bus *Bus) *Dispatcher {
+	return &Dispatcher{
+		store:     store,
+		bus:       bus,
+		kick:      make(chan struct{}, 1),
+		now:       func() time.Time { return time.Now().UTC() },
+		BatchSize: 100,
+		Lease:     time.Minute,
+		Retention: 7 * 24 * time.Hour,
+	}
+}
+
+// WithClock replaces the time source, mainly for tests.
+func (d *Dispatcher) WithClock(now func() time.Time) *Dispatcher {
+	d.now = now
+	return d
+}
+
+// Kick asks Run to dispatch now rather than at its next tick; call it after
+// committing a transaction that recorded events. It never blocks.
+func (d *Dispatcher) Kick() {
+	select {
+	case d.kick <- struct{}{}:
+	default:
+	}
+}
+
+// Run dispatches every interval, and whenever kicked, until ctx is done.
+func (d *Dispatcher) Run(ctx context.Context, every time.Duration) {
+	ticker := time.NewTicker(every)
+	defer ticker.Stop()
+	lastPrune := d.now()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-d.kick:
+		}
+		if _, err := d.DispatchOnce(ctx); err != nil {
+			log.Printf("dispatching domain events: %s", err)
+		}
+		if now := d.now(); now.Sub(lastPrune) > time.Hour {
+			lastPrune = now
+			if err := d.store.Prune(ctx, now.Add(-d.Retention)); err != nil {
+				log.Printf("pruning domain events: %s", err)
+			}
+		}
+	}
+}
+
+// DispatchOnce publishes batches until none are due and returns how many
+// events it published.
+func (d *Dispatcher) DispatchOnce(ctx context.Context) (int, error) {
+	total := 0
+	for {
+		batch, err := d.store.Claim(ctx, d.now(), d.Lease, d.BatchSize)
+		if err != nil {
+			return total, err
+		}
+		for _, e := range batch {
+			total++
+			if err := d.bus.Publish(ctx, e); err != nil {
+				// left for another attempt after the lease
+				log.Printf("handling domain event %s: %s", e.ID, err)
+				continue
+			}
+			if err := d.store.MarkDispatched(ctx, e, d.now()); err != nil {
+				// it will be published again after the lease
+				log.Printf("marking domain event %s dispatched: %s", e.ID, err)
+			}
+		}
+		if len(batch) < d.BatchSize {
+			return total, nil
+		}
+	}
+}
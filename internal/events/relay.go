@@ -0,0 +1,170 @@
+package events
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+// maxNotifyPayload stays under Postgres' 8000 byte limit for NOTIFY payloads.
+const maxNotifyPayload = 7900
+
+// Relay carries events between instances over Postgres LISTEN/NOTIFY.
+// Forward sends events published on the local bus to the channel, and Run
+// republishes events from other instances on the local bus with Origin
+// set. Delivery is best effort: events sent while an instance is
+// disconnected from the database are lost to it.
+//
+// Events too large for a notification are sent by ID, and receivers load
+// them with the relay's EventLoader.
+type Relay struct {
+	db       *sql.DB
+	dsn      string
+	channel  string
+	bus      *Bus
+	loader   EventLoader
+	instance string
+}
+
+// EventLoader fetches a recorded event by ID. PostgresOutbox implements it.
+type EventLoader interface {
+	Load(ctx context.Context, id uuid.UUID) (Event, error)
+}
+
+// relayEnvelope carries either the whole Event or, when it is too large,
+// only its ID in Ref.
+type relayEnvelope struct {
+	Origin string     `json:"origin"`
+	Event  *Event     `json:"event,omitempty"`
+	Ref    *uuid.UUID `json:"ref,omitempty"`
+}
+
+// NewRelay relays bus events on channel. db sends notifications and dsn
+// opens the dedicated listening connection.
+func NewRelay(db *sql.DB, dsn, channel string, bus *Bus) *Relay {
+	return &Relay{
+		db:       db,
+		dsn:      dsn,
+		channel:  channel,
+		bus:      bus,
+		instance: uuid.NewString(),
+	}
+}
+
+// WithLoader sets where events sent by reference are loaded from.
+func (r *Relay) WithLoader(l EventLoader) *Relay {
+	r.loader = l
+	return r
+}
+
+// Instance identifies this process on the channel.
+func (r *Relay) Instance() string {
+	return r.instance
+}
+
+// Forward is a Handler that notifies other instances of local events;
+// subscribe it for "*". Events that came from another instance are not
+// sent back. Relaying is best effort, so failures are logged rather than
+// returned.
+func (r *Relay) Forward(ctx context.Context, e Event) error {
+	if e.Origin != "" {
+		return nil
+	}
+	payload, err := r.Encode(e)
+	if err != nil {
+		log.Printf("relaying %s event: %s", e.Type, err)
+		return nil
+	}
+	// events are published after the request's work is committed, so
+	// finish sending even if the client has gone away
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 5*time.Second)
+	defer cancel()
+	if _, err := r.db.ExecContext(ctx, "SELECT pg_notify($1, $2)", r.channel, payload); err != nil {
+		log.Printf("relaying %s event: %s", e.Type, err)
+	}
+	return nil
+}
+
+// Encode wraps e in the envelope sent on the channel, replacing it with a
+// reference when it doesn't fit in a notification.
+func (r *Relay) Encode(e Event) (string, error) {
+	data, err := json.Marshal(relayEnvelope{Origin: r.instance, Event: &e})
+	if err != nil {
+		return "", err
+	}
+	if len(data) > maxNotifyPayload {
+		data, err = json.Marshal(relayEnvelope{Origin: r.instance, Ref: &e.ID})
+		if err != nil {
+			return "", err
+		}
+	}
+	return string(data), nil
+}
+
+// Receive publishes an envelope from the channel on the local bus. Its own
+// notifications, which Postgres delivers back to it too, are ignored.
+func (r *Relay) Receive(ctx context.Context, payload string) error {
+	var env relayEnvelope
+	if err := json.Unmarshal([]byte(payload), &env); err != nil {
+		return fmt.Errorf("decoding relayed event: %w", err)
+	}
+	if env.Origin == "" || env.Origin == r.instance {
+		return nil
+	}
+	var e Event
+	switch {
+	case env.Event != nil:
+		e = *env.Event
+	case env.Ref != nil && r.loader != nil:
+		loaded, err := r.loader.Load(ctx, *env.Ref)
+		if err != nil {
+			return fmt.Errorf("loading relayed event %s: %w", *env.Ref, err)
+		}
+		e = loaded
+	case env.Ref != nil:
+		return fmt.Errorf("relayed event %s was sent by reference and there is no loader", *env.Ref)
+	default:
+		return errors.New("relayed envelope has no event")
+	}
+	e.Origin = env.Origin
+	return r.bus.Publish(ctx, e)
+}
+
+// Run listens on the channel until ctx is done, reconnecting as needed.
+func (r *Relay) Run(ctx context.Context) error {
+	listener := pq.NewListener(r.dsn, 10*time.Second, time.Minute, func(ev pq.ListenerEventType, err error) {
+		if err != nil {
+			log.Printf("event relay listener: %s", err)
+		}
+	})
+	defer listener.Close()
+	if err := listener.Listen(r.channel); err != nil {
+		return fmt.Errorf("listening on %s: %w", r.channel, err)
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case n := <-listener.Notify:
+			if n == nil {
+				// the connection was re-established; anything sent in the
+				// meantime is gone
+				log.Printf("event relay reconnected, remote events may have been missed")
+				continue
+			}
+			if err := r.Receive(ctx, n.Extra); err != nil {
+				log.Println(err)
+			}
+		case <-time.After(90 * time.Second):
+			go listener.Ping()
+		}
+	}
+}
@@ -0,0 +1,168 @@
+package linkpreview
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+)
+
+type Preview struct {
+	URL         string
+	Title       string
+	Description string
+	ImageURL    string
+	// Failed marks URLs that could not be previewed, so they are not
+	// retried on every request.
+	Failed    bool
+	FetchedAt time.Time
+}
+
+var urlRe = regexp.MustCompile(`https?://[^\s<>"]+`)
+
+// ExtractURL returns the first http(s) URL in text, without trailing
+// punctuation.
+func ExtractURL(text string) (string, bool) {
+	match := urlRe.FindString(text)
+	if match == "" {
+		return "", false
+	}
+	match = strings.TrimRight(match, ".,;:!?)]}'")
+	u, err := url.Parse(match)
+	if err != nil || u.Host == "" {
+		return "", false
+	}
+	return match, true
+}
+
+// Fetcher downloads pages and reads their OpenGraph metadata.
+type Fetcher struct {
+	client   *http.Client
+	maxBytes int64
+}
+
+func NewFetcher(client *http.Client) *Fetcher {
+	return &Fetcher{client: client, maxBytes: 512 << 10}
+}
+
+func (f *Fetcher) Fetch(ctx context.Context, rawURL string) (Preview, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+		return Preview{}, fmt.Errorf("unsupported url: %q", rawURL)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+	if err != nil {
+		return Preview{}, err
+	}
+	req.Header.Set("User-Agent", "ChirpyBot/1.0 (+link preview)")
+	req.Header.Set("Accept", "text/html")
+
+	resp, err := f.client.Do(req)
+	if err != nil {
+		return Preview{}, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return Preview{}, fmt.Errorf("unexpected status: %s", resp.Status)
+	}
+	mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	if mediaType != "text/html" {
+		return Preview{}, fmt.Errorf("not an html page: %s", mediaType)
+	}
+
+	page, err := io.ReadAll(io.LimitReader(resp.Body, f.maxBytes))
+	if err != nil {
+		return Preview{}, err
+	}
+
+	p := ParseOpenGraph(string(page), resp.Request.URL)
+	p.URL = rawURL
+	if p.Title == "" && p.Description == "" {
+		return Preview{}, errors.New("page has no preview metadata")
+	}
+	return p, nil
+}
+
+var (
+	metaRe  = regexp.MustCompile(`(?is)<meta\s+([^>]*)>`)
+	attrRe  = regexp.MustCompile(`(?is)([a-z][a-z0-9:_-]*)\s*=\s*(?:"([^"]*)"|'([^']*)'|([^\s"'>]+))`)
+	titleRe = regexp.MustCompile(`(?is)<title[^>]*>(.*?)</title>`)
+)
+
+// ParseOpenGraph reads og:title, og:description and og:image from a page,
+// falling back to <title> and the description meta tag. Relative image URLs
+// are resolved against base.
+func ParseOpenGraph(page string, base *url.URL) Preview {
+	var p Preview
+	var fallbackDescription string
+
+	for _, m := range metaRe.FindAllStringSubmatch(page, -1) {
+		attrs := make(map[string]string)
+		for _, a := range attrRe.FindAllStringSubmatch(m[1], -1) {
+			attrs[strings.ToLower(a[1])] = a[2] + a[3] + a[4]
+		}
+		key := attrs["property"]
+		if key == "" {
+			key = attrs["name"]
+		}
+		content := clean(attrs["content"], 300)
+
+		switch strings.ToLower(key) {
+		case "og:title":
+			p.Title = clean(content, 200)
+		case "og:description":
+			p.Description = content
+		case "og:image", "og:image:url":
+			if p.ImageURL == "" {
+				p.ImageURL = resolve(base, attrs["content"])
+			}
+		case "description":
+			fallbackDescription = content
+		}
+	}
+
+	if p.Title == "" {
+		if m := titleRe.FindStringSubmatch(page); m != nil {
+			p.Title = clean(m[1], 200)
+		}
+	}
+	if p.Description == "" {
+		p.Description = fallbackDescription
+	}
+	return p
+}
+
+func clean(s string, max int) string {
+	s = strings.Join(strings.Fields(html.UnescapeString(s)), " ")
+	if r := []rune(s); len(r) > max {
+		s = string(r[:max-1]) + "…"
+	}
+	return s
+}
+
+func resolve(base *url.URL, ref string) string {
+	ref = strings.TrimSpace(html.UnescapeString(ref))
+	if ref == "" {
+		return ""
+	}
+	u, err := url.Parse(ref)
+	if err != nil {
+		return ""
+	}
+	if base != nil {
+		u = base.ResolveReference(u)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return ""
+	}
+	return u.String()
+}
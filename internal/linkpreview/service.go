@@ -0,0 +1,99 @@
+package linkpreview
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+)
+
+// Store caches previews by URL.
+type Store interface {
+	// Get returns ok=false if the URL has never been fetched.
+	Get(ctx context.Context, url string) (p Preview, ok bool, err error)
+	Put(ctx context.Context, p Preview) error
+}
+
+// Service fetches previews in the background so chirp creation never waits
+// on a third-party site.
+type Service struct {
+	fetcher *Fetcher
+	store   Store
+	ttl     time.Duration
+	queue   chan string
+
+	mu       sync.Mutex
+	inflight map[string]bool
+}
+
+func NewService(fetcher *Fetcher, store Store, ttl time.Duration) *Service {
+	return &Service{
+		fetcher:  fetcher,
+		store:    store,
+		ttl:      ttl,
+		queue:    make(chan string, 256),
+		inflight: make(map[string]bool),
+	}
+}
+
+// Run processes queued URLs with the given number of workers until ctx is done.
+func (s *Service) Run(ctx context.Context, workers int) {
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case u := <-s.queue:
+					if _, err := s.Resolve(ctx, u); err != nil {
+						log.Printf("link preview for %s: %s", u, err)
+					}
+					s.mu.Lock()
+					delete(s.inflight, u)
+					s.mu.Unlock()
+				}
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+// Enqueue schedules a fetch. It never blocks; when the queue is full the URL
+// is dropped and picked up again the next time it is posted.
+func (s *Service) Enqueue(url string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.inflight[url] {
+		return
+	}
+	select {
+	case s.queue <- url:
+		s.inflight[url] = true
+	default:
+	}
+}
+
+// Resolve returns the cached preview, fetching it first if it is missing or
+// older than the TTL. Failed fetches are cached too.
+func (s *Service) Resolve(ctx context.Context, url string) (Preview, error) {
+	cached, ok, err := s.store.Get(ctx, url)
+	if err != nil {
+		return Preview{}, err
+	}
+	if ok && time.Since(cached.FetchedAt) < s.ttl {
+		return cached, nil
+	}
+
+	p, fetchErr := s.fetcher.Fetch(ctx, url)
+	if fetchErr != nil {
+		p = Preview{URL: url, Failed: true}
+	}
+	p.FetchedAt = time.Now().UTC()
+	if err := s.store.Put(ctx, p); err != nil {
+		return Preview{}, err
+	}
+	return p, fetchErr
+}
@@ -0,0 +1,75 @@
+package linkpreview
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"sync"
+
+	"local/mda/internal/database"
+)
+
+type MemoryStore struct {
+	mu       sync.Mutex
+	previews map[string]Preview
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{previews: make(map[string]Preview)}
+}
+
+func (s *MemoryStore) Get(ctx context.Context, url string) (Preview, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	p, ok := s.previews[url]
+	return p, ok, nil
+}
+
+func (s *MemoryStore) Put(ctx context.Context, p Preview) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.previews[p.URL] = p
+	return nil
+}
+
+// PostgresStore caches previews in the link_previews table.
+type PostgresStore struct {
+	db *database.Queries
+}
+
+func NewPostgresStore(db *database.Queries) *PostgresStore {
+	return &PostgresStore{db: db}
+}
+
+func (s *PostgresStore) Get(ctx context.Context, url string) (Preview, bool, error) {
+	row, err := s.db.GetLinkPreview(ctx, url)
+	if errors.Is(err, sql.ErrNoRows) {
+		return Preview{}, false, nil
+	}
+	if err != nil {
+		return Preview{}, false, err
+	}
+	return FromRow(row), true, nil
+}
+
+func (s *PostgresStore) Put(ctx context.Context, p Preview) error {
+	return s.db.UpsertLinkPreview(ctx, database.UpsertLinkPreviewParams{
+		Url:         p.URL,
+		Title:       p.Title,
+		Description: p.Description,
+		ImageUrl:    p.ImageURL,
+		Failed:      p.Failed,
+		FetchedAt:   p.FetchedAt,
+	})
+}
+
+func FromRow(row database.LinkPreview) Preview {
+	return Preview{
+		URL:         row.Url,
+		Title:       row.Title,
+		Description: row.Description,
+		ImageURL:    row.ImageUrl,
+		Failed:      row.Failed,
+		FetchedAt:   row.FetchedAt,
+	}
+}
@@ -0,0 +1,187 @@
+package lockout
+
+import (
+	"context"
+	"strings"
+	"time"
+)
+
+// AccountState is the failed-login bookkeeping kept for a single email.
+type AccountState struct {
+	Failures     int
+	LastFailedAt time.Time
+	LockedUntil  time.Time
+}
+
+// Store persists failed login attempts. Implementations must be safe for
+// concurrent use.
+type Store interface {
+	// GetAccount returns the zero AccountState when nothing is recorded.
+	GetAccount(ctx context.Context, email string) (AccountState, error)
+	// AddAccountFailure counts a failure at at and returns the new total.
+	// The count starts over when the previous failure was before
+	// resetBefore. It must be atomic, so concurrent failures all count.
+	AddAccountFailure(ctx context.Context, email string, at, resetBefore time.Time) (int, error)
+	// LockAccount locks email until until, unless it is already locked for
+	// longer.
+	LockAccount(ctx context.Context, email string, until time.Time) error
+	DeleteAccount(ctx context.Context, email string) error
+
+	AddIPFailure(ctx context.Context, ip string, at time.Time) error
+	// IPFailures returns the failures recorded for ip after since, oldest first.
+	IPFailures(ctx context.Context, ip string, since time.Time) ([]time.Time, error)
+	PruneIPFailures(ctx context.Context, ip string, before time.Time) error
+}
+
+type Policy struct {
+	// Failures allowed before any delay is applied.
+	FreeAttempts int
+	// Delay after the first failure past FreeAttempts, doubled for every
+	// further failure up to MaxDelay.
+	BaseDelay time.Duration
+	MaxDelay  time.Duration
+	// Once an account reaches LockoutThreshold failures it is locked for
+	// LockoutDuration.
+	LockoutThreshold int
+	LockoutDuration  time.Duration
+	// Failures older than ResetAfter are forgotten.
+	ResetAfter time.Duration
+
+	// At most IPMaxFailures failures per IPWindow from the same client.
+	IPWindow      time.Duration
+	IPMaxFailures int
+}
+
+func DefaultPolicy() Policy {
+	return Policy{
+		FreeAttempts:     3,
+		BaseDelay:        time.Second,
+		MaxDelay:         5 * time.Minute,
+		LockoutThreshold: 10,
+		LockoutDuration:  15 * time.Minute,
+		ResetAfter:       time.Hour,
+		IPWindow:         15 * time.Minute,
+		IPMaxFailures:    50,
+	}
+}
+
+// Guard decides whether a login attempt may proceed.
+type Guard struct {
+	store  Store
+	policy Policy
+	now    func() time.Time
+}
+
+func NewGuard(store Store, policy Policy) *Guard {
+	return &Guard{
+		store:  store,
+		policy: policy,
+		now:    func() time.Time { return time.Now().UTC() },
+	}
+}
+
+// WithClock replaces the time source, mainly for tests.
+func (g *Guard) WithClock(now func() time.Time) *Guard {
+	g.now = now
+	return g
+}
+
+// Check returns how long the caller has to wait before trying again, or zero
+// if the attempt may go ahead.
+func (g *Guard) Check(ctx context.Context, email, ip string) (time.Duration, error) {
+	now := g.now()
+
+	state, err := g.store.GetAccount(ctx, normalizeEmail(email))
+	if err != nil {
+		return 0, err
+	}
+	wait := state.LockedUntil.Sub(now)
+
+	if ip != "" && g.policy.IPMaxFailures > 0 {
+		failures, err := g.store.IPFailures(ctx, ip, now.Add(-g.policy.IPWindow))
+		if err != nil {
+			return 0, err
+		}
+		if len(failures) >= g.policy.IPMaxFailures {
+			// The window frees up a slot once the oldest counted failure ages out.
+			oldest := failures[len(failures)-g.policy.IPMaxFailures]
+			if ipWait := oldest.Add(g.policy.IPWindow).Sub(now); ipWait > wait {
+				wait = ipWait
+			}
+		}
+	}
+
+	if wait < 0 {
+		return 0, nil
+	}
+	return wait, nil
+}
+
+// RecordFailure registers a failed attempt and returns the delay now imposed
+// on the account. Pass an empty email when no account matched: only the IP
+// is charged then, so guessing at addresses neither fills the store nor
+// locks anyone out.
+func (g *Guard) RecordFailure(ctx context.Context, email, ip string) (time.Duration, error) {
+	now := g.now()
+	key := normalizeEmail(email)
+
+	var delay time.Duration
+	if key != "" {
+		var resetBefore time.Time
+		if g.policy.ResetAfter > 0 {
+			resetBefore = now.Add(-g.policy.ResetAfter)
+		}
+		failures, err := g.store.AddAccountFailure(ctx, key, now, resetBefore)
+		if err != nil {
+			return 0, err
+		}
+		delay = g.delayFor(failures)
+		if delay > 0 {
+			if err := g.store.LockAccount(ctx, key, now.Add(delay)); err != nil {
+				return 0, err
+			}
+		}
+	}
+
+	if ip != "" && g.policy.IPMaxFailures > 0 {
+		if err := g.store.AddIPFailure(ctx, ip, now); err != nil {
+			return 0, err
+		}
+		if err := g.store.PruneIPFailures(ctx, ip, now.Add(-g.policy.IPWindow)); err != nil {
+			return 0, err
+		}
+	}
+
+	return delay, nil
+}
+
+// RecordSuccess clears the failure history of the account.
+func (g *Guard) RecordSuccess(ctx context.Context, email string) error {
+	return g.store.DeleteAccount(ctx, normalizeEmail(email))
+}
+
+func (g *Guard) delayFor(failures int) time.Duration {
+	if g.policy.LockoutThreshold > 0 && failures >= g.policy.LockoutThreshold {
+		return g.policy.LockoutDuration
+	}
+	over := failures - g.policy.FreeAttempts
+	if over <= 0 || g.policy.BaseDelay <= 0 {
+		return 0
+	}
+
+	delay := g.policy.BaseDelay
+	for i := 1; i < over; i++ {
+		delay *= 2
+		if g.policy.MaxDelay > 0 && delay >= g.policy.MaxDelay {
+			return g.policy.MaxDelay
+		}
+	}
+	if g.policy.MaxDelay > 0 && delay > g.policy.MaxDelay {
+		return g.policy.MaxDelay
+	}
+	return delay
+}
+
+func normalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
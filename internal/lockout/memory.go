@@ -0,0 +1,97 @@
+package lockout
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// MemoryStore keeps attempts in process memory. State is lost on restart and
+// is not shared between instances.
+type MemoryStore struct {
+	mu       sync.Mutex
+	accounts map[string]AccountState
+	ips      map[string][]time.Time
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		accounts: make(map[string]AccountState),
+		ips:      make(map[string][]time.Time),
+	}
+}
+
+func (s *MemoryStore) GetAccount(ctx context.Context, email string) (AccountState, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.accounts[email], nil
+}
+
+func (s *MemoryStore) AddAccountFailure(ctx context.Context, email string, at, resetBefore time.Time) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	state := s.accounts[email]
+	if state.LastFailedAt.Before(resetBefore) {
+		state = AccountState{}
+	}
+	state.Failures++
+	state.LastFailedAt = at
+	s.accounts[email] = state
+	return state.Failures, nil
+}
+
+func (s *MemoryStore) LockAccount(ctx context.Context, email string, until time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	state, ok := s.accounts[email]
+	if ok && until.After(state.LockedUntil) {
+		state.LockedUntil = until
+		s.accounts[email] = state
+	}
+	return nil
+}
+
+func (s *MemoryStore) DeleteAccount(ctx context.Context, email string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.accounts, email)
+	return nil
+}
+
+func (s *MemoryStore) AddIPFailure(ctx context.Context, ip string, at time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.ips[ip] = append(s.ips[ip], at)
+	return nil
+}
+
+func (s *MemoryStore) IPFailures(ctx context.Context, ip string, since time.Time) ([]time.Time, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var out []time.Time
+	for _, at := range s.ips[ip] {
+		if at.After(since) {
+			out = append(out, at)
+		}
+	}
+	return out, nil
+}
+
+func (s *MemoryStore) PruneIPFailures(ctx context.Context, ip string, before time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	kept := s.ips[ip][:0]
+	for _, at := range s.ips[ip] {
+		if !at.Before(before) {
+			kept = append(kept, at)
+		}
+	}
+	if len(kept) == 0 {
+		delete(s.ips, ip)
+		return nil
+	}
+	s.ips[ip] = kept
+	return nil
+}
@@ -0,0 +1,82 @@
+package lockout
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"local/mda/internal/database"
+)
+
+// PostgresStore keeps attempts in the login_failures and login_ip_attempts
+// tables so that every instance sees the same counters.
+type PostgresStore struct {
+	db *database.Queries
+}
+
+func NewPostgresStore(db *database.Queries) *PostgresStore {
+	return &PostgresStore{db: db}
+}
+
+func (s *PostgresStore) GetAccount(ctx context.Context, email string) (AccountState, error) {
+	row, err := s.db.GetLoginFailure(ctx, email)
+	if errors.Is(err, sql.ErrNoRows) {
+		return AccountState{}, nil
+	}
+	if err != nil {
+		return AccountState{}, err
+	}
+
+	state := AccountState{
+		Failures:     int(row.Failures),
+		LastFailedAt: row.LastFailedAt,
+	}
+	if row.LockedUntil.Valid {
+		state.LockedUntil = row.LockedUntil.Time
+	}
+	return state, nil
+}
+
+// AddAccountFailure increments the counter in the upsert itself, so
+// concurrent failures each count.
+func (s *PostgresStore) AddAccountFailure(ctx context.Context, email string, at, resetBefore time.Time) (int, error) {
+	n, err := s.db.AddLoginFailure(ctx, database.AddLoginFailureParams{
+		Email:       email,
+		FailedAt:    at,
+		ResetBefore: resetBefore,
+	})
+	return int(n), err
+}
+
+func (s *PostgresStore) LockAccount(ctx context.Context, email string, until time.Time) error {
+	return s.db.ExtendLoginLock(ctx, database.ExtendLoginLockParams{
+		LockedUntil: until,
+		Email:       email,
+	})
+}
+
+func (s *PostgresStore) DeleteAccount(ctx context.Context, email string) error {
+	return s.db.DeleteLoginFailure(ctx, email)
+}
+
+func (s *PostgresStore) AddIPFailure(ctx context.Context, ip string, at time.Time) error {
+	return s.db.CreateLoginIPAttempt(ctx, database.CreateLoginIPAttemptParams{
+		Ip:          ip,
+		AttemptedAt: at,
+	})
+}
+
+func (s *PostgresStore) IPFailures(ctx context.Context, ip string, since time.Time) ([]time.Time, error) {
+	return s.db.ListLoginIPAttemptsSince(ctx, database.ListLoginIPAttemptsSinceParams{
+		Ip:          ip,
+		AttemptedAt: since,
+	})
+}
+
+func (s *PostgresStore) PruneIPFailures(ctx context.Context, ip string, before time.Time) error {
+	return s.db.DeleteLoginIPAttemptsBefore(ctx, database.DeleteLoginIPAttemptsBeforeParams{
+		Ip:          ip,
+		AttemptedAt: before,
+	})
+}
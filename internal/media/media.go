@@ -0,0 +1,208 @@
+package media
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"net/http"
+)
+
+var (
+	ErrTooLarge        = errors.New("file is too large")
+	ErrUnsupportedType = errors.New("unsupported media type")
+	ErrTooManyPixels   = errors.New("image dimensions are too large")
+)
+
+type Limits struct {
+	MaxBytes     int64
+	MaxPixels    int
+	ThumbnailMax int // longest edge of the thumbnail, in pixels
+}
+
+func DefaultLimits() Limits {
+	return Limits{
+		MaxBytes:     5 << 20,
+		MaxPixels:    40_000_000,
+		ThumbnailMax: 320,
+	}
+}
+
+// Processed is an upload ready to store: re-encoded without metadata, plus
+// a thumbnail.
+type Processed struct {
+	ContentType string
+	Ext         string
+	Data        []byte
+	Width       int
+	Height      int
+
+	ThumbnailType string
+	ThumbnailExt  string
+	Thumbnail     []byte
+}
+
+// Process sniffs the upload's real type, rejects anything that is not a
+// JPEG, PNG or GIF, and re-encodes it. Re-encoding drops EXIF and any other
+// embedded metadata, such as GPS coordinates.
+func Process(data []byte, limits Limits) (Processed, error) {
+	if int64(len(data)) > limits.MaxBytes {
+		return Processed{}, ErrTooLarge
+	}
+
+	contentType := http.DetectContentType(data)
+	switch contentType {
+	case "image/jpeg", "image/png", "image/gif":
+	default:
+		return Processed{}, fmt.Errorf("%w: %s", ErrUnsupportedType, contentType)
+	}
+
+	// check dimensions before decoding to avoid decompression bombs
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return Processed{}, fmt.Errorf("%w: %s", ErrUnsupportedType, err)
+	}
+	if cfg.Width*cfg.Height > limits.MaxPixels {
+		return Processed{}, ErrTooManyPixels
+	}
+
+	out := Processed{
+		ContentType: contentType,
+		Width:       cfg.Width,
+		Height:      cfg.Height,
+	}
+
+	var (
+		buf   bytes.Buffer
+		first image.Image
+	)
+	switch contentType {
+	case "image/jpeg":
+		img, err := jpeg.Decode(bytes.NewReader(data))
+		if err != nil {
+			return Processed{}, err
+		}
+		if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: 90}); err != nil {
+			return Processed{}, err
+		}
+		out.Ext = "jpg"
+		first = img
+	case "image/png":
+		img, err := png.Decode(bytes.NewReader(data))
+		if err != nil {
+			return Processed{}, err
+		}
+		if err := png.Encode(&buf, img); err != nil {
+			return Processed{}, err
+		}
+		out.Ext = "png"
+		first = img
+	case "image/gif":
+		// DecodeConfig only sees the first frame; every frame can be as
+		// large as the canvas, so bound the whole animation before decoding
+		frames, err := gifFrameCount(data)
+		if err != nil {
+			return Processed{}, fmt.Errorf("%w: %s", ErrUnsupportedType, err)
+		}
+		if frames*cfg.Width*cfg.Height > limits.MaxPixels {
+			return Processed{}, ErrTooManyPixels
+		}
+
+		// keep the animation, drop comments and application extensions
+		anim, err := gif.DecodeAll(bytes.NewReader(data))
+		if err != nil {
+			return Processed{}, err
+		}
+		if len(anim.Image) == 0 {
+			return Processed{}, fmt.Errorf("%w: empty gif", ErrUnsupportedType)
+		}
+		if err := gif.EncodeAll(&buf, anim); err != nil {
+			return Processed{}, err
+		}
+		out.Ext = "gif"
+		first = anim.Image[0]
+	}
+	out.Data = buf.Bytes()
+
+	thumb := Thumbnail(first, limits.ThumbnailMax)
+	var tbuf bytes.Buffer
+	if contentType == "image/jpeg" {
+		err = jpeg.Encode(&tbuf, thumb, &jpeg.Options{Quality: 80})
+		out.ThumbnailType, out.ThumbnailExt = "image/jpeg", "jpg"
+	} else {
+		// PNG keeps transparency from PNG and GIF sources
+		err = png.Encode(&tbuf, thumb)
+		out.ThumbnailType, out.ThumbnailExt = "image/png", "png"
+	}
+	if err != nil {
+		return Processed{}, err
+	}
+	out.Thumbnail = tbuf.Bytes()
+
+	return out, nil
+}
+
+var errMalformedGIF = errors.New("malformed gif")
+
+// gifFrameCount counts the image descriptors in a GIF by walking its block
+// structure, without decompressing any frame.
+func gifFrameCount(data []byte) (int, error) {
+	// header (6) and logical screen descriptor (7)
+	if len(data) < 13 {
+		return 0, errMalformedGIF
+	}
+	pos := 13
+	if flags := data[10]; flags&0x80 != 0 {
+		pos += 3 << ((flags & 0x07) + 1)
+	}
+
+	// skipSubBlocks moves pos past a run of data sub-blocks
+	skipSubBlocks := func() error {
+		for {
+			if pos >= len(data) {
+				return errMalformedGIF
+			}
+			n := int(data[pos])
+			pos += 1 + n
+			if n == 0 {
+				return nil
+			}
+		}
+	}
+
+	frames := 0
+	for {
+		if pos >= len(data) {
+			return 0, errMalformedGIF
+		}
+		switch data[pos] {
+		case 0x21: // extension: introducer, label, sub-blocks
+			pos += 2
+			if err := skipSubBlocks(); err != nil {
+				return 0, err
+			}
+		case 0x2C: // image descriptor
+			if pos+10 > len(data) {
+				return 0, errMalformedGIF
+			}
+			flags := data[pos+9]
+			pos += 10
+			if flags&0x80 != 0 {
+				pos += 3 << ((flags & 0x07) + 1)
+			}
+			// LZW minimum code size, then the image data
+			pos++
+			if err := skipSubBlocks(); err != nil {
+				return 0, err
+			}
+			frames++
+		case 0x3B: // trailer
+			return frames, nil
+		default:
+			return 0, errMalformedGIF
+		}
+	}
+}
@@ -0,0 +1,52 @@
+package media
+
+import (
+	"image"
+	"image/color"
+)
+
+// Thumbnail scales img down so its longest edge is at most maxEdge, averaging
+// the source pixels that fall into each destination pixel. Images already
+// small enough are copied unchanged.
+func Thumbnail(img image.Image, maxEdge int) image.Image {
+	b := img.Bounds()
+	sw, sh := b.Dx(), b.Dy()
+
+	dw, dh := sw, sh
+	if sw > maxEdge || sh > maxEdge {
+		if sw >= sh {
+			dw, dh = maxEdge, max(1, sh*maxEdge/sw)
+		} else {
+			dw, dh = max(1, sw*maxEdge/sh), maxEdge
+		}
+	}
+
+	dst := image.NewNRGBA64(image.Rect(0, 0, dw, dh))
+	for y := 0; y < dh; y++ {
+		y0 := b.Min.Y + y*sh/dh
+		y1 := max(y0+1, b.Min.Y+(y+1)*sh/dh)
+		for x := 0; x < dw; x++ {
+			x0 := b.Min.X + x*sw/dw
+			x1 := max(x0+1, b.Min.X+(x+1)*sw/dw)
+
+			var r, g, bl, a, n uint64
+			for sy := y0; sy < y1; sy++ {
+				for sx := x0; sx < x1; sx++ {
+					c := color.NRGBA64Model.Convert(img.At(sx, sy)).(color.NRGBA64)
+					r += uint64(c.R)
+					g += uint64(c.G)
+					bl += uint64(c.B)
+					a += uint64(c.A)
+					n++
+				}
+			}
+			dst.SetNRGBA64(x, y, color.NRGBA64{
+				R: uint16(r / n),
+				G: uint16(g / n),
+				B: uint16(bl / n),
+				A: uint16(a / n),
+			})
+		}
+	}
+	return dst
+}
@@ -0,0 +1,78 @@
+package notifications
+
+import (
+	"context"
+	"encoding/json"
+	"slices"
+	"time"
+
+	"local/mda/internal/database"
+
+	"github.com/google/uuid"
+)
+
+// Notification types. Users can switch each one off in their preferences.
+const (
+	// BookmarkedChirpDeleted tells users that a chirp they saved is gone.
+	BookmarkedChirpDeleted = "bookmarked_chirp_deleted"
+	// AccountUpdated is a security notice for email and password changes.
+	AccountUpdated = "account_updated"
+	// ChirpyRedActivated confirms a Chirpy Red upgrade.
+	ChirpyRedActivated = "chirpy_red_activated"
+	// ChirpyRedEnded says a Chirpy Red subscription has run out.
+	ChirpyRedEnded = "chirpy_red_ended"
+	// PaymentFailed asks the user to fix their payment details before the
+	// grace period is over.
+	PaymentFailed = "payment_failed"
+)
+
+// Types lists every notification type, in the order preferences are shown.
+var Types = []string{
+	BookmarkedChirpDeleted,
+	AccountUpdated,
+	ChirpyRedActivated,
+	ChirpyRedEnded,
+	PaymentFailed,
+}
+
+func Known(kind string) bool {
+	return slices.Contains(Types, kind)
+}
+
+// Notify records a notification for userID unless they have turned the type
+// off. Pass queries bound to the caller's transaction so the notification
+// commits or rolls back together with the change it describes.
+func Notify(ctx context.Context, q *database.Queries, userID uuid.UUID, kind string, data any) error {
+	if data == nil {
+		data = struct{}{}
+	}
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	_, err = q.CreateNotification(ctx, database.CreateNotificationParams{
+		UserID: userID,
+		Type:   kind,
+		Data:   payload,
+	})
+	return err
+}
+
+type ReadQueries interface {
+	MarkNotificationsRead(ctx context.Context, arg database.MarkNotificationsReadParams) (int64, error)
+}
+
+// MarkRead marks ids read for userID, or all of their unread notifications
+// when ids is nil. An empty, non-nil ids marks nothing.
+func MarkRead(ctx context.Context, q ReadQueries, userID uuid.UUID, ids []uuid.UUID, now time.Time) (int64, error) {
+	if ids != nil && len(ids) == 0 {
+		return 0, nil
+	}
+	return q.MarkNotificationsRead(ctx, database.MarkNotificationsReadParams{
+		ReadAt:  now,
+		UserID:  userID,
+		MarkAll: ids == nil,
+		// a nil slice binds as NULL; keep the parameter an array
+		Ids: append([]uuid.UUID{}, ids...),
+	})
+}
@@ -0,0 +1,49 @@
+package paging
+
+import (
+	"database/sql"
+	"errors"
+	"net/url"
+	"strconv"
+)
+
+const MaxLimit = 100
+
+// Params are the list options shared by paginated endpoints: sort=desc
+// (anything else is ascending), limit and offset. A Limit of 0 means the
+// request didn't set one.
+type Params struct {
+	Desc   bool
+	Limit  int
+	Offset int
+}
+
+func Parse(q url.Values) (Params, error) {
+	p := Params{Desc: q.Get("sort") == "desc"}
+	if v := q.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > MaxLimit {
+			return Params{}, errors.New("limit must be between 1 and 100")
+		}
+		p.Limit = n
+	}
+	if v := q.Get("offset"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			return Params{}, errors.New("offset must be a non-negative integer")
+		}
+		p.Offset = n
+	}
+	return p, nil
+}
+
+// SQLLimit is Limit as a LIMIT argument. Without a limit it is NULL, which
+// Postgres reads as no limit, for endpoints that return everything by
+// default.
+func (p Params) SQLLimit() sql.NullInt32 {
+	return sql.NullInt32{Int32: int32(p.Limit), Valid: p.Limit > 0}
+}
+
+func (p Params) SQLOffset() int32 {
+	return int32(p.Offset)
+}
@@ -0,0 +1,165 @@
+package polls
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"local/mda/internal/chirps"
+	"local/mda/internal/database"
+
+	"github.com/google/uuid"
+)
+
+const (
+	MinOptions     = 2
+	MaxOptions     = 4
+	MaxOptionLabel = 25
+	MinDuration    = 5 * time.Minute
+	MaxDuration    = 7 * 24 * time.Hour
+)
+
+var (
+	ErrClosed       = errors.New("poll is closed")
+	ErrAlreadyVoted = errors.New("you have already voted in this poll")
+)
+
+// Request is a poll attached to a new chirp.
+type Request struct {
+	Options  []string  `json:"options"`
+	ClosesAt time.Time `json:"closes_at"`
+}
+
+// Problem is a field that failed validation.
+type Problem struct {
+	Field   string
+	Code    string
+	Message string
+}
+
+// Validate checks the options and that the poll runs for a sensible time
+// after the chirp goes live at publishAt.
+func (r Request) Validate(publishAt time.Time) []Problem {
+	var problems []Problem
+	if len(r.Options) < MinOptions || len(r.Options) > MaxOptions {
+		problems = append(problems, Problem{
+			Field:   "poll.options",
+			Code:    "count",
+			Message: fmt.Sprintf("a poll needs %d to %d options", MinOptions, MaxOptions),
+		})
+	}
+	seen := make(map[string]bool)
+	for i, opt := range r.Options {
+		label := strings.TrimSpace(opt)
+		field := fmt.Sprintf("poll.options[%d]", i)
+		switch {
+		case label == "":
+			problems = append(problems, Problem{Field: field, Code: "required", Message: "option can't be empty"})
+		case utf8.RuneCountInString(label) > MaxOptionLabel:
+			problems = append(problems, Problem{Field: field, Code: "too_long", Message: fmt.Sprintf("option must be at most %d characters", MaxOptionLabel)})
+		case seen[strings.ToLower(label)]:
+			problems = append(problems, Problem{Field: field, Code: "duplicate", Message: "options must be distinct"})
+		}
+		seen[strings.ToLower(label)] = true
+	}
+
+	duration := r.ClosesAt.Sub(publishAt)
+	if duration < MinDuration || duration > MaxDuration {
+		problems = append(problems, Problem{
+			Field:   "poll.closes_at",
+			Code:    "out_of_range",
+			Message: "poll must close between 5 minutes and 7 days after the chirp is published",
+		})
+	}
+	return problems
+}
+
+// Labels returns the options as they are stored, cleaned like chirp bodies.
+func (r Request) Labels() []string {
+	out := make([]string, 0, len(r.Options))
+	for _, opt := range r.Options {
+		out = append(out, chirps.CleanBody(strings.TrimSpace(opt)))
+	}
+	return out
+}
+
+// Poll tallies are only included once the poll has closed or the viewer has
+// voted, so early results don't sway anyone.
+type Poll struct {
+	ClosesAt   time.Time  `json:"closes_at"`
+	Closed     bool       `json:"closed"`
+	Options    []Option   `json:"options"`
+	TotalVotes *int64     `json:"total_votes,omitempty"`
+	ViewerVote *uuid.UUID `json:"viewer_vote,omitempty"`
+}
+
+type Option struct {
+	Id    uuid.UUID `json:"id"`
+	Label string    `json:"label"`
+	Votes *int64    `json:"votes,omitempty"`
+}
+
+func Closed(p database.Poll, now time.Time) bool {
+	return !now.Before(p.ClosesAt)
+}
+
+// View renders p as seen at now by a viewer whose vote, if any, is
+// viewerVote. options are p's options in order and votes the tally per
+// option id.
+func View(p database.Poll, options []database.PollOption, votes map[uuid.UUID]int64, viewerVote *uuid.UUID, now time.Time) *Poll {
+	out := &Poll{
+		ClosesAt:   p.ClosesAt,
+		Closed:     Closed(p, now),
+		Options:    make([]Option, 0, len(options)),
+		ViewerVote: viewerVote,
+	}
+	showTally := out.Closed || viewerVote != nil
+	var total int64
+	for _, o := range options {
+		opt := Option{Id: o.ID, Label: o.Label}
+		if showTally {
+			n := votes[o.ID]
+			opt.Votes = &n
+			total += n
+		}
+		out.Options = append(out.Options, opt)
+	}
+	if showTally {
+		out.TotalVotes = &total
+	}
+	return out
+}
+
+// VoteQueries is what Vote needs from *database.Queries.
+type VoteQueries interface {
+	GetPoll(ctx context.Context, chirpID uuid.UUID) (database.Poll, error)
+	CreatePollVote(ctx context.Context, arg database.CreatePollVoteParams) (int64, error)
+}
+
+// Vote records userID's vote for optionID. Each user gets one vote per poll;
+// poll_votes is keyed on (chirp_id, user_id), so a second vote, even for
+// another option, inserts nothing and returns ErrAlreadyVoted.
+func Vote(ctx context.Context, q VoteQueries, chirpID, userID, optionID uuid.UUID, now time.Time) error {
+	poll, err := q.GetPoll(ctx, chirpID)
+	if err != nil {
+		return err
+	}
+	if Closed(poll, now) {
+		return ErrClosed
+	}
+	n, err := q.CreatePollVote(ctx, database.CreatePollVoteParams{
+		ChirpID:  chirpID,
+		UserID:   userID,
+		OptionID: optionID,
+	})
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrAlreadyVoted
+	}
+	return nil
+}
@@ -0,0 +1,159 @@
+package profiles
+
+import (
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"local/mda/internal/database"
+
+	"github.com/google/uuid"
+)
+
+const (
+	MaxDisplayNameLength = 50
+	MaxBioLength         = 160
+	MaxAvatarURLLength   = 2048
+)
+
+var handleRe = regexp.MustCompile(`^[a-z0-9_]{3,30}$`)
+
+// Profile is the public view of a user; it never includes the email.
+type Profile struct {
+	Id          uuid.UUID `json:"id"`
+	CreatedAt   time.Time `json:"created_at"`
+	Handle      string    `json:"handle"`
+	DisplayName string    `json:"display_name"`
+	Bio         string    `json:"bio"`
+	AvatarUrl   string    `json:"avatar_url"`
+	IsChirpyRed bool      `json:"is_chirpy_red"`
+}
+
+func FromUser(u database.User) Profile {
+	return Profile{
+		Id:          u.ID,
+		CreatedAt:   u.CreatedAt,
+		Handle:      u.Handle.String,
+		DisplayName: u.DisplayName,
+		Bio:         u.Bio,
+		AvatarUrl:   u.AvatarUrl,
+		IsChirpyRed: u.IsChirpyRed,
+	}
+}
+
+// Author is the public slice of a profile embedded in chirps.
+type Author struct {
+	Id          uuid.UUID `json:"id"`
+	Handle      string    `json:"handle"`
+	DisplayName string    `json:"display_name"`
+	AvatarUrl   string    `json:"avatar_url"`
+}
+
+func AuthorOf(u database.User) Author {
+	return Author{
+		Id:          u.ID,
+		Handle:      u.Handle.String,
+		DisplayName: u.DisplayName,
+		AvatarUrl:   u.AvatarUrl,
+	}
+}
+
+// NormalizeHandle lowercases a handle and drops a leading "@". Handles are
+// stored normalized, so the unique index also rejects case variants.
+func NormalizeHandle(s string) string {
+	return strings.ToLower(strings.TrimPrefix(strings.TrimSpace(s), "@"))
+}
+
+// ValidHandle reports whether a normalized handle can be claimed. "me" is
+// reserved for the /api/users/me routes.
+func ValidHandle(handle string) bool {
+	return handleRe.MatchString(handle) && handle != "me"
+}
+
+// Key is how /api/users/{handleOrId} addresses a user: the caller ("me"),
+// an id, or a handle ("alice" or "@alice").
+type Key struct {
+	Me     bool
+	ID     uuid.UUID
+	Handle string
+}
+
+func ParseKey(s string) Key {
+	if s == "me" {
+		return Key{Me: true}
+	}
+	if id, err := uuid.Parse(s); err == nil {
+		return Key{ID: id}
+	}
+	return Key{Handle: NormalizeHandle(s)}
+}
+
+// Update is a partial profile change; nil fields are left alone and an
+// empty handle clears it.
+type Update struct {
+	Handle      *string `json:"handle"`
+	DisplayName *string `json:"display_name"`
+	Bio         *string `json:"bio"`
+	AvatarUrl   *string `json:"avatar_url"`
+}
+
+// Empty reports whether u changes nothing.
+func (u Update) Empty() bool {
+	return u.Handle == nil && u.DisplayName == nil && u.Bio == nil && u.AvatarUrl == nil
+}
+
+// Problem is a field that failed validation.
+type Problem struct {
+	Field   string
+	Code    string
+	Message string
+}
+
+// Validate normalizes the fields in place and returns any problems found.
+func (u *Update) Validate() []Problem {
+	var problems []Problem
+
+	if u.Handle != nil {
+		handle := NormalizeHandle(*u.Handle)
+		u.Handle = &handle
+		if handle != "" && !ValidHandle(handle) {
+			problems = append(problems, Problem{
+				Field:   "handle",
+				Code:    "invalid",
+				Message: "handle must be 3-30 characters of letters, digits or underscores",
+			})
+		}
+	}
+	if u.DisplayName != nil {
+		name := strings.TrimSpace(*u.DisplayName)
+		u.DisplayName = &name
+		if utf8.RuneCountInString(name) > MaxDisplayNameLength {
+			problems = append(problems, Problem{
+				Field:   "display_name",
+				Code:    "too_long",
+				Message: "display name must be at most 50 characters",
+			})
+		}
+	}
+	if u.Bio != nil && utf8.RuneCountInString(*u.Bio) > MaxBioLength {
+		problems = append(problems, Problem{
+			Field:   "bio",
+			Code:    "too_long",
+			Message: "bio must be at most 160 characters",
+		})
+	}
+	if u.AvatarUrl != nil && *u.AvatarUrl != "" {
+		parsed, err := url.Parse(*u.AvatarUrl)
+		if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" || len(*u.AvatarUrl) > MaxAvatarURLLength {
+			problems = append(problems, Problem{
+				Field:   "avatar_url",
+				Code:    "invalid",
+				Message: "avatar_url must be an http or https URL",
+			})
+		}
+	}
+
+	return problems
+}
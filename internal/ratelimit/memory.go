@@ -0,0 +1,46 @@
+package ratelimit
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// MemoryStore keeps buckets in process memory; limits are per instance.
+type MemoryStore struct {
+	mu      sync.Mutex
+	buckets map[string]Bucket
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{buckets: make(map[string]Bucket)}
+}
+
+func (s *MemoryStore) Take(ctx context.Context, limits []Limit, now time.Time) ([]Result, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	buckets := make([]Bucket, len(limits))
+	rules := make([]Rule, len(limits))
+	for i, l := range limits {
+		buckets[i] = s.buckets[l.Key]
+		rules[i] = l.Rule
+	}
+	buckets, results := TakeAll(buckets, rules, now)
+	for i, l := range limits {
+		s.buckets[l.Key] = buckets[i]
+	}
+	return results, nil
+}
+
+func (s *MemoryStore) Prune(ctx context.Context, before time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for key, b := range s.buckets {
+		if b.UpdatedAt.Before(before) {
+			delete(s.buckets, key)
+		}
+	}
+	return nil
+}
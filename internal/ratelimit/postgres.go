@@ -0,0 +1,75 @@
+package ratelimit
+
+import (
+	"context"
+	"database/sql"
+	"sort"
+	"time"
+
+	"local/mda/internal/database"
+)
+
+// PostgresStore keeps buckets in the rate_limit_buckets table so limits hold
+// across instances. Each Take locks the bucket rows for its transaction, in
+// key order so concurrent requests can't deadlock.
+type PostgresStore struct {
+	db      *sql.DB
+	queries *database.Queries
+}
+
+func NewPostgresStore(db *sql.DB, queries *database.Queries) *PostgresStore {
+	return &PostgresStore{db: db, queries: queries}
+}
+
+func (s *PostgresStore) Take(ctx context.Context, limits []Limit, now time.Time) ([]Result, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+	qtx := s.queries.WithTx(tx)
+
+	order := make([]int, len(limits))
+	for i := range order {
+		order[i] = i
+	}
+	sort.Slice(order, func(a, b int) bool { return limits[order[a]].Key < limits[order[b]].Key })
+
+	buckets := make([]Bucket, len(limits))
+	rules := make([]Rule, len(limits))
+	for _, i := range order {
+		l := limits[i]
+		err = qtx.EnsureRateLimitBucket(ctx, database.EnsureRateLimitBucketParams{
+			Key:       l.Key,
+			Tokens:    float64(l.Rule.Capacity),
+			UpdatedAt: now,
+		})
+		if err != nil {
+			return nil, err
+		}
+		row, err := qtx.GetRateLimitBucketForUpdate(ctx, l.Key)
+		if err != nil {
+			return nil, err
+		}
+		buckets[i] = Bucket{Tokens: row.Tokens, UpdatedAt: row.UpdatedAt}
+		rules[i] = l.Rule
+	}
+
+	buckets, results := TakeAll(buckets, rules, now)
+	for i, l := range limits {
+		err = qtx.UpdateRateLimitBucket(ctx, database.UpdateRateLimitBucketParams{
+			Key:       l.Key,
+			Tokens:    buckets[i].Tokens,
+			UpdatedAt: buckets[i].UpdatedAt,
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return results, tx.Commit()
+}
+
+func (s *PostgresStore) Prune(ctx context.Context, before time.Time) error {
+	return s.queries.DeleteRateLimitBucketsBefore(ctx, before)
+}
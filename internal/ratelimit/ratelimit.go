@@ -0,0 +1,227 @@
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"time"
+)
+
+// Rule allows bursts of up to Capacity requests and refills the bucket
+// completely over Per.
+type Rule struct {
+	Capacity int
+	Per      time.Duration
+	// Local rules keep their buckets in the limiter's local store, when it
+	// has one, so each instance enforces them on its own.
+	Local bool
+}
+
+func (r Rule) rate() float64 {
+	return float64(r.Capacity) / r.Per.Seconds()
+}
+
+// Policy formats the rule for the RateLimit-Policy header.
+func (r Rule) Policy() string {
+	return fmt.Sprintf("%d;w=%d", r.Capacity, int(r.Per.Seconds()))
+}
+
+// Bucket is the persisted token bucket state.
+type Bucket struct {
+	Tokens    float64
+	UpdatedAt time.Time
+}
+
+type Result struct {
+	// Rule is the rule whose bucket this result describes.
+	Rule      Rule
+	Allowed   bool
+	Limit     int
+	Remaining int
+	// Reset is the time until the bucket is full again.
+	Reset time.Duration
+	// RetryAfter is the time until the next token, set when not allowed.
+	RetryAfter time.Duration
+}
+
+// Take refills b for the time elapsed since its last update and tries to
+// consume one token.
+func Take(b Bucket, rule Rule, now time.Time) (Bucket, Result) {
+	buckets, results := TakeAll([]Bucket{b}, []Rule{rule}, now)
+	return buckets[0], results[0]
+}
+
+// TakeAll refills each bucket and consumes one token from every one of
+// them, or from none if any is empty, so a request rejected by one rule
+// doesn't use up the others.
+func TakeAll(buckets []Bucket, rules []Rule, now time.Time) ([]Bucket, []Result) {
+	tokens := make([]float64, len(buckets))
+	allowed := true
+	for i, b := range buckets {
+		capacity := float64(rules[i].Capacity)
+		tokens[i] = capacity
+		if !b.UpdatedAt.IsZero() {
+			elapsed := now.Sub(b.UpdatedAt).Seconds()
+			if elapsed < 0 {
+				elapsed = 0
+			}
+			tokens[i] = math.Min(capacity, b.Tokens+elapsed*rules[i].rate())
+		}
+		if tokens[i] < 1 {
+			allowed = false
+		}
+	}
+
+	outBuckets := make([]Bucket, len(buckets))
+	results := make([]Result, len(buckets))
+	for i, rule := range rules {
+		rate := rule.rate()
+		res := Result{Rule: rule, Limit: rule.Capacity, Allowed: allowed}
+		if allowed {
+			tokens[i]--
+		} else if tokens[i] < 1 {
+			res.RetryAfter = seconds((1 - tokens[i]) / rate)
+		}
+		res.Remaining = int(math.Floor(tokens[i]))
+		res.Reset = seconds((float64(rule.Capacity) - tokens[i]) / rate)
+
+		outBuckets[i] = Bucket{Tokens: tokens[i], UpdatedAt: now}
+		results[i] = res
+	}
+	return outBuckets, results
+}
+
+func seconds(s float64) time.Duration {
+	return time.Duration(s * float64(time.Second))
+}
+
+// Limit is a bucket key and the rule that governs it.
+type Limit struct {
+	Key  string
+	Rule Rule
+}
+
+// Store keeps buckets by key. Take must apply TakeAll atomically: a token
+// is taken from every bucket or from none.
+type Store interface {
+	Take(ctx context.Context, limits []Limit, now time.Time) ([]Result, error)
+	// Prune drops buckets not touched since before.
+	Prune(ctx context.Context, before time.Time) error
+}
+
+// Limiter applies a global rule plus optional per-route rules.
+type Limiter struct {
+	store  Store
+	local  Store
+	global *Rule
+	routes map[string]Rule
+	now    func() time.Time
+}
+
+func New(store Store) *Limiter {
+	return &Limiter{
+		store:  store,
+		routes: make(map[string]Rule),
+		now:    func() time.Time { return time.Now().UTC() },
+	}
+}
+
+// WithClock replaces the time source, mainly for tests.
+func (l *Limiter) WithClock(now func() time.Time) *Limiter {
+	l.now = now
+	return l
+}
+
+// WithLocalStore keeps the buckets of Local rules in s instead of the main
+// store. Rules that see every request, like the global one, are cheaper
+// held in a per-instance MemoryStore than in a shared store that costs a
+// round trip each time.
+func (l *Limiter) WithLocalStore(s Store) *Limiter {
+	l.local = s
+	return l
+}
+
+// SetGlobal applies rule to every request regardless of route.
+func (l *Limiter) SetGlobal(rule Rule) {
+	l.global = &rule
+}
+
+// SetRoute applies rule to requests matched by the given ServeMux pattern.
+func (l *Limiter) SetRoute(pattern string, rule Rule) {
+	l.routes[pattern] = rule
+}
+
+// Allow consumes a token for key from the global bucket and, if the pattern
+// has its own rule, from the route bucket; both buckets must have one. The
+// returned Result describes the rule that rejected the request, or the most
+// specific rule when it is allowed; ok is false if no rule applied at all.
+//
+// Local rules are checked first. Each store takes its tokens atomically, but
+// a request a shared rule rejects has already spent its local ones.
+func (l *Limiter) Allow(ctx context.Context, pattern, key string) (res Result, ok bool, err error) {
+	var limits []Limit
+	if l.global != nil {
+		limits = append(limits, Limit{Key: "global|" + key, Rule: *l.global})
+	}
+	if rule, found := l.routes[pattern]; found {
+		limits = append(limits, Limit{Key: pattern + "|" + key, Rule: rule})
+	}
+	if len(limits) == 0 {
+		return Result{}, false, nil
+	}
+
+	now := l.now()
+	results := make([]Result, len(limits))
+	for _, local := range []bool{true, false} {
+		store := l.store
+		if local {
+			if l.local == nil {
+				continue
+			}
+			store = l.local
+		}
+		var part []Limit
+		var at []int
+		for i, lim := range limits {
+			if (lim.Rule.Local && l.local != nil) == local {
+				part = append(part, lim)
+				at = append(at, i)
+			}
+		}
+		if len(part) == 0 {
+			continue
+		}
+
+		rs, err := store.Take(ctx, part, now)
+		if err != nil {
+			return Result{}, true, err
+		}
+		for i, r := range rs {
+			if !r.Allowed && r.RetryAfter > 0 {
+				return r, true, nil
+			}
+			results[at[i]] = r
+		}
+	}
+	return results[len(results)-1], true, nil
+}
+
+// Prune drops buckets that have been idle long enough to be full again.
+func (l *Limiter) Prune(ctx context.Context) error {
+	var longest time.Duration
+	if l.global != nil {
+		longest = l.global.Per
+	}
+	for _, rule := range l.routes {
+		if rule.Per > longest {
+			longest = rule.Per
+		}
+	}
+	before := l.now().Add(-longest)
+	if l.local != nil {
+		if err := l.local.Prune(ctx, before); err != nil {
+			return err
+		}
+	}
+	return l.store.Prune(ctx, before)
+}
@@ -0,0 +1,61 @@
+package relationships
+
+import (
+	"local/mda/internal/database"
+
+	"github.com/google/uuid"
+)
+
+// Relationship kinds. Blocking hides both users' chirps from each other;
+// muting only hides the target's chirps from the muter.
+const (
+	Block = "block"
+	Mute  = "mute"
+)
+
+// Rule picks the authors hidden from viewer out of the relationships that
+// involve viewer, on either side.
+type Rule func(viewer uuid.UUID, rels []database.UserRelationship) []uuid.UUID
+
+// HiddenInFeeds is the rule for chirp lists, author pages and the live
+// stream: viewer doesn't see anyone they blocked or muted, nor anyone who
+// blocked them.
+func HiddenInFeeds(viewer uuid.UUID, rels []database.UserRelationship) []uuid.UUID {
+	return hidden(rels, func(r database.UserRelationship) (uuid.UUID, bool) {
+		switch {
+		case r.UserID == viewer:
+			return r.TargetID, true
+		case r.TargetID == viewer && r.Kind == Block:
+			return r.UserID, true
+		}
+		return uuid.Nil, false
+	})
+}
+
+// HiddenByLink is the rule for opening a single chirp: only authors who
+// blocked viewer are hidden. Muting or blocking someone tidies viewer's
+// feeds but doesn't stop them following a link.
+func HiddenByLink(viewer uuid.UUID, rels []database.UserRelationship) []uuid.UUID {
+	return hidden(rels, func(r database.UserRelationship) (uuid.UUID, bool) {
+		if r.TargetID == viewer && r.Kind == Block {
+			return r.UserID, true
+		}
+		return uuid.Nil, false
+	})
+}
+
+// hidden collects the distinct authors pick returns; the result is never
+// nil, so it binds as an empty array rather than NULL.
+func hidden(rels []database.UserRelationship, pick func(database.UserRelationship) (uuid.UUID, bool)) []uuid.UUID {
+	out := []uuid.UUID{}
+	seen := make(map[uuid.UUID]bool)
+	for _, r := range rels {
+		id, ok := pick(r)
+		if !ok || seen[id] {
+			continue
+		}
+		seen[id] = true
+		out = append(out, id)
+	}
+	return out
+}
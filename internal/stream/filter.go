@@ -0,0 +1,44 @@
+package stream
+
+import (
+	"encoding/json"
+	"strings"
+
+	"local/mda/internal/events"
+
+	"github.com/google/uuid"
+)
+
+// Filter narrows a stream down to what one client asked for. The zero
+// Filter matches everything.
+type Filter struct {
+	// Authors, when not empty, limits events to these users.
+	Authors map[uuid.UUID]bool
+	// Keyword, when set, limits created chirps to bodies containing it,
+	// ignoring case. Deletions always pass so clients can drop chirps they
+	// already show.
+	Keyword string
+	// Hidden authors are never shown, e.g. muted or blocked users.
+	Hidden map[uuid.UUID]bool
+}
+
+func (f Filter) Match(e events.Event) bool {
+	if f.Hidden[e.UserID] {
+		return false
+	}
+	if len(f.Authors) > 0 && !f.Authors[e.UserID] {
+		return false
+	}
+	if f.Keyword != "" && e.Type != events.ChirpDeleted {
+		var payload struct {
+			Body string `json:"body"`
+		}
+		if err := json.Unmarshal(e.Payload, &payload); err != nil {
+			return false
+		}
+		if !strings.Contains(strings.ToLower(payload.Body), strings.ToLower(f.Keyword)) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,118 @@
+package stream
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"local/mda/internal/events"
+)
+
+// Message is an event with its position in the hub's sequence.
+type Message struct {
+	ID    uint64
+	Event events.Event
+}
+
+// Subscription receives messages published after it was created. C is
+// closed when the subscriber falls too far behind or unsubscribes; a client
+// can then reconnect and resume from the last ID it saw.
+type Subscription struct {
+	C  <-chan Message
+	ch chan Message
+}
+
+// Hub fans events out to live subscribers and keeps the most recent ones in
+// a ring buffer so reconnecting clients can catch up.
+type Hub struct {
+	mu      sync.Mutex
+	ring    []Message
+	start   int // index of the oldest message in ring
+	size    int // number of messages in ring
+	next    uint64
+	subs    map[*Subscription]struct{}
+	backlog int
+}
+
+// NewHub keeps the last capacity messages for resumption and gives each
+// subscriber a buffer of backlog messages.
+func NewHub(capacity, backlog int) *Hub {
+	return &Hub{
+		ring: make([]Message, capacity),
+		// IDs start at the boot time so they keep increasing across
+		// restarts, and a client resuming from a previous process is
+		// told to reset rather than silently missing events.
+		next:    uint64(time.Now().UnixMicro()),
+		subs:    make(map[*Subscription]struct{}),
+		backlog: backlog,
+	}
+}
+
+// Publish records e and delivers it to every subscriber. Subscribers whose
+// buffer is full are dropped instead of blocking the publisher. It has the
+// signature of an events.Handler.
+func (h *Hub) Publish(ctx context.Context, e events.Event) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	msg := Message{ID: h.next, Event: e}
+	h.next++
+	if len(h.ring) > 0 {
+		if h.size < len(h.ring) {
+			h.ring[(h.start+h.size)%len(h.ring)] = msg
+			h.size++
+		} else {
+			h.ring[h.start] = msg
+			h.start = (h.start + 1) % len(h.ring)
+		}
+	}
+
+	for sub := range h.subs {
+		select {
+		case sub.ch <- msg:
+		default:
+			delete(h.subs, sub)
+			close(sub.ch)
+		}
+	}
+	return nil
+}
+
+// Subscribe starts a subscription. When lastID is non-zero, the messages
+// after it that are still buffered are returned as a backlog; complete is
+// false if some messages after lastID have already been evicted, in which
+// case the client should refetch its state.
+func (h *Hub) Subscribe(lastID uint64) (sub *Subscription, backlog []Message, complete bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	complete = true
+	if lastID != 0 {
+		oldest := h.next - uint64(h.size)
+		if lastID+1 < oldest || lastID >= h.next {
+			complete = false
+		}
+		for i := 0; i < h.size; i++ {
+			msg := h.ring[(h.start+i)%len(h.ring)]
+			if msg.ID > lastID {
+				backlog = append(backlog, msg)
+			}
+		}
+	}
+
+	ch := make(chan Message, h.backlog)
+	sub = &Subscription{C: ch, ch: ch}
+	h.subs[sub] = struct{}{}
+	return sub, backlog, complete
+}
+
+// Unsubscribe stops delivery to sub and closes its channel. It is safe to
+// call after the hub has dropped the subscription.
+func (h *Hub) Unsubscribe(sub *Subscription) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if _, ok := h.subs[sub]; ok {
+		delete(h.subs, sub)
+		close(sub.ch)
+	}
+}
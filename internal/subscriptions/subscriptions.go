@@ -0,0 +1,130 @@
+package subscriptions
+
+import (
+	"errors"
+	"slices"
+	"time"
+)
+
+const PlanChirpyRed = "chirpy_red"
+
+// Subscription statuses.
+const (
+	// StatusActive is paid up.
+	StatusActive = "active"
+	// StatusPastDue had a renewal payment fail; the plan keeps working
+	// through the grace period while the provider retries.
+	StatusPastDue = "past_due"
+	// StatusCanceled won't renew but runs until the end of the paid period.
+	StatusCanceled = "canceled"
+	// StatusExpired no longer grants the plan.
+	StatusExpired = "expired"
+)
+
+// Billing events, named as the payment provider sends them.
+const (
+	EventUpgraded      = "user.upgraded"
+	EventRenewed       = "subscription.renewed"
+	EventCanceled      = "subscription.canceled"
+	EventPaymentFailed = "payment.failed"
+	EventRefunded      = "payment.refunded"
+	EventDowngraded    = "user.downgraded"
+	// EventExpired is recorded by the expiry job, not sent by the provider.
+	EventExpired = "subscription.expired"
+)
+
+// ProviderEvents lists the events a payment provider may send.
+var ProviderEvents = []string{
+	EventUpgraded,
+	EventRenewed,
+	EventCanceled,
+	EventPaymentFailed,
+	EventRefunded,
+	EventDowngraded,
+}
+
+// Known reports whether event is one a payment provider may send.
+func Known(event string) bool {
+	return slices.Contains(ProviderEvents, event)
+}
+
+// Grace is how long an active or past-due subscription keeps working after
+// its period ends, to absorb late renewals and payment retries.
+const Grace = 3 * 24 * time.Hour
+
+var ErrUnknownEvent = errors.New("unknown subscription event")
+
+// State is a user's subscription. The zero value means none.
+type State struct {
+	Plan   string
+	Status string
+	// CurrentPeriodEnd is nil for subscriptions without a known period,
+	// such as upgrades from before periods were tracked; those never lapse
+	// on their own.
+	CurrentPeriodEnd *time.Time
+	// LastEventAt is when the provider created the newest event applied,
+	// nil until one that carries a time arrives.
+	LastEventAt *time.Time
+}
+
+// Stale reports whether an event the provider created at occurredAt is
+// older than one already applied. Events without a time (the zero value)
+// are never stale.
+func (s State) Stale(occurredAt time.Time) bool {
+	return !occurredAt.IsZero() && s.LastEventAt != nil && occurredAt.Before(*s.LastEventAt)
+}
+
+// Entitled reports whether the subscription grants its plan at now.
+func (s State) Entitled(now time.Time) bool {
+	switch s.Status {
+	case StatusActive, StatusPastDue:
+		return s.CurrentPeriodEnd == nil || now.Before(s.CurrentPeriodEnd.Add(Grace))
+	case StatusCanceled:
+		return s.CurrentPeriodEnd != nil && now.Before(*s.CurrentPeriodEnd)
+	}
+	return false
+}
+
+// Apply returns the state after event. periodEnd is the end of the paid
+// period when the event carries one; events without it keep the current
+// one.
+func Apply(s State, event string, periodEnd *time.Time) (State, error) {
+	if periodEnd != nil {
+		t := periodEnd.UTC()
+		periodEnd = &t
+	}
+	next := s
+	if next.Plan == "" {
+		next.Plan = PlanChirpyRed
+	}
+
+	switch event {
+	case EventUpgraded, EventRenewed:
+		next.Status = StatusActive
+		if periodEnd != nil {
+			next.CurrentPeriodEnd = periodEnd
+		}
+	case EventPaymentFailed:
+		if s.Status != StatusActive && s.Status != StatusPastDue {
+			// nothing to fall behind on
+			return s, nil
+		}
+		next.Status = StatusPastDue
+	case EventCanceled:
+		if s.Status == "" || s.Status == StatusExpired {
+			return s, nil
+		}
+		next.Status = StatusCanceled
+		if periodEnd != nil {
+			next.CurrentPeriodEnd = periodEnd
+		}
+	case EventRefunded, EventDowngraded, EventExpired:
+		if s.Status == "" {
+			return s, nil
+		}
+		next.Status = StatusExpired
+	default:
+		return s, ErrUnknownEvent
+	}
+	return next, nil
+}
@@ -0,0 +1,71 @@
+package webhooks
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"local/mda/internal/auth"
+	"local/mda/internal/subscriptions"
+
+	"github.com/google/uuid"
+)
+
+const (
+	PolkaTimestampHeader  = "Polka-Timestamp"
+	PolkaSignatureHeader  = "Polka-Signature"
+	PolkaDeliveryIDHeader = "Polka-Delivery-Id"
+)
+
+// Polka receives Polka's webhooks. With Secret set, Polka-Signature must be
+// a hex HMAC-SHA256 of Polka-Timestamp and the body, within ReplayWindow,
+// and Polka-Delivery-Id is required. Otherwise the static APIKey is
+// accepted, compared in constant time.
+type Polka struct {
+	APIKey       string
+	Secret       string
+	ReplayWindow time.Duration
+}
+
+func (p *Polka) Verify(header http.Header, body []byte, now time.Time) error {
+	if p.Secret == "" {
+		key, err := auth.GetAPIKey(header)
+		if err != nil || p.APIKey == "" || subtle.ConstantTimeCompare([]byte(key), []byte(p.APIKey)) != 1 {
+			return ErrInvalidAPIKey
+		}
+		return nil
+	}
+
+	err := VerifyTimestamp(p.Secret, header.Get(PolkaTimestampHeader), header.Get(PolkaSignatureHeader), body, now, p.ReplayWindow)
+	if err != nil {
+		return err
+	}
+	if header.Get(PolkaDeliveryIDHeader) == "" {
+		return ErrMissingDeliveryID
+	}
+	return nil
+}
+
+// Parse maps Polka's events, which already use Chirpy's names.
+func (p *Polka) Parse(header http.Header, body []byte) (BillingEvent, error) {
+	var payload struct {
+		Event string `json:"event"`
+		Data  struct {
+			UserID           uuid.UUID  `json:"user_id"`
+			CurrentPeriodEnd *time.Time `json:"current_period_end"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(body, &payload); err != nil {
+		return BillingEvent{}, err
+	}
+	if !subscriptions.Known(payload.Event) {
+		return BillingEvent{}, ErrIgnoredEvent
+	}
+	return BillingEvent{
+		DeliveryID:       header.Get(PolkaDeliveryIDHeader),
+		Type:             payload.Event,
+		UserID:           payload.Data.UserID,
+		CurrentPeriodEnd: payload.Data.CurrentPeriodEnd,
+	}, nil
+}
@@ -0,0 +1,71 @@
+package webhooks
+
+import (
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+var (
+	// ErrInvalidAPIKey is returned by providers that authenticate with a
+	// static key rather than a signature.
+	ErrInvalidAPIKey = errors.New("invalid API key")
+	// ErrMissingDeliveryID means a signed delivery came without the ID
+	// needed to recognize retries.
+	ErrMissingDeliveryID = errors.New("missing delivery ID")
+	// ErrIgnoredEvent means the delivery is valid but its event type is not
+	// one Chirpy acts on; it should be acknowledged and dropped.
+	ErrIgnoredEvent = errors.New("event type not handled")
+)
+
+// BillingEvent is a provider delivery mapped to Chirpy's terms. Type is one
+// of the subscriptions events.
+type BillingEvent struct {
+	// DeliveryID identifies the delivery across retries; empty when the
+	// provider doesn't send one.
+	DeliveryID string
+	Type       string
+	UserID     uuid.UUID
+	// CurrentPeriodEnd is the end of the paid period, when the event
+	// carries one.
+	CurrentPeriodEnd *time.Time
+	// OccurredAt is when the provider created the event, or zero when it
+	// doesn't say. Events older than the last one applied are ignored.
+	OccurredAt time.Time
+}
+
+// Provider receives a payment provider's webhooks.
+type Provider interface {
+	// Verify authenticates a delivery from its headers and exact body.
+	Verify(header http.Header, body []byte, now time.Time) error
+	// Parse decodes a verified delivery and maps it to a BillingEvent,
+	// returning ErrIgnoredEvent for event types that don't map to one.
+	Parse(header http.Header, body []byte) (BillingEvent, error)
+}
+
+// Registry looks providers up by the name in their webhook URL.
+type Registry struct {
+	mu        sync.RWMutex
+	providers map[string]Provider
+}
+
+func NewRegistry() *Registry {
+	return &Registry{providers: make(map[string]Provider)}
+}
+
+// Register adds p under name, replacing any provider already there.
+func (r *Registry) Register(name string, p Provider) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.providers[name] = p
+}
+
+func (r *Registry) Lookup(name string) (Provider, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	p, ok := r.providers[name]
+	return p, ok
+}
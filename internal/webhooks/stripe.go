@@ -0,0 +1,116 @@
+package webhooks
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"local/mda/internal/subscriptions"
+
+	"github.com/google/uuid"
+)
+
+const StripeSignatureHeader = "Stripe-Signature"
+
+var errNoStripeUser = errors.New("event has no user_id metadata")
+
+// Stripe receives webhooks in Stripe's event format. Stripe-Signature is
+// the same "t=...,v1=..." scheme Sign produces, checked within Tolerance.
+// The Chirpy user is taken from the object's metadata.user_id (for
+// invoices, the subscription's), which checkout must set.
+type Stripe struct {
+	Secret    string
+	Tolerance time.Duration
+}
+
+func (s *Stripe) Verify(header http.Header, body []byte, now time.Time) error {
+	return Verify(s.Secret, header.Get(StripeSignatureHeader), body, now, s.Tolerance)
+}
+
+type stripeEvent struct {
+	ID      string `json:"id"`
+	Type    string `json:"type"`
+	Created int64  `json:"created"`
+	Data    struct {
+		Object stripeObject `json:"object"`
+	} `json:"data"`
+}
+
+type stripeObject struct {
+	Status            string            `json:"status"`
+	CurrentPeriodEnd  int64             `json:"current_period_end"`
+	CancelAtPeriodEnd bool              `json:"cancel_at_period_end"`
+	Metadata          map[string]string `json:"metadata"`
+	// set on invoices
+	SubscriptionDetails struct {
+		Metadata map[string]string `json:"metadata"`
+	} `json:"subscription_details"`
+}
+
+// Parse maps subscription, invoice and charge events onto the
+// subscription lifecycle. The event ID is the delivery ID, since Stripe
+// resends the same event on retries. Stripe doesn't deliver events in
+// order, so its created time is passed on for ordering them.
+func (s *Stripe) Parse(header http.Header, body []byte) (BillingEvent, error) {
+	var e stripeEvent
+	if err := json.Unmarshal(body, &e); err != nil {
+		return BillingEvent{}, err
+	}
+	obj := e.Data.Object
+
+	eventType := stripeEventType(e.Type, obj)
+	if eventType == "" {
+		return BillingEvent{}, ErrIgnoredEvent
+	}
+
+	rawID := obj.Metadata["user_id"]
+	if rawID == "" {
+		rawID = obj.SubscriptionDetails.Metadata["user_id"]
+	}
+	if rawID == "" {
+		return BillingEvent{}, errNoStripeUser
+	}
+	userID, err := uuid.Parse(rawID)
+	if err != nil {
+		return BillingEvent{}, err
+	}
+
+	out := BillingEvent{DeliveryID: e.ID, Type: eventType, UserID: userID}
+	if e.Created > 0 {
+		out.OccurredAt = time.Unix(e.Created, 0).UTC()
+	}
+	if obj.CurrentPeriodEnd > 0 {
+		end := time.Unix(obj.CurrentPeriodEnd, 0).UTC()
+		out.CurrentPeriodEnd = &end
+	}
+	return out, nil
+}
+
+func stripeEventType(eventType string, obj stripeObject) string {
+	switch eventType {
+	case "customer.subscription.created":
+		if obj.Status == "active" || obj.Status == "trialing" {
+			return subscriptions.EventUpgraded
+		}
+	case "customer.subscription.updated":
+		switch obj.Status {
+		case "active", "trialing":
+			if obj.CancelAtPeriodEnd {
+				return subscriptions.EventCanceled
+			}
+			return subscriptions.EventRenewed
+		case "past_due", "unpaid":
+			return subscriptions.EventPaymentFailed
+		case "canceled", "incomplete_expired":
+			return subscriptions.EventDowngraded
+		}
+	case "customer.subscription.deleted":
+		return subscriptions.EventDowngraded
+	case "invoice.payment_failed":
+		return subscriptions.EventPaymentFailed
+	case "charge.refunded":
+		return subscriptions.EventRefunded
+	}
+	return ""
+}
@@ -0,0 +1,171 @@
+package webhooks
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	SignatureHeader = "Chirpy-Signature"
+	EventHeader     = "Chirpy-Event"
+	DeliveryHeader  = "Chirpy-Delivery"
+)
+
+var (
+	ErrMalformedSignature = errors.New("malformed signature header")
+	ErrSignatureExpired   = errors.New("signature timestamp outside tolerance")
+	ErrSignatureMismatch  = errors.New("signature does not match")
+)
+
+// NewSecret returns a random signing secret for a new endpoint.
+func NewSecret() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return "whsec_" + hex.EncodeToString(b), nil
+}
+
+// Sign returns the signature header value for body sent at ts:
+// "t=<unix seconds>,v1=<hex HMAC-SHA256 of "<t>.<body>">". Binding the
+// timestamp lets receivers reject replays.
+func Sign(secret string, ts time.Time, body []byte) string {
+	t := strconv.FormatInt(ts.Unix(), 10)
+	return "t=" + t + ",v1=" + hex.EncodeToString(mac(secret, t, body))
+}
+
+// Verify checks a header produced by Sign, accepting timestamps within
+// tolerance of now. Any v1 entry may match, so signers can rotate secrets.
+func Verify(secret, header string, body []byte, now time.Time, tolerance time.Duration) error {
+	var t string
+	var sigs [][]byte
+	for _, part := range strings.Split(header, ",") {
+		k, v, ok := strings.Cut(strings.TrimSpace(part), "=")
+		if !ok {
+			return ErrMalformedSignature
+		}
+		switch k {
+		case "t":
+			t = v
+		case "v1":
+			sig, err := hex.DecodeString(v)
+			if err != nil {
+				return ErrMalformedSignature
+			}
+			sigs = append(sigs, sig)
+		}
+	}
+	if len(sigs) == 0 {
+		return ErrMalformedSignature
+	}
+	return verify(secret, t, sigs, body, now, tolerance)
+}
+
+// VerifyTimestamp checks a hex HMAC-SHA256 of "<timestamp>.<body>" sent
+// with the timestamp (unix seconds) in a separate header, accepting
+// timestamps within tolerance of now.
+func VerifyTimestamp(secret, timestamp, signature string, body []byte, now time.Time, tolerance time.Duration) error {
+	sig, err := hex.DecodeString(strings.TrimSpace(signature))
+	if err != nil || len(sig) == 0 {
+		return ErrMalformedSignature
+	}
+	return verify(secret, strings.TrimSpace(timestamp), [][]byte{sig}, body, now, tolerance)
+}
+
+func verify(secret, t string, sigs [][]byte, body []byte, now time.Time, tolerance time.Duration) error {
+	unix, err := strconv.ParseInt(t, 10, 64)
+	if err != nil {
+		return ErrMalformedSignature
+	}
+	if d := now.Sub(time.Unix(unix, 0)); d > tolerance || d < -tolerance {
+		return ErrSignatureExpired
+	}
+
+	want := mac(secret, t, body)
+	for _, sig := range sigs {
+		if hmac.Equal(sig, want) {
+			return nil
+		}
+	}
+	return ErrSignatureMismatch
+}
+
+func mac(secret, t string, body []byte) []byte {
+	h := hmac.New(sha256.New, []byte(secret))
+	h.Write([]byte(t))
+	h.Write([]byte("."))
+	h.Write(body)
+	return h.Sum(nil)
+}
+
+// Backoff returns how long to wait after the given number of failed
+// attempts: 30s doubling each time, capped at 6h.
+func Backoff(attempts int) time.Duration {
+	const base, limit = 30 * time.Second, 6 * time.Hour
+	if attempts < 1 {
+		return base
+	}
+	d := time.Duration(float64(base) * math.Pow(2, float64(attempts-1)))
+	if d <= 0 || d > limit {
+		return limit
+	}
+	return d
+}
+
+// Request is one delivery attempt.
+type Request struct {
+	DeliveryID string
+	EventType  string
+	URL        string
+	Secret     string
+	Body       []byte
+}
+
+// Sender posts signed deliveries. Client should refuse internal addresses,
+// since endpoint URLs come from users.
+type Sender struct {
+	Client *http.Client
+	Now    func() time.Time
+}
+
+// Send posts req and returns the response status. Any status outside 2xx
+// is an error, as is a transport failure (with status 0).
+func (s *Sender) Send(ctx context.Context, req Request) (int, error) {
+	now := time.Now
+	if s.Now != nil {
+		now = s.Now
+	}
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, req.URL, bytes.NewReader(req.Body))
+	if err != nil {
+		return 0, err
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	httpReq.Header.Set("User-Agent", "Chirpy-Webhooks/1.0")
+	httpReq.Header.Set(EventHeader, req.EventType)
+	httpReq.Header.Set(DeliveryHeader, req.DeliveryID)
+	httpReq.Header.Set(SignatureHeader, Sign(req.Secret, now(), req.Body))
+
+	resp, err := s.Client.Do(httpReq)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("endpoint responded %s", resp.Status)
+	}
+	return resp.StatusCode, nil
+}
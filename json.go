@@ -2,8 +2,13 @@ package main
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
 	"log"
+	"math"
 	"net/http"
+	"strconv"
+	"time"
 )
 
 func respondWithError(w http.ResponseWriter, code int, msg string, err error) {
@@ -21,6 +26,68 @@ func respondWithError(w http.ResponseWriter, code int, msg string, err error) {
 	})
 }
 
+type validationError struct {
+	Field   string `json:"field"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+func respondWithValidationErrors(w http.ResponseWriter, msg string, errs []validationError) {
+	type validationResponse struct {
+		Error  string            `json:"error"`
+		Errors []validationError `json:"errors"`
+	}
+	respondWithJSON(w, http.StatusBadRequest, validationResponse{
+		Error:  msg,
+		Errors: errs,
+	})
+}
+
+// apiError is a failure that carries the status and message for the client.
+// Logic shared by the HTTP handlers and the WebSocket gateway returns it so
+// each transport can report the error its own way.
+type apiError struct {
+	Status  int
+	Message string
+	Errors  []validationError
+	Err     error
+}
+
+func (e *apiError) Error() string {
+	if e.Err != nil {
+		return fmt.Sprintf("%s: %s", e.Message, e.Err)
+	}
+	return e.Message
+}
+
+func (e *apiError) Unwrap() error {
+	return e.Err
+}
+
+// respondWithAPIError writes err as an HTTP error; anything that isn't an
+// *apiError is a 500.
+func respondWithAPIError(w http.ResponseWriter, err error) {
+	var apiErr *apiError
+	if !errors.As(err, &apiErr) {
+		respondWithError(w, http.StatusInternalServerError, "internal error", err)
+		return
+	}
+	if len(apiErr.Errors) > 0 {
+		respondWithValidationErrors(w, apiErr.Message, apiErr.Errors)
+		return
+	}
+	respondWithError(w, apiErr.Status, apiErr.Message, apiErr.Err)
+}
+
+func respondTooManyRequests(w http.ResponseWriter, retryAfter time.Duration, msg string) {
+	seconds := int(math.Ceil(retryAfter.Seconds()))
+	if seconds < 1 {
+		seconds = 1
+	}
+	w.Header().Set("Retry-After", strconv.Itoa(seconds))
+	respondWithError(w, http.StatusTooManyRequests, msg, nil)
+}
+
 func respondWithJSON(w http.ResponseWriter, code int, payload interface{}) {
 	w.Header().Set("Content-Type", "application/json")
 	dat, err := json.Marshal(payload)
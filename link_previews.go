@@ -0,0 +1,56 @@
+package main
+
+import (
+	"context"
+
+	"local/mda/internal/database"
+	"local/mda/internal/linkpreview"
+
+	"github.com/google/uuid"
+)
+
+// LinkPreview is the card shown for the first URL in a chirp.
+type LinkPreview struct {
+	Url         string `json:"url"`
+	Title       string `json:"title"`
+	Description string `json:"description"`
+	ImageUrl    string `json:"image_url"`
+}
+
+// linkPreviewsByChirp returns the cached previews for the chirps' first URLs.
+// Chirps whose preview hasn't been fetched yet are simply left out.
+func (cfg *apiConfig) linkPreviewsByChirp(ctx context.Context, q *database.Queries, rows []database.Chirp) (map[uuid.UUID]*LinkPreview, error) {
+	out := make(map[uuid.UUID]*LinkPreview)
+
+	chirpURLs := make(map[uuid.UUID]string)
+	urls := make([]string, 0, len(rows))
+	for _, c := range rows {
+		if u, ok := linkpreview.ExtractURL(c.Body); ok {
+			chirpURLs[c.ID] = u
+			urls = append(urls, u)
+		}
+	}
+	if len(urls) == 0 {
+		return out, nil
+	}
+
+	previews, err := q.ListLinkPreviews(ctx, urls)
+	if err != nil {
+		return nil, err
+	}
+	byURL := make(map[string]*LinkPreview, len(previews))
+	for _, p := range previews {
+		byURL[p.Url] = &LinkPreview{
+			Url:         p.Url,
+			Title:       p.Title,
+			Description: p.Description,
+			ImageUrl:    p.ImageUrl,
+		}
+	}
+	for id, u := range chirpURLs {
+		if p, ok := byURL[u]; ok {
+			out[id] = p
+		}
+	}
+	return out, nil
+}
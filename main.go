@@ -1,12 +1,28 @@
 package main
 
 import (
+	"context"
 	"database/sql"
+	"local/mda/internal/accounts"
+	"local/mda/internal/auth"
+	"local/mda/internal/blobstore"
 	"local/mda/internal/database"
+	"local/mda/internal/events"
+	"local/mda/internal/linkpreview"
+	"local/mda/internal/lockout"
+	"local/mda/internal/mailer"
+	"local/mda/internal/media"
+	"local/mda/internal/ratelimit"
+	"local/mda/internal/relationships"
+	"local/mda/internal/safehttp"
+	"local/mda/internal/stream"
+	"local/mda/internal/webhooks"
 	"log"
 	"net/http"
 	"os"
+	"strconv"
 	"sync/atomic"
+	"time"
 
 	"github.com/joho/godotenv"
 	_ "github.com/lib/pq"
@@ -16,9 +32,23 @@ import (
 type apiConfig struct {
 	fileserverHits atomic.Int32
 	db *database.Queries
+	sqlDB *sql.DB
 	platform string
 	authSecret string
-	polkaKey string
+	paymentProviders *webhooks.Registry
+	loginGuard *lockout.Guard
+	rateLimiter *ratelimit.Limiter
+	passwordPolicy auth.PasswordPolicy
+	passwordHasher auth.PasswordHasher
+	deletionPolicy accounts.DeletionPolicy
+	emailChangePolicy accounts.EmailChangePolicy
+	mailer mailer.Mailer
+	blobs blobstore.BlobStore
+	mediaLimits media.Limits
+	linkPreviews *linkpreview.Service
+	eventDispatcher *events.Dispatcher
+	streamHub *stream.Hub
+	webhookSender *webhooks.Sender
 }
 
 func main() {
@@ -31,6 +61,8 @@ func main() {
 
 	authSecret := os.Getenv("AUTH_SECRET")
 	polkaKey := os.Getenv("POLKA_KEY")
+	polkaSecret := os.Getenv("POLKA_WEBHOOK_SECRET")
+	stripeSecret := os.Getenv("STRIPE_WEBHOOK_SECRET")
 
 	db, err := sql.Open("postgres", dbURL)
 	if err != nil {
@@ -38,17 +70,137 @@ func main() {
 	}
 	dbQueries := database.New(db)
 
+	passwordPolicy := auth.DefaultPasswordPolicy()
+	if n, err := strconv.Atoi(os.Getenv("PASSWORD_MIN_LENGTH")); err == nil {
+		passwordPolicy.MinLength = n
+	}
+	if bits, err := strconv.ParseFloat(os.Getenv("PASSWORD_MIN_ENTROPY_BITS"), 64); err == nil {
+		passwordPolicy.MinEntropyBits = bits
+	}
+	if dir := os.Getenv("BREACHED_PASSWORDS_DIR"); dir != "" {
+		passwordPolicy.Breached = auth.NewBreachedCorpus(dir)
+	}
+
+	passwordHasher := auth.DefaultPasswordHasher()
+	if algo := os.Getenv("PASSWORD_HASH_ALGORITHM"); algo != "" {
+		passwordHasher.Algorithm = auth.HashAlgorithm(algo)
+	}
+	if passwordHasher.Algorithm != auth.HashArgon2id && passwordHasher.Algorithm != auth.HashBcrypt {
+		log.Fatalf("unsupported PASSWORD_HASH_ALGORITHM: %s", passwordHasher.Algorithm)
+	}
+	if cost, err := strconv.Atoi(os.Getenv("BCRYPT_COST")); err == nil {
+		passwordHasher.BcryptCost = cost
+	}
+
+	deletionGracePeriod := 30 * 24 * time.Hour
+	if d, err := time.ParseDuration(os.Getenv("ACCOUNT_DELETION_GRACE")); err == nil {
+		deletionGracePeriod = d
+	}
+
+	mediaDir := os.Getenv("MEDIA_DIR")
+	if mediaDir == "" {
+		mediaDir = "./media"
+	}
+	blobs, err := blobstore.NewLocalStore(mediaDir, "/media")
+	if err != nil {
+		log.Fatalf("Error opening media storage: %s", err)
+	}
+
+	linkPreviews := linkpreview.NewService(
+		linkpreview.NewFetcher(safehttp.NewClient(safehttp.DefaultOptions())),
+		linkpreview.NewPostgresStore(dbQueries),
+		24*time.Hour,
+	)
+
+	var lockoutStore lockout.Store = lockout.NewPostgresStore(dbQueries)
+	if os.Getenv("LOGIN_GUARD_STORE") == "memory" {
+		lockoutStore = lockout.NewMemoryStore()
+	}
+
+	var rateLimitStore ratelimit.Store = ratelimit.NewPostgresStore(db, dbQueries)
+	if os.Getenv("RATE_LIMIT_STORE") == "memory" {
+		rateLimitStore = ratelimit.NewMemoryStore()
+	}
+	// rules are keyed by the exact patterns registered on the mux below. The
+	// global and file server rules see every request, static files included,
+	// so they stay in memory per instance rather than costing a round trip
+	// to the store each time.
+	rateLimiter := ratelimit.New(rateLimitStore).WithLocalStore(ratelimit.NewMemoryStore())
+	rateLimiter.SetGlobal(ratelimit.Rule{Capacity: 300, Per: time.Minute, Local: true})
+	rateLimiter.SetRoute("/app/", ratelimit.Rule{Capacity: 120, Per: time.Minute, Local: true})
+	rateLimiter.SetRoute("POST /api/login", ratelimit.Rule{Capacity: 20, Per: time.Minute})
+	rateLimiter.SetRoute("POST /api/users", ratelimit.Rule{Capacity: 10, Per: time.Hour})
+	rateLimiter.SetRoute("POST /api/chirps", ratelimit.Rule{Capacity: 30, Per: time.Minute})
+
+	// handlers record events in the domain_events outbox as part of their
+	// transaction; the dispatcher hands them to the bus subscribers below
+	eventBus := events.NewBus()
+	eventOutbox := events.NewPostgresOutbox(dbQueries)
+	eventDispatcher := events.NewDispatcher(eventOutbox, eventBus)
+	eventBus.Subscribe("*", logEvent)
+
+	// the stream hub replays chirp events to SSE clients
+	streamHub := stream.NewHub(1024, 64)
+	eventBus.Subscribe(events.ChirpCreated, streamHub.Publish)
+	eventBus.Subscribe(events.ChirpDeleted, streamHub.Publish)
+
+	// endpoint URLs are user supplied, so deliveries go through safehttp;
+	// the dev platform may target local receivers
+	webhookClientOptions := safehttp.DefaultOptions()
+	webhookClientOptions.MaxRedirects = 0
+	webhookClientOptions.AllowPrivate = platformCfg == "dev"
+
+	// with several instances, events cross over via LISTEN/NOTIFY so each
+	// one's stream clients see chirps created on the others
+	var eventRelay *events.Relay
+	if os.Getenv("EVENT_RELAY") != "local" {
+		eventRelay = events.NewRelay(db, dbURL, "chirpy_events", eventBus).WithLoader(eventOutbox)
+		eventBus.Subscribe("*", eventRelay.Forward)
+	}
+
+	// payment providers post billing events to /api/webhooks/{name}
+	paymentProviders := webhooks.NewRegistry()
+	paymentProviders.Register("polka", &webhooks.Polka{
+		APIKey:       polkaKey,
+		Secret:       polkaSecret,
+		ReplayWindow: webhookReplayWindow,
+	})
+	if stripeSecret != "" {
+		paymentProviders.Register("stripe", &webhooks.Stripe{
+			Secret:    stripeSecret,
+			Tolerance: webhookReplayWindow,
+		})
+	}
+
 	apiCfg := apiConfig{
 		fileserverHits: atomic.Int32{},
 		db: dbQueries,
+		sqlDB: db,
 		platform: platformCfg,
 		authSecret: authSecret,
-		polkaKey: polkaKey,
+		paymentProviders: paymentProviders,
+		loginGuard: lockout.NewGuard(lockoutStore, lockout.DefaultPolicy()),
+		rateLimiter: rateLimiter,
+		passwordPolicy: passwordPolicy,
+		passwordHasher: passwordHasher,
+		deletionPolicy: accounts.DeletionPolicy{Grace: deletionGracePeriod},
+		emailChangePolicy: accounts.EmailChangePolicy{TTL: emailChangeTTL},
+		mailer: mailer.LogMailer{},
+		blobs: blobs,
+		mediaLimits: media.DefaultLimits(),
+		linkPreviews: linkPreviews,
+		eventDispatcher: eventDispatcher,
+		streamHub: streamHub,
+		webhookSender: &webhooks.Sender{Client: safehttp.NewClient(webhookClientOptions)},
 	}
 
+	// queue outbound webhooks for local events
+	eventBus.Subscribe("*", apiCfg.enqueueWebhooks)
+
 	mux := http.NewServeMux()
 	fsHandler := apiCfg.middlewareMetricsInc(http.StripPrefix("/app", http.FileServer(http.Dir(filepathRoot))))
 	mux.Handle("/app/", fsHandler)
+	mux.Handle("GET /media/", http.StripPrefix("/media", blobs.Handler()))
 
 	mux.HandleFunc("GET /api/healthz", handlerReadiness)
 	mux.HandleFunc("POST /api/login", apiCfg.handlerLogin)
@@ -56,18 +208,78 @@ func main() {
 	mux.HandleFunc("POST /api/revoke", apiCfg.handlerRevokeToken)
 	mux.HandleFunc("POST /api/users", apiCfg.handlerCreateUser)
 	mux.HandleFunc("PUT  /api/users", apiCfg.handlerUpdateUser)
+	mux.HandleFunc("DELETE /api/users/me", apiCfg.handlerDeleteAccount)
+	mux.HandleFunc("GET /api/users/me/export", apiCfg.handlerExportAccount)
+	mux.HandleFunc("PATCH /api/users/me", apiCfg.handlerPatchMe)
+	mux.HandleFunc("GET /api/users/me/blocks", apiCfg.handlerListRelated(relationships.Block))
+	mux.HandleFunc("POST /api/users/me/blocks", apiCfg.handlerAddRelated(relationships.Block))
+	mux.HandleFunc("DELETE /api/users/me/blocks/{userId}", apiCfg.handlerRemoveRelated(relationships.Block))
+	mux.HandleFunc("GET /api/users/me/mutes", apiCfg.handlerListRelated(relationships.Mute))
+	mux.HandleFunc("POST /api/users/me/mutes", apiCfg.handlerAddRelated(relationships.Mute))
+	mux.HandleFunc("DELETE /api/users/me/mutes/{userId}", apiCfg.handlerRemoveRelated(relationships.Mute))
+	mux.HandleFunc("POST /api/users/email/confirm", apiCfg.handlerConfirmEmailChange)
+	mux.HandleFunc("GET /api/users/{handleOrId}", apiCfg.handlerGetProfile)
+	mux.HandleFunc("GET /api/stream", apiCfg.handlerStream)
+	mux.HandleFunc("GET /api/ws", apiCfg.handlerWebSocket)
 	mux.HandleFunc("POST /api/chirps", apiCfg.handlerCreateChirp)
 	mux.HandleFunc("GET /api/chirps", apiCfg.handlerGetChirps)
 	mux.HandleFunc("GET /api/chirps/{chirpId}", apiCfg.handlerGetChirpById)
 	mux.HandleFunc("DELETE /api/chirps/{chirpId}", apiCfg.handlerDeleteChirp)
+	mux.HandleFunc("POST /api/chirps/{chirpId}/poll/votes", apiCfg.handlerVotePoll)
+	mux.HandleFunc("GET /api/bookmarks", apiCfg.handlerGetBookmarks)
+	mux.HandleFunc("POST /api/bookmarks", apiCfg.handlerCreateBookmark)
+	mux.HandleFunc("DELETE /api/bookmarks/{chirpId}", apiCfg.handlerDeleteBookmark)
+	mux.HandleFunc("GET /api/bookmarks/collections", apiCfg.handlerGetBookmarkCollections)
+	mux.HandleFunc("POST /api/bookmarks/collections", apiCfg.handlerCreateBookmarkCollection)
+	mux.HandleFunc("PUT /api/bookmarks/collections/{collectionId}", apiCfg.handlerRenameBookmarkCollection)
+	mux.HandleFunc("DELETE /api/bookmarks/collections/{collectionId}", apiCfg.handlerDeleteBookmarkCollection)
+	mux.HandleFunc("GET /api/conversations", apiCfg.handlerGetConversations)
+	mux.HandleFunc("POST /api/conversations", apiCfg.handlerCreateConversation)
+	mux.HandleFunc("GET /api/conversations/{conversationId}/messages", apiCfg.handlerGetMessages)
+	mux.HandleFunc("POST /api/conversations/{conversationId}/messages", apiCfg.handlerSendMessage)
+	mux.HandleFunc("POST /api/conversations/{conversationId}/read", apiCfg.handlerMarkConversationRead)
+	mux.HandleFunc("GET /api/notifications", apiCfg.handlerGetNotifications)
+	mux.HandleFunc("POST /api/notifications/read", apiCfg.handlerMarkNotificationsRead)
+	mux.HandleFunc("GET /api/notifications/preferences", apiCfg.handlerGetNotificationPreferences)
+	mux.HandleFunc("PUT /api/notifications/preferences", apiCfg.handlerUpdateNotificationPreferences)
+	mux.HandleFunc("POST /api/drafts", apiCfg.handlerCreateDraft)
+	mux.HandleFunc("GET /api/drafts", apiCfg.handlerListDrafts)
+	mux.HandleFunc("GET /api/drafts/{draftId}", apiCfg.handlerGetDraft)
+	mux.HandleFunc("PUT /api/drafts/{draftId}", apiCfg.handlerUpdateDraft)
+	mux.HandleFunc("DELETE /api/drafts/{draftId}", apiCfg.handlerDeleteDraft)
+	mux.HandleFunc("POST /api/drafts/{draftId}/publish", apiCfg.handlerPublishDraft)
 	mux.HandleFunc("POST /api/polka/webhooks", apiCfg.handlerPolkaWebhook)
+	mux.HandleFunc("POST /api/webhooks/{provider}", apiCfg.handlerProviderWebhook)
+	mux.HandleFunc("GET /api/integrations/webhooks", apiCfg.handlerGetWebhookEndpoints)
+	mux.HandleFunc("POST /api/integrations/webhooks", apiCfg.handlerCreateWebhookEndpoint)
+	mux.HandleFunc("GET /api/integrations/webhooks/{endpointId}", apiCfg.handlerGetWebhookEndpoint)
+	mux.HandleFunc("PUT /api/integrations/webhooks/{endpointId}", apiCfg.handlerUpdateWebhookEndpoint)
+	mux.HandleFunc("DELETE /api/integrations/webhooks/{endpointId}", apiCfg.handlerDeleteWebhookEndpoint)
+	mux.HandleFunc("GET /api/integrations/webhooks/{endpointId}/deliveries", apiCfg.handlerGetWebhookDeliveries)
+	mux.HandleFunc("POST /api/integrations/webhooks/{endpointId}/deliveries/{deliveryId}/retry", apiCfg.handlerRetryWebhookDelivery)
 
 	mux.HandleFunc("POST /admin/reset", apiCfg.handlerReset)
 	mux.HandleFunc("GET /admin/metrics", apiCfg.handlerMetrics)
 
+	go apiCfg.runRateLimitPruner(context.Background(), 10*time.Minute)
+	go apiCfg.runAccountPurger(context.Background(), time.Hour)
+	go linkPreviews.Run(context.Background(), 4)
+	go apiCfg.runChirpScheduler(context.Background(), 15*time.Second)
+	go eventDispatcher.Run(context.Background(), 2*time.Second)
+	go apiCfg.runWebhookReceiptPruner(context.Background(), time.Hour)
+	go apiCfg.runSubscriptionExpirer(context.Background(), time.Hour)
+	go apiCfg.runWebhookDispatcher(context.Background(), 5*time.Second)
+	if eventRelay != nil {
+		go func() {
+			if err := eventRelay.Run(context.Background()); err != nil {
+				log.Printf("event relay stopped: %s", err)
+			}
+		}()
+	}
+
 	srv := &http.Server{
 		Addr:    ":" + port,
-		Handler: mux,
+		Handler: apiCfg.middlewareRateLimit(mux),
 	}
 
 	log.Printf("Serving files from %s on port: %s\n", filepathRoot, port)
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"context"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"local/mda/internal/auth"
+)
+
+// middlewareRateLimit limits requests per client using the rule registered
+// for the mux pattern the request resolves to.
+func (cfg *apiConfig) middlewareRateLimit(mux *http.ServeMux) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, pattern := mux.Handler(r)
+
+		res, ok, err := cfg.rateLimiter.Allow(r.Context(), pattern, cfg.rateLimitKey(r))
+		if err != nil {
+			// fail open: a broken limiter store should not take the API down
+			log.Printf("rate limiter error: %s", err)
+			mux.ServeHTTP(w, r)
+			return
+		}
+		if ok {
+			w.Header().Set("RateLimit-Policy", res.Rule.Policy())
+			w.Header().Set("RateLimit-Limit", strconv.Itoa(res.Limit))
+			w.Header().Set("RateLimit-Remaining", strconv.Itoa(res.Remaining))
+			w.Header().Set("RateLimit-Reset", strconv.Itoa(int(math.Ceil(res.Reset.Seconds()))))
+			if !res.Allowed {
+				respondTooManyRequests(w, res.RetryAfter, "Rate limit exceeded")
+				return
+			}
+		}
+
+		mux.ServeHTTP(w, r)
+	})
+}
+
+// rateLimitKey identifies the client: the user for requests carrying a valid
+// access token, the remote address otherwise.
+func (cfg *apiConfig) rateLimitKey(r *http.Request) string {
+	if bearer, err := auth.GetBearerToken(r.Header); err == nil {
+		if userID, err := auth.ValidateJWT(bearer, cfg.authSecret); err == nil {
+			return "user:" + userID.String()
+		}
+	}
+	return "ip:" + clientIP(r)
+}
+
+func (cfg *apiConfig) runRateLimitPruner(ctx context.Context, every time.Duration) {
+	ticker := time.NewTicker(every)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := cfg.rateLimiter.Prune(ctx); err != nil {
+				log.Printf("pruning rate limit buckets: %s", err)
+			}
+		}
+	}
+}
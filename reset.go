@@ -14,11 +14,22 @@ func (cfg *apiConfig) handlerReset(w http.ResponseWriter, r *http.Request) {
 
 	cfg.fileserverHits.Store(0)
 
-	err := cfg.db.DeleteAllUsers(context.Background())
+	ctx := context.Background()
+	// deleting users cascades to chirp_media, so collect the blob keys first
+	media, err := cfg.db.ListAllMediaKeys(ctx)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Internal Error Listing Media", err)
+		return
+	}
+
+	err = cfg.db.DeleteAllUsers(ctx)
 	if err != nil {
 		respondWithError(w, http.StatusInternalServerError, "Internal Error Deleting Users", err)
 		return
 	}
+	for _, m := range media {
+		cfg.deleteBlobs(ctx, []string{m.StorageKey, m.ThumbnailKey})
+	}
 
 	w.WriteHeader(http.StatusOK)
 	w.Write([]byte("Hits reset to 0"))
@@ -0,0 +1,52 @@
+-- name: CreateBookmarkCollection :one
+INSERT INTO bookmark_collections (id, user_id, name, created_at, updated_at)
+VALUES (gen_random_uuid(), $1, $2, NOW(), NOW())
+RETURNING *;
+
+-- name: GetBookmarkCollection :one
+SELECT * FROM bookmark_collections
+WHERE id = $1 AND user_id = $2;
+
+-- name: ListBookmarkCollections :many
+SELECT * FROM bookmark_collections
+WHERE user_id = $1
+ORDER BY name ASC;
+
+-- name: RenameBookmarkCollection :one
+UPDATE bookmark_collections
+SET name = $3, updated_at = NOW()
+WHERE id = $1 AND user_id = $2
+RETURNING *;
+
+-- name: DeleteBookmarkCollection :execrows
+DELETE FROM bookmark_collections
+WHERE id = $1 AND user_id = $2;
+
+-- name: UpsertBookmark :one
+INSERT INTO bookmarks (user_id, chirp_id, collection_id, created_at)
+VALUES ($1, $2, $3, NOW())
+ON CONFLICT (user_id, chirp_id) DO UPDATE
+SET collection_id = EXCLUDED.collection_id
+RETURNING *;
+
+-- name: DeleteBookmark :execrows
+DELETE FROM bookmarks
+WHERE user_id = $1 AND chirp_id = $2;
+
+-- name: ListBookmarks :many
+SELECT bookmarks.* FROM bookmarks
+JOIN chirps ON chirps.id = bookmarks.chirp_id
+JOIN users ON users.id = chirps.user_id
+WHERE bookmarks.user_id = @user_id
+  AND users.deleted_at IS NULL
+  AND (chirps.published_at IS NOT NULL OR chirps.user_id = @user_id)
+  AND (sqlc.narg(collection_id)::uuid IS NULL OR bookmarks.collection_id = sqlc.narg(collection_id))
+ORDER BY
+    CASE WHEN @newest_first::bool THEN bookmarks.created_at END DESC,
+    CASE WHEN NOT @newest_first::bool THEN bookmarks.created_at END ASC,
+    bookmarks.chirp_id
+LIMIT sqlc.narg(page_limit) OFFSET @page_offset;
+
+-- name: ListBookmarkersForChirp :many
+SELECT user_id FROM bookmarks
+WHERE chirp_id = $1;
@@ -0,0 +1,18 @@
+-- name: CreateChirpMedia :one
+INSERT INTO chirp_media (id, chirp_id, position, content_type, size_bytes, width, height, storage_key, thumbnail_key, created_at)
+VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, NOW())
+RETURNING *;
+
+-- name: ListMediaForChirps :many
+SELECT * FROM chirp_media
+WHERE chirp_id = ANY(@chirp_ids::uuid[])
+ORDER BY chirp_id, position ASC;
+
+-- name: ListAllMediaKeys :many
+SELECT storage_key, thumbnail_key FROM chirp_media;
+
+-- name: ListMediaKeysForPurge :many
+SELECT m.storage_key, m.thumbnail_key FROM chirp_media m
+JOIN chirps c ON c.id = m.chirp_id
+JOIN users u ON u.id = c.user_id
+WHERE u.deleted_at IS NOT NULL AND u.deleted_at < @cutoff::timestamp;
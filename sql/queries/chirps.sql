@@ -1,29 +1,76 @@
 -- name: CreateChirp :one
-INSERT INTO chirps (id, created_at, updated_at, body, user_id)
+INSERT INTO chirps (id, created_at, updated_at, body, user_id, publish_at, published_at)
 VALUES (
     gen_random_uuid(),
     NOW(),
     NOW(),
     $1,
-    $2
+    $2,
+    $3,
+    $4
 )
 RETURNING *;
 
 
 -- name: GetChirps :many
-SELECT * FROM chirps
-ORDER BY created_at ASC;
+SELECT chirps.* FROM chirps
+JOIN users ON users.id = chirps.user_id
+WHERE users.deleted_at IS NULL
+  AND (chirps.published_at IS NOT NULL OR chirps.user_id = @viewer_id)
+  AND chirps.user_id <> ALL(coalesce(@hidden_author_ids::uuid[], '{}'))
+ORDER BY
+    CASE WHEN @newest_first::bool THEN chirps.publish_at END DESC,
+    CASE WHEN NOT @newest_first::bool THEN chirps.publish_at END ASC,
+    chirps.id
+LIMIT sqlc.narg(page_limit) OFFSET @page_offset;
 
 -- name: GetChirpById :one
-SELECT * FROM chirps
-WHERE id = $1;
+SELECT chirps.* FROM chirps
+JOIN users ON users.id = chirps.user_id
+WHERE chirps.id = @id AND users.deleted_at IS NULL
+  AND (chirps.published_at IS NOT NULL OR chirps.user_id = @viewer_id)
+  AND chirps.user_id <> ALL(coalesce(@hidden_author_ids::uuid[], '{}'));
 
 -- name: DeleteChirp :exec
 DELETE FROM chirps
 WHERE id = $1;
 
 -- name: GetChirpsByAuthor :many
-SELECT id, created_at, updated_at, body, user_id
+SELECT chirps.id, chirps.created_at, chirps.updated_at, chirps.body, chirps.user_id, chirps.publish_at, chirps.published_at
 FROM chirps
+JOIN users ON users.id = chirps.user_id
+WHERE chirps.user_id = @user_id AND users.deleted_at IS NULL
+  AND (chirps.published_at IS NOT NULL OR chirps.user_id = @viewer_id)
+  AND chirps.user_id <> ALL(coalesce(@hidden_author_ids::uuid[], '{}'))
+ORDER BY
+    CASE WHEN @newest_first::bool THEN chirps.publish_at END DESC,
+    CASE WHEN NOT @newest_first::bool THEN chirps.publish_at END ASC,
+    chirps.id
+LIMIT sqlc.narg(page_limit) OFFSET @page_offset;
+
+-- name: ListAllChirpsByAuthor :many
+SELECT * FROM chirps
 WHERE user_id = $1
 ORDER BY created_at ASC;
+
+-- name: PublishDueChirps :many
+UPDATE chirps
+SET
+    published_at = @now::timestamp,
+    updated_at   = NOW()
+WHERE published_at IS NULL AND publish_at <= @now::timestamp
+  -- accounts pending deletion keep their scheduled chirps back; they go
+  -- out on the next run if the account is restored
+  AND user_id IN (SELECT id FROM users WHERE deleted_at IS NULL)
+RETURNING *;
+
+-- name: GetChirpsByIds :many
+SELECT * FROM chirps
+WHERE id = ANY(@ids::uuid[]);
+
+-- name: LockChirpQuota :exec
+SELECT pg_advisory_xact_lock(hashtext('chirp_quota:' || @user_id::text));
+
+-- name: CountChirpsByAuthorSince :one
+SELECT COUNT(*) FROM chirps
+WHERE user_id = $1 AND created_at >= $2;
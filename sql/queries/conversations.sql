@@ -0,0 +1,88 @@
+-- name: CreateConversation :one
+INSERT INTO conversations (id, is_group, created_by, created_at, updated_at)
+VALUES (gen_random_uuid(), $1, $2, NOW(), NOW())
+RETURNING *;
+
+-- name: AddConversationMember :exec
+INSERT INTO conversation_members (conversation_id, user_id, joined_at)
+VALUES ($1, $2, NOW());
+
+-- name: FindDirectConversation :one
+SELECT conversations.* FROM conversations
+WHERE NOT conversations.is_group
+  AND EXISTS (
+      SELECT 1 FROM conversation_members
+      WHERE conversation_id = conversations.id AND user_id = @user_id
+  )
+  AND EXISTS (
+      SELECT 1 FROM conversation_members
+      WHERE conversation_id = conversations.id AND user_id = @other_id
+  )
+LIMIT 1;
+
+-- name: LockDirectPair :exec
+SELECT pg_advisory_xact_lock(hashtext(@pair_key::text));
+
+-- name: GetConversationForMember :one
+SELECT conversations.* FROM conversations
+JOIN conversation_members ON conversation_members.conversation_id = conversations.id
+WHERE conversations.id = @id AND conversation_members.user_id = @user_id;
+
+-- name: ListConversationsForUser :many
+SELECT conversations.* FROM conversations
+JOIN conversation_members ON conversation_members.conversation_id = conversations.id
+WHERE conversation_members.user_id = @user_id
+ORDER BY
+    CASE WHEN @newest_first::bool THEN conversations.updated_at END DESC,
+    CASE WHEN NOT @newest_first::bool THEN conversations.updated_at END ASC,
+    conversations.id
+LIMIT sqlc.narg(page_limit) OFFSET @page_offset;
+
+-- name: ListConversationMembers :many
+SELECT * FROM conversation_members
+WHERE conversation_id = ANY(@conversation_ids::uuid[])
+ORDER BY conversation_id, joined_at ASC;
+
+-- name: TouchConversation :exec
+UPDATE conversations
+SET updated_at = NOW()
+WHERE id = $1;
+
+-- name: MarkConversationRead :exec
+UPDATE conversation_members
+SET last_read_at = @read_at::timestamp
+WHERE conversation_id = @conversation_id AND user_id = @user_id;
+
+-- name: CreateMessage :one
+INSERT INTO messages (id, conversation_id, sender_id, body, created_at)
+VALUES (gen_random_uuid(), $1, $2, $3, NOW())
+RETURNING *;
+
+-- name: ListMessages :many
+SELECT * FROM messages
+WHERE conversation_id = @conversation_id
+ORDER BY
+    CASE WHEN @newest_first::bool THEN created_at END DESC,
+    CASE WHEN NOT @newest_first::bool THEN created_at END ASC,
+    id
+LIMIT @page_limit OFFSET @page_offset;
+
+-- name: LatestMessages :many
+SELECT DISTINCT ON (conversation_id) * FROM messages
+WHERE conversation_id = ANY(@conversation_ids::uuid[])
+ORDER BY conversation_id, created_at DESC;
+
+-- name: CountUnreadMessages :many
+SELECT messages.conversation_id, COUNT(*) AS unread FROM messages
+JOIN conversation_members ON conversation_members.conversation_id = messages.conversation_id
+WHERE conversation_members.user_id = @user_id
+  AND messages.sender_id <> @user_id
+  AND (conversation_members.last_read_at IS NULL OR messages.created_at > conversation_members.last_read_at)
+GROUP BY messages.conversation_id;
+
+-- name: HasWrittenTo :one
+SELECT EXISTS (
+    SELECT 1 FROM messages
+    JOIN conversation_members ON conversation_members.conversation_id = messages.conversation_id
+    WHERE messages.sender_id = @author_id AND conversation_members.user_id = @reader_id
+);
@@ -0,0 +1,28 @@
+-- name: CreateDomainEvent :exec
+INSERT INTO domain_events (id, type, user_id, payload, occurred_at, next_attempt_at)
+VALUES ($1, $2, $3, $4, $5, $5);
+
+-- name: ClaimDomainEvents :many
+UPDATE domain_events
+SET next_attempt_at = @lease_until::timestamp
+WHERE id IN (
+    SELECT id FROM domain_events
+    WHERE dispatched_at IS NULL AND next_attempt_at <= @now::timestamp
+    ORDER BY occurred_at
+    LIMIT @batch_size
+    FOR UPDATE SKIP LOCKED
+)
+RETURNING *;
+
+-- name: GetDomainEvent :one
+SELECT * FROM domain_events
+WHERE id = $1;
+
+-- name: MarkDomainEventDispatched :exec
+UPDATE domain_events
+SET dispatched_at = $2
+WHERE id = $1;
+
+-- name: PruneDomainEvents :execrows
+DELETE FROM domain_events
+WHERE dispatched_at < $1;
@@ -0,0 +1,28 @@
+-- name: CreateDraft :one
+INSERT INTO drafts (id, user_id, body, publish_at, created_at, updated_at)
+VALUES (gen_random_uuid(), $1, $2, $3, NOW(), NOW())
+RETURNING *;
+
+-- name: GetDraft :one
+SELECT * FROM drafts
+WHERE id = $1 AND user_id = $2;
+
+-- name: GetDraftForUpdate :one
+SELECT * FROM drafts
+WHERE id = $1 AND user_id = $2
+FOR UPDATE;
+
+-- name: ListDraftsByUser :many
+SELECT * FROM drafts
+WHERE user_id = $1
+ORDER BY updated_at DESC;
+
+-- name: UpdateDraft :one
+UPDATE drafts
+SET body = $3, publish_at = $4, updated_at = NOW()
+WHERE id = $1 AND user_id = $2
+RETURNING *;
+
+-- name: DeleteDraft :execrows
+DELETE FROM drafts
+WHERE id = $1 AND user_id = $2;
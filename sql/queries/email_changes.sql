@@ -0,0 +1,12 @@
+-- name: CreateEmailChange :one
+INSERT INTO email_changes (token_hash, user_id, new_email, created_at, expires_at)
+VALUES ($1, $2, $3, NOW(), $4)
+RETURNING *;
+
+-- name: GetEmailChangeByTokenHash :one
+SELECT * FROM email_changes
+WHERE token_hash = $1;
+
+-- name: DeleteEmailChangesForUser :exec
+DELETE FROM email_changes
+WHERE user_id = $1;
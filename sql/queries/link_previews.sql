@@ -0,0 +1,18 @@
+-- name: GetLinkPreview :one
+SELECT * FROM link_previews
+WHERE url = $1;
+
+-- name: ListLinkPreviews :many
+SELECT * FROM link_previews
+WHERE url = ANY(@urls::text[]) AND failed = FALSE;
+
+-- name: UpsertLinkPreview :exec
+INSERT INTO link_previews (url, title, description, image_url, failed, fetched_at)
+VALUES ($1, $2, $3, $4, $5, $6)
+ON CONFLICT (url) DO UPDATE
+SET
+    title       = EXCLUDED.title,
+    description = EXCLUDED.description,
+    image_url   = EXCLUDED.image_url,
+    failed      = EXCLUDED.failed,
+    fetched_at  = EXCLUDED.fetched_at;
@@ -0,0 +1,37 @@
+-- name: GetLoginFailure :one
+SELECT * FROM login_failures
+WHERE email = $1;
+
+-- name: AddLoginFailure :one
+INSERT INTO login_failures (email, failures, last_failed_at)
+VALUES (@email, 1, @failed_at)
+ON CONFLICT (email) DO UPDATE
+SET
+    failures       = CASE WHEN login_failures.last_failed_at < @reset_before::timestamp
+                          THEN 1 ELSE login_failures.failures + 1 END,
+    locked_until   = CASE WHEN login_failures.last_failed_at < @reset_before::timestamp
+                          THEN NULL ELSE login_failures.locked_until END,
+    last_failed_at = EXCLUDED.last_failed_at
+RETURNING failures;
+
+-- name: ExtendLoginLock :exec
+UPDATE login_failures
+SET locked_until = GREATEST(locked_until, @locked_until::timestamp)
+WHERE email = @email;
+
+-- name: DeleteLoginFailure :exec
+DELETE FROM login_failures
+WHERE email = $1;
+
+-- name: CreateLoginIPAttempt :exec
+INSERT INTO login_ip_attempts (ip, attempted_at)
+VALUES ($1, $2);
+
+-- name: ListLoginIPAttemptsSince :many
+SELECT attempted_at FROM login_ip_attempts
+WHERE ip = $1 AND attempted_at > $2
+ORDER BY attempted_at ASC;
+
+-- name: DeleteLoginIPAttemptsBefore :exec
+DELETE FROM login_ip_attempts
+WHERE ip = $1 AND attempted_at < $2;
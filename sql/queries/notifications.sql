@@ -0,0 +1,40 @@
+-- name: CreateNotification :execrows
+INSERT INTO notifications (id, user_id, type, data, created_at)
+SELECT gen_random_uuid(), @user_id, @type, @data, NOW()
+WHERE NOT EXISTS (
+    SELECT 1 FROM notification_preferences
+    WHERE notification_preferences.user_id = @user_id
+      AND notification_preferences.type = @type
+      AND NOT notification_preferences.enabled
+);
+
+-- name: ListNotifications :many
+SELECT * FROM notifications
+WHERE user_id = @user_id
+  AND (NOT @unread_only::bool OR read_at IS NULL)
+ORDER BY
+    CASE WHEN @newest_first::bool THEN created_at END DESC,
+    CASE WHEN NOT @newest_first::bool THEN created_at END ASC,
+    id
+LIMIT @page_limit OFFSET @page_offset;
+
+-- name: CountUnreadNotifications :one
+SELECT COUNT(*) FROM notifications
+WHERE user_id = $1 AND read_at IS NULL;
+
+-- name: MarkNotificationsRead :execrows
+UPDATE notifications
+SET read_at = @read_at::timestamp
+WHERE user_id = @user_id
+  AND read_at IS NULL
+  AND (@mark_all::bool OR id = ANY(@ids::uuid[]));
+
+-- name: ListNotificationPreferences :many
+SELECT * FROM notification_preferences
+WHERE user_id = $1;
+
+-- name: UpsertNotificationPreference :exec
+INSERT INTO notification_preferences (user_id, type, enabled)
+VALUES ($1, $2, $3)
+ON CONFLICT (user_id, type) DO UPDATE
+SET enabled = EXCLUDED.enabled;
@@ -0,0 +1,34 @@
+-- name: CreatePoll :exec
+INSERT INTO polls (chirp_id, closes_at, created_at)
+VALUES ($1, $2, NOW());
+
+-- name: CreatePollOption :exec
+INSERT INTO poll_options (id, chirp_id, position, label)
+VALUES (gen_random_uuid(), $1, $2, $3);
+
+-- name: GetPoll :one
+SELECT * FROM polls
+WHERE chirp_id = $1;
+
+-- name: ListPollsForChirps :many
+SELECT * FROM polls
+WHERE chirp_id = ANY(@chirp_ids::uuid[]);
+
+-- name: ListPollOptionsForChirps :many
+SELECT * FROM poll_options
+WHERE chirp_id = ANY(@chirp_ids::uuid[])
+ORDER BY chirp_id, position ASC;
+
+-- name: CountPollVotes :many
+SELECT option_id, COUNT(*) AS votes FROM poll_votes
+WHERE chirp_id = ANY(@chirp_ids::uuid[])
+GROUP BY option_id;
+
+-- name: ListPollVotesByUser :many
+SELECT * FROM poll_votes
+WHERE chirp_id = ANY(@chirp_ids::uuid[]) AND user_id = @user_id;
+
+-- name: CreatePollVote :execrows
+INSERT INTO poll_votes (chirp_id, user_id, option_id, created_at)
+VALUES ($1, $2, $3, NOW())
+ON CONFLICT (chirp_id, user_id) DO NOTHING;
@@ -0,0 +1,36 @@
+-- name: GetSubscription :one
+SELECT * FROM subscriptions
+WHERE user_id = $1;
+
+-- name: GetSubscriptionForUpdate :one
+SELECT * FROM subscriptions
+WHERE user_id = $1
+FOR UPDATE;
+
+-- name: UpsertSubscription :one
+INSERT INTO subscriptions (user_id, plan, status, current_period_end, last_event_at, created_at, updated_at)
+VALUES ($1, $2, $3, $4, $5, NOW(), NOW())
+ON CONFLICT (user_id) DO UPDATE
+SET plan = EXCLUDED.plan,
+    status = EXCLUDED.status,
+    current_period_end = EXCLUDED.current_period_end,
+    last_event_at = EXCLUDED.last_event_at,
+    updated_at = NOW()
+RETURNING *;
+
+-- name: CreateSubscriptionEvent :exec
+INSERT INTO subscription_events (id, user_id, event, plan, status, current_period_end, occurred_at)
+VALUES (gen_random_uuid(), $1, $2, $3, $4, $5, NOW());
+
+-- name: ListSubscriptionEvents :many
+SELECT * FROM subscription_events
+WHERE user_id = $1
+ORDER BY occurred_at ASC;
+
+-- name: ListLapsedSubscriptions :many
+SELECT * FROM subscriptions
+WHERE (status IN ('active', 'past_due') AND current_period_end < @grace_cutoff::timestamp)
+   OR (status = 'canceled' AND current_period_end <= @now::timestamp)
+ORDER BY current_period_end
+LIMIT @batch_size
+FOR UPDATE SKIP LOCKED;
@@ -0,0 +1,27 @@
+-- name: CreateUserRelationship :exec
+INSERT INTO user_relationships (user_id, target_id, kind, created_at)
+VALUES ($1, $2, $3, NOW())
+ON CONFLICT DO NOTHING;
+
+-- name: DeleteUserRelationship :execrows
+DELETE FROM user_relationships
+WHERE user_id = $1 AND target_id = $2 AND kind = $3;
+
+-- name: ListRelatedUsers :many
+SELECT users.* FROM user_relationships
+JOIN users ON users.id = user_relationships.target_id
+WHERE user_relationships.user_id = $1
+  AND user_relationships.kind = $2
+  AND users.deleted_at IS NULL
+ORDER BY user_relationships.created_at DESC;
+
+-- name: IsBlockedBetween :one
+SELECT EXISTS (
+    SELECT 1 FROM user_relationships
+    WHERE kind = 'block'
+      AND ((user_id = $1 AND target_id = $2) OR (user_id = $2 AND target_id = $1))
+);
+
+-- name: ListRelationshipsInvolving :many
+SELECT * FROM user_relationships
+WHERE user_id = $1 OR target_id = $1;
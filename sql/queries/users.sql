@@ -33,3 +33,84 @@ SET
 WHERE id = $1
 RETURNING id, created_at, updated_at, email, is_chirpy_red;
 
+
+-- name: RehashUserPassword :exec
+UPDATE users
+SET hashed_password = @new_hash
+WHERE id = @id AND hashed_password = @old_hash;
+
+-- name: GetUserById :one
+SELECT * FROM users
+WHERE id = $1;
+
+-- name: SoftDeleteUser :one
+UPDATE users
+SET
+    deleted_at = @deleted_at::timestamp,
+    updated_at = NOW()
+WHERE id = @id AND deleted_at IS NULL
+RETURNING *;
+
+-- name: RestoreUser :exec
+UPDATE users
+SET
+    deleted_at = NULL,
+    updated_at = NOW()
+WHERE id = $1;
+
+-- name: PurgeDeletedUsers :execrows
+DELETE FROM users
+WHERE deleted_at IS NOT NULL AND deleted_at < @cutoff::timestamp;
+
+-- name: GetUserByHandle :one
+SELECT * FROM users
+WHERE handle = $1;
+
+-- name: GetUsersByIds :many
+SELECT * FROM users
+WHERE id = ANY(@ids::uuid[]);
+
+-- name: UpdateUserProfile :one
+UPDATE users
+SET
+    handle       = $2,
+    display_name = $3,
+    bio          = $4,
+    avatar_url   = $5,
+    updated_at   = NOW()
+WHERE id = $1
+RETURNING *;
+
+-- name: UpdateUserPassword :exec
+UPDATE users
+SET
+    hashed_password = $2,
+    updated_at      = NOW()
+WHERE id = $1;
+
+-- name: UpdateUserEmail :one
+UPDATE users
+SET
+    email      = $2,
+    updated_at = NOW()
+WHERE id = $1
+RETURNING *;
+
+-- name: SetAllowStrangerDms :one
+UPDATE users
+SET allow_stranger_dms = $2, updated_at = NOW()
+WHERE id = $1
+RETURNING *;
+
+-- name: SetUserChirpyRed :execrows
+UPDATE users
+SET
+    is_chirpy_red = $2,
+    updated_at    = NOW()
+WHERE id = $1;
+
+-- name: UserIsActive :one
+SELECT EXISTS (
+    SELECT 1 FROM users
+    WHERE id = $1 AND deleted_at IS NULL
+);
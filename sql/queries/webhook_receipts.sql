@@ -0,0 +1,8 @@
+-- name: RecordWebhookReceipt :execrows
+INSERT INTO webhook_receipts (provider, delivery_id, event, received_at)
+VALUES ($1, $2, $3, NOW())
+ON CONFLICT (provider, delivery_id) DO NOTHING;
+
+-- name: PruneWebhookReceipts :execrows
+DELETE FROM webhook_receipts
+WHERE received_at < $1;
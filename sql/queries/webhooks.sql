@@ -0,0 +1,75 @@
+-- name: CreateWebhookEndpoint :one
+INSERT INTO webhook_endpoints (id, created_at, updated_at, user_id, url, secret, event_types, active)
+VALUES (gen_random_uuid(), NOW(), NOW(), $1, $2, $3, $4, TRUE)
+RETURNING *;
+
+-- name: ListWebhookEndpoints :many
+SELECT * FROM webhook_endpoints
+WHERE user_id = $1
+ORDER BY created_at ASC;
+
+-- name: CountWebhookEndpoints :one
+SELECT COUNT(*) FROM webhook_endpoints
+WHERE user_id = $1;
+
+-- name: GetWebhookEndpoint :one
+SELECT * FROM webhook_endpoints
+WHERE id = $1 AND user_id = $2;
+
+-- name: UpdateWebhookEndpoint :one
+UPDATE webhook_endpoints
+SET url = $3, event_types = $4, active = $5, updated_at = NOW()
+WHERE id = $1 AND user_id = $2
+RETURNING *;
+
+-- name: DeleteWebhookEndpoint :execrows
+DELETE FROM webhook_endpoints
+WHERE id = $1 AND user_id = $2;
+
+-- name: EnqueueWebhookDeliveries :execrows
+INSERT INTO webhook_deliveries (id, endpoint_id, event_id, event_type, payload, status, attempts, next_attempt_at, created_at)
+SELECT gen_random_uuid(), id, @event_id, @event_type::text, @payload, 'pending', 0, NOW(), NOW()
+FROM webhook_endpoints
+WHERE user_id = @user_id
+  AND active
+  AND @event_type::text = ANY(event_types)
+ON CONFLICT (endpoint_id, event_id) DO NOTHING;
+
+-- name: ClaimDueWebhookDeliveries :many
+UPDATE webhook_deliveries d
+SET next_attempt_at = @lease_until::timestamp
+FROM webhook_endpoints e
+WHERE e.id = d.endpoint_id
+  AND d.id IN (
+    SELECT id FROM webhook_deliveries
+    WHERE status = 'pending' AND next_attempt_at <= @now::timestamp
+    ORDER BY next_attempt_at
+    LIMIT @batch_size
+    FOR UPDATE SKIP LOCKED
+  )
+RETURNING d.id, d.event_type, d.payload, d.attempts, e.url, e.secret;
+
+-- name: RecordWebhookAttempt :exec
+UPDATE webhook_deliveries
+SET status = @status,
+    attempts = attempts + 1,
+    last_attempt_at = @attempted_at,
+    response_status = @response_status,
+    last_error = @last_error,
+    next_attempt_at = @next_attempt_at
+WHERE id = @id;
+
+-- name: ListWebhookDeliveries :many
+SELECT * FROM webhook_deliveries
+WHERE endpoint_id = @endpoint_id
+  AND (@status::text = '' OR status = @status::text)
+ORDER BY
+    CASE WHEN @newest_first::bool THEN created_at END DESC,
+    CASE WHEN NOT @newest_first::bool THEN created_at END ASC
+LIMIT @page_limit OFFSET @page_offset;
+
+-- name: RetryWebhookDelivery :one
+UPDATE webhook_deliveries
+SET status = 'pending', attempts = 0, next_attempt_at = NOW()
+WHERE id = $1 AND endpoint_id = $2 AND status = 'failed'
+RETURNING *;
@@ -0,0 +1,19 @@
+-- +goose Up
+CREATE TABLE login_failures (
+    email TEXT PRIMARY KEY,
+    failures INTEGER NOT NULL,
+    last_failed_at TIMESTAMP NOT NULL,
+    locked_until TIMESTAMP NULL
+);
+
+CREATE TABLE login_ip_attempts (
+    id BIGSERIAL PRIMARY KEY,
+    ip TEXT NOT NULL,
+    attempted_at TIMESTAMP NOT NULL
+);
+
+CREATE INDEX login_ip_attempts_ip_attempted_at_idx ON login_ip_attempts (ip, attempted_at);
+
+-- +goose Down
+DROP TABLE login_ip_attempts;
+DROP TABLE login_failures;
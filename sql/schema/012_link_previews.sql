@@ -0,0 +1,12 @@
+-- +goose Up
+CREATE TABLE link_previews (
+    url TEXT PRIMARY KEY,
+    title TEXT NOT NULL,
+    description TEXT NOT NULL,
+    image_url TEXT NOT NULL,
+    failed BOOLEAN NOT NULL,
+    fetched_at TIMESTAMP NOT NULL
+);
+
+-- +goose Down
+DROP TABLE link_previews;
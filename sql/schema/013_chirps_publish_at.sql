@@ -0,0 +1,16 @@
+-- +goose Up
+ALTER TABLE chirps
+ADD COLUMN publish_at TIMESTAMP NULL,
+ADD COLUMN published_at TIMESTAMP NULL;
+
+UPDATE chirps SET publish_at = created_at, published_at = created_at;
+
+ALTER TABLE chirps
+ALTER COLUMN publish_at SET NOT NULL;
+
+CREATE INDEX chirps_unpublished_publish_at_idx ON chirps (publish_at) WHERE published_at IS NULL;
+
+-- +goose Down
+ALTER TABLE chirps
+DROP COLUMN published_at,
+DROP COLUMN publish_at;
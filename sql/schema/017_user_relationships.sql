@@ -0,0 +1,14 @@
+-- +goose Up
+CREATE TABLE user_relationships (
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    target_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    kind TEXT NOT NULL CHECK (kind IN ('block', 'mute')),
+    created_at TIMESTAMP NOT NULL,
+    PRIMARY KEY (user_id, target_id, kind),
+    CHECK (user_id <> target_id)
+);
+
+CREATE INDEX user_relationships_target_id_idx ON user_relationships (target_id, kind);
+
+-- +goose Down
+DROP TABLE user_relationships;
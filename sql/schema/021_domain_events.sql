@@ -0,0 +1,17 @@
+-- +goose Up
+-- written in the same transaction as the change it describes, then handed
+-- to in-process subscribers by the dispatcher
+CREATE TABLE domain_events (
+    id UUID PRIMARY KEY,
+    type TEXT NOT NULL,
+    user_id UUID NOT NULL,
+    payload JSONB NOT NULL,
+    occurred_at TIMESTAMP NOT NULL,
+    next_attempt_at TIMESTAMP NOT NULL,
+    dispatched_at TIMESTAMP NULL
+);
+
+CREATE INDEX domain_events_undispatched_idx ON domain_events (next_attempt_at) WHERE dispatched_at IS NULL;
+
+-- +goose Down
+DROP TABLE domain_events;
@@ -0,0 +1,15 @@
+-- +goose Up
+-- inbound webhook deliveries already processed, so retries are acknowledged
+-- without being applied twice
+CREATE TABLE webhook_receipts (
+    provider TEXT NOT NULL,
+    delivery_id TEXT NOT NULL,
+    event TEXT NOT NULL,
+    received_at TIMESTAMP NOT NULL,
+    PRIMARY KEY (provider, delivery_id)
+);
+
+CREATE INDEX webhook_receipts_received_at_idx ON webhook_receipts (received_at);
+
+-- +goose Down
+DROP TABLE webhook_receipts;
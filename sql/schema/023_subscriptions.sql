@@ -0,0 +1,34 @@
+-- +goose Up
+CREATE TABLE subscriptions (
+    user_id UUID PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+    plan TEXT NOT NULL,
+    status TEXT NOT NULL,
+    current_period_end TIMESTAMP NULL,
+    created_at TIMESTAMP NOT NULL,
+    updated_at TIMESTAMP NOT NULL
+);
+
+CREATE INDEX subscriptions_current_period_end_idx ON subscriptions (current_period_end) WHERE status <> 'expired';
+
+-- every billing event applied, with the state it left the subscription in
+CREATE TABLE subscription_events (
+    id UUID PRIMARY KEY,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    event TEXT NOT NULL,
+    plan TEXT NOT NULL,
+    status TEXT NOT NULL,
+    current_period_end TIMESTAMP NULL,
+    occurred_at TIMESTAMP NOT NULL
+);
+
+CREATE INDEX subscription_events_user_id_idx ON subscription_events (user_id, occurred_at);
+
+-- existing upgrades predate billing periods, so they have none and never lapse
+INSERT INTO subscriptions (user_id, plan, status, current_period_end, created_at, updated_at)
+SELECT id, 'chirpy_red', 'active', NULL, updated_at, updated_at
+FROM users
+WHERE is_chirpy_red;
+
+-- +goose Down
+DROP TABLE subscription_events;
+DROP TABLE subscriptions;
@@ -0,0 +1,7 @@
+-- +goose Up
+-- provider time of the newest billing event applied, so deliveries that
+-- arrive out of order can't roll a subscription back
+ALTER TABLE subscriptions ADD COLUMN last_event_at TIMESTAMP NULL;
+
+-- +goose Down
+ALTER TABLE subscriptions DROP COLUMN last_event_at;
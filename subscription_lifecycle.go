@@ -0,0 +1,218 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log"
+	"time"
+
+	"local/mda/internal/database"
+	"local/mda/internal/events"
+	"local/mda/internal/notifications"
+	"local/mda/internal/subscriptions"
+
+	"github.com/google/uuid"
+)
+
+// subscriptionExpiryBatch bounds how many lapsed subscriptions one pass of
+// the expiry job downgrades.
+const subscriptionExpiryBatch = 100
+
+type subscriptionPayload struct {
+	UserId           uuid.UUID  `json:"user_id"`
+	IsChirpyRed      bool       `json:"is_chirpy_red"`
+	Plan             string     `json:"plan"`
+	Status           string     `json:"status"`
+	CurrentPeriodEnd *time.Time `json:"current_period_end"`
+}
+
+func subscriptionState(row database.Subscription) subscriptions.State {
+	return subscriptions.State{
+		Plan:             row.Plan,
+		Status:           row.Status,
+		CurrentPeriodEnd: timePtr(row.CurrentPeriodEnd),
+		LastEventAt:      timePtr(row.LastEventAt),
+	}
+}
+
+func timePtr(t sql.NullTime) *time.Time {
+	if !t.Valid {
+		return nil
+	}
+	return &t.Time
+}
+
+func nullTime(t *time.Time) sql.NullTime {
+	if t == nil {
+		return sql.NullTime{}
+	}
+	return sql.NullTime{Time: *t, Valid: true}
+}
+
+// applySubscriptionEvent moves userID's subscription through a billing
+// event inside the caller's transaction: it stores the new state and its
+// history entry, keeps users.is_chirpy_red in step, and notifies the user
+// and records user.upgraded or user.downgraded when that flag changes.
+// Events that don't apply to the current state, or that the provider
+// created before the last one applied (occurredAt, zero when unknown), are
+// ignored. It returns sql.ErrNoRows when the user doesn't exist.
+func (cfg *apiConfig) applySubscriptionEvent(ctx context.Context, q *database.Queries, userID uuid.UUID, event string, periodEnd *time.Time, occurredAt time.Time) error {
+	var current subscriptions.State
+	row, err := q.GetSubscriptionForUpdate(ctx, userID)
+	switch {
+	case err == nil:
+		current = subscriptionState(row)
+	case !errors.Is(err, sql.ErrNoRows):
+		return err
+	}
+
+	if current.Stale(occurredAt) {
+		log.Printf("ignoring %s for user %s from %s, older than the last event applied", event, userID, occurredAt)
+		return nil
+	}
+
+	next, err := subscriptions.Apply(current, event, periodEnd)
+	if err != nil {
+		return err
+	}
+	if !occurredAt.IsZero() {
+		t := occurredAt.UTC()
+		next.LastEventAt = &t
+	}
+	if next.Status == "" {
+		// nothing to cancel or downgrade, but an unknown user is still an
+		// error rather than a silent success
+		_, err := q.GetUserById(ctx, userID)
+		return err
+	}
+
+	now := time.Now().UTC()
+	was, entitled := current.Entitled(now), next.Entitled(now)
+	n, err := q.SetUserChirpyRed(ctx, database.SetUserChirpyRedParams{
+		ID:          userID,
+		IsChirpyRed: entitled,
+	})
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return sql.ErrNoRows
+	}
+
+	_, err = q.UpsertSubscription(ctx, database.UpsertSubscriptionParams{
+		UserID:           userID,
+		Plan:             next.Plan,
+		Status:           next.Status,
+		CurrentPeriodEnd: nullTime(next.CurrentPeriodEnd),
+		LastEventAt:      nullTime(next.LastEventAt),
+	})
+	if err != nil {
+		return err
+	}
+	err = q.CreateSubscriptionEvent(ctx, database.CreateSubscriptionEventParams{
+		UserID:           userID,
+		Event:            event,
+		Plan:             next.Plan,
+		Status:           next.Status,
+		CurrentPeriodEnd: nullTime(next.CurrentPeriodEnd),
+	})
+	if err != nil {
+		return err
+	}
+
+	if next.Status == subscriptions.StatusPastDue && current.Status != subscriptions.StatusPastDue {
+		if err := notifications.Notify(ctx, q, userID, notifications.PaymentFailed, nil); err != nil {
+			return err
+		}
+	}
+	if was == entitled {
+		return nil
+	}
+
+	payload := subscriptionPayload{
+		UserId:           userID,
+		IsChirpyRed:      entitled,
+		Plan:             next.Plan,
+		Status:           next.Status,
+		CurrentPeriodEnd: next.CurrentPeriodEnd,
+	}
+	kind, eventType := notifications.ChirpyRedActivated, events.UserUpgraded
+	if !entitled {
+		kind, eventType = notifications.ChirpyRedEnded, events.UserDowngraded
+	}
+	if err := notifications.Notify(ctx, q, userID, kind, nil); err != nil {
+		return err
+	}
+	return cfg.recordEvent(ctx, q, eventType, userID, payload)
+}
+
+// runSubscriptionExpirer downgrades subscriptions whose paid period, plus
+// the grace period for ones that were meant to renew, is over.
+func (cfg *apiConfig) runSubscriptionExpirer(ctx context.Context, every time.Duration) {
+	ticker := time.NewTicker(every)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			n, err := cfg.expireSubscriptions(ctx)
+			if err != nil {
+				log.Printf("expiring subscriptions: %s", err)
+				continue
+			}
+			if n > 0 {
+				log.Printf("expired %d subscriptions", n)
+			}
+		}
+	}
+}
+
+// expireSubscriptions expires lapsed subscriptions a batch at a time until
+// a batch comes back short, and returns how many it expired.
+func (cfg *apiConfig) expireSubscriptions(ctx context.Context) (int, error) {
+	total := 0
+	for {
+		n, err := cfg.expireSubscriptionBatch(ctx)
+		total += n
+		if err != nil || n < subscriptionExpiryBatch {
+			return total, err
+		}
+	}
+}
+
+// expireSubscriptionBatch expires one batch of lapsed subscriptions in a
+// single transaction. The rows are locked with SKIP LOCKED, so several
+// instances can run the job side by side.
+func (cfg *apiConfig) expireSubscriptionBatch(ctx context.Context) (int, error) {
+	tx, err := cfg.sqlDB.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+	qtx := cfg.db.WithTx(tx)
+
+	now := time.Now().UTC()
+	lapsed, err := qtx.ListLapsedSubscriptions(ctx, database.ListLapsedSubscriptionsParams{
+		GraceCutoff: now.Add(-subscriptions.Grace),
+		Now:         now,
+		BatchSize:   subscriptionExpiryBatch,
+	})
+	if err != nil {
+		return 0, err
+	}
+	if len(lapsed) == 0 {
+		return 0, nil
+	}
+	for _, s := range lapsed {
+		if err := cfg.applySubscriptionEvent(ctx, qtx, s.UserID, subscriptions.EventExpired, nil, time.Time{}); err != nil {
+			return 0, err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+	cfg.eventDispatcher.Kick()
+	return len(lapsed), nil
+}
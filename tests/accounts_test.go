@@ -0,0 +1,344 @@
+package tests
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"local/mda/internal/accounts"
+	"local/mda/internal/auth"
+	"local/mda/internal/database"
+
+	"github.com/google/uuid"
+)
+
+func TestDeletionPolicy(t *testing.T) {
+	policy := accounts.DeletionPolicy{Grace: 30 * 24 * time.Hour}
+	deletedAt := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	deleted := database.User{DeletedAt: sql.NullTime{Time: deletedAt, Valid: true}}
+	purgeAt := policy.PurgeAt(deletedAt)
+
+	if !purgeAt.Equal(deletedAt.Add(30 * 24 * time.Hour)) {
+		t.Fatalf("PurgeAt = %v", purgeAt)
+	}
+	if accounts.Active(deleted) {
+		t.Fatal("an account scheduled for deletion shouldn't be active")
+	}
+	if !accounts.Active(database.User{}) {
+		t.Fatal("an account without deleted_at should be active")
+	}
+
+	cases := []struct {
+		name       string
+		now        time.Time
+		purgeable  bool
+		restorable bool
+	}{
+		{"right after deleting", deletedAt.Add(time.Minute), false, true},
+		{"just inside the grace period", purgeAt.Add(-time.Second), false, true},
+		// the purge query keeps deleted_at = cutoff, so the last instant is
+		// still restorable
+		{"at the purge time", purgeAt, false, true},
+		{"after the grace period", purgeAt.Add(time.Second), true, false},
+	}
+	for _, c := range cases {
+		if got := policy.Purgeable(deleted, c.now); got != c.purgeable {
+			t.Errorf("%s: Purgeable = %v, want %v", c.name, got, c.purgeable)
+		}
+		if got := policy.Restorable(deleted, c.now); got != c.restorable {
+			t.Errorf("%s: Restorable = %v, want %v", c.name, got, c.restorable)
+		}
+		// the job deletes rows with deleted_at < cutoff
+		if got := deletedAt.Before(policy.PurgeCutoff(c.now)); got != c.purgeable {
+			t.Errorf("%s: cutoff disagrees with Purgeable", c.name)
+		}
+	}
+
+	active := database.User{}
+	if policy.Purgeable(active, purgeAt.Add(time.Hour)) || policy.Restorable(active, purgeAt) {
+		t.Fatal("active accounts are neither purged nor restored")
+	}
+}
+
+func TestExportSessionsOmitTokens(t *testing.T) {
+	created := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	revoked := created.Add(time.Hour)
+	tokens := []database.RefreshToken{
+		{Token: "secret-token-1", CreatedAt: created, ExpiresAt: created.Add(24 * time.Hour)},
+		{Token: "secret-token-2", CreatedAt: created, ExpiresAt: created.Add(24 * time.Hour), RevokedAt: sql.NullTime{Time: revoked, Valid: true}},
+	}
+
+	sessions := accounts.Sessions(tokens)
+	if len(sessions) != 2 {
+		t.Fatalf("got %d sessions", len(sessions))
+	}
+	if sessions[0].RevokedAt != nil || sessions[1].RevokedAt == nil || !sessions[1].RevokedAt.Equal(revoked) {
+		t.Fatalf("revoked_at not carried over: %+v", sessions)
+	}
+	data, _ := json.Marshal(sessions)
+	if strings.Contains(string(data), "secret-token") {
+		t.Fatalf("export leaks token values: %s", data)
+	}
+	if empty := accounts.Sessions(nil); empty == nil || len(empty) != 0 {
+		t.Fatal("no tokens should export as an empty list, not null")
+	}
+}
+
+func TestWriteZip(t *testing.T) {
+	modified := time.Date(2026, 2, 3, 4, 5, 6, 0, time.UTC)
+	var buf bytes.Buffer
+	err := accounts.WriteZip(&buf, modified, []accounts.File{
+		{Name: "profile.json", Data: map[string]string{"email": "a@example.com"}},
+		{Name: "chirps.json", Data: []string{}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(zr.File) != 2 || zr.File[0].Name != "profile.json" || zr.File[1].Name != "chirps.json" {
+		t.Fatalf("unexpected archive entries: %v", zr.File)
+	}
+	if !zr.File[0].Modified.Equal(modified) {
+		t.Fatalf("Modified = %v, want %v", zr.File[0].Modified, modified)
+	}
+	f, err := zr.File[0].Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	var profile map[string]string
+	if err := json.NewDecoder(f).Decode(&profile); err != nil || profile["email"] != "a@example.com" {
+		t.Fatalf("profile.json = %v, %v", profile, err)
+	}
+}
+
+func TestCredentialsAuthorize(t *testing.T) {
+	h := fastArgon2Hasher()
+	hashed, err := h.Hash("current-Pass-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	email := "new@example.com"
+	password := "next-Pass-2"
+
+	cases := []struct {
+		name  string
+		creds accounts.Credentials
+		want  error
+	}{
+		{"profile-only update", accounts.Credentials{}, nil},
+		{"email without current password", accounts.Credentials{Email: &email}, accounts.ErrCurrentPasswordRequired},
+		{"password without current password", accounts.Credentials{Password: &password}, accounts.ErrCurrentPasswordRequired},
+		{"wrong current password", accounts.Credentials{Email: &email, CurrentPassword: "nope"}, accounts.ErrWrongPassword},
+		{"right current password", accounts.Credentials{Email: &email, Password: &password, CurrentPassword: "current-Pass-1"}, nil},
+	}
+	for _, c := range cases {
+		if err := c.creds.Authorize(h, hashed); !errors.Is(err, c.want) {
+			t.Errorf("%s: got %v, want %v", c.name, err, c.want)
+		}
+	}
+}
+
+func TestCredentialsDropUnchangedEmail(t *testing.T) {
+	same := "Alice@Example.com"
+	creds := accounts.Credentials{Email: &same}
+	creds.DropUnchangedEmail("alice@example.com")
+	if creds.Email != nil || creds.Sensitive() {
+		t.Fatal("resubmitting the current email shouldn't start an email change")
+	}
+
+	other := "bob@example.com"
+	creds = accounts.Credentials{Email: &other}
+	creds.DropUnchangedEmail("alice@example.com")
+	if creds.Email == nil || !creds.Sensitive() {
+		t.Fatal("a new email was dropped")
+	}
+}
+
+func TestEmailChangePolicy(t *testing.T) {
+	policy := accounts.EmailChangePolicy{TTL: 24 * time.Hour}
+	requested := time.Date(2026, 3, 1, 9, 0, 0, 0, time.UTC)
+	change := database.EmailChange{
+		NewEmail:  "new@example.com",
+		CreatedAt: requested,
+		ExpiresAt: policy.ExpiresAt(requested),
+	}
+
+	if !change.ExpiresAt.Equal(requested.Add(24 * time.Hour)) {
+		t.Fatalf("ExpiresAt = %v", change.ExpiresAt)
+	}
+	if !policy.Confirmable(change, requested.Add(time.Hour)) {
+		t.Error("a fresh token should confirm")
+	}
+	if !policy.Confirmable(change, change.ExpiresAt.Add(-time.Second)) {
+		t.Error("the token should confirm until it expires")
+	}
+	if policy.Confirmable(change, change.ExpiresAt) || policy.Confirmable(change, change.ExpiresAt.Add(time.Minute)) {
+		t.Error("an expired token confirmed")
+	}
+}
+
+// fakeAccounts keeps users, their refresh tokens and chirp media the way
+// the users, refresh_tokens and chirp_media tables relate.
+type fakeAccounts struct {
+	users   map[uuid.UUID]database.User
+	revoked map[uuid.UUID]bool
+	media   map[uuid.UUID][]database.ListMediaKeysForPurgeRow
+}
+
+func newFakeAccounts(users ...database.User) *fakeAccounts {
+	f := &fakeAccounts{
+		users:   map[uuid.UUID]database.User{},
+		revoked: map[uuid.UUID]bool{},
+		media:   map[uuid.UUID][]database.ListMediaKeysForPurgeRow{},
+	}
+	for _, u := range users {
+		f.users[u.ID] = u
+	}
+	return f
+}
+
+func (f *fakeAccounts) SoftDeleteUser(ctx context.Context, arg database.SoftDeleteUserParams) (database.User, error) {
+	u, ok := f.users[arg.ID]
+	if !ok || u.DeletedAt.Valid {
+		return database.User{}, sql.ErrNoRows
+	}
+	u.DeletedAt = sql.NullTime{Time: arg.DeletedAt, Valid: true}
+	f.users[u.ID] = u
+	return u, nil
+}
+
+func (f *fakeAccounts) RevokeAllRefreshTokensForUser(ctx context.Context, userID uuid.UUID) error {
+	f.revoked[userID] = true
+	return nil
+}
+
+func (f *fakeAccounts) UserIsActive(ctx context.Context, id uuid.UUID) (bool, error) {
+	u, ok := f.users[id]
+	return ok && !u.DeletedAt.Valid, nil
+}
+
+func (f *fakeAccounts) purgeable(cutoff time.Time) []uuid.UUID {
+	var ids []uuid.UUID
+	for id, u := range f.users {
+		if u.DeletedAt.Valid && u.DeletedAt.Time.Before(cutoff) {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+func (f *fakeAccounts) ListMediaKeysForPurge(ctx context.Context, cutoff time.Time) ([]database.ListMediaKeysForPurgeRow, error) {
+	var rows []database.ListMediaKeysForPurgeRow
+	for _, id := range f.purgeable(cutoff) {
+		rows = append(rows, f.media[id]...)
+	}
+	return rows, nil
+}
+
+func (f *fakeAccounts) PurgeDeletedUsers(ctx context.Context, cutoff time.Time) (int64, error) {
+	ids := f.purgeable(cutoff)
+	for _, id := range ids {
+		delete(f.users, id)
+		delete(f.media, id)
+	}
+	return int64(len(ids)), nil
+}
+
+func bearer(t *testing.T, userID uuid.UUID, secret string) http.Header {
+	t.Helper()
+	token, err := auth.MakeJWT(userID, secret, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := http.Header{}
+	h.Set("Authorization", "Bearer "+token)
+	return h
+}
+
+func TestDeleteRejectsExistingAccessTokens(t *testing.T) {
+	ctx := context.Background()
+	const secret = "test-secret"
+	alice, bob := database.User{ID: uuid.New()}, database.User{ID: uuid.New()}
+	f := newFakeAccounts(alice, bob)
+	h := bearer(t, alice.ID, secret)
+
+	if id, err := accounts.Authenticate(ctx, f, h, secret); err != nil || id != alice.ID {
+		t.Fatalf("before deleting: %v, %v", id, err)
+	}
+
+	now := time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)
+	u, err := accounts.Delete(ctx, f, alice.ID, now)
+	if err != nil || !u.DeletedAt.Valid || !u.DeletedAt.Time.Equal(now) {
+		t.Fatalf("Delete = %+v, %v", u, err)
+	}
+	if !f.revoked[alice.ID] || f.revoked[bob.ID] {
+		t.Fatalf("revoked = %v, want only the deleted account's sessions", f.revoked)
+	}
+
+	// the token was issued before the deletion and hasn't expired
+	if _, err := accounts.Authenticate(ctx, f, h, secret); !errors.Is(err, accounts.ErrDeleted) {
+		t.Fatalf("token of a deleted account: got %v, want ErrDeleted", err)
+	}
+	if id, err := accounts.Authenticate(ctx, f, bearer(t, bob.ID, secret), secret); err != nil || id != bob.ID {
+		t.Fatalf("other accounts: %v, %v", id, err)
+	}
+	if _, err := accounts.Delete(ctx, f, alice.ID, now.Add(time.Hour)); !errors.Is(err, accounts.ErrAlreadyDeleted) {
+		t.Fatalf("deleting twice: got %v, want ErrAlreadyDeleted", err)
+	}
+
+	if _, err := accounts.Authenticate(ctx, f, http.Header{}, secret); !errors.Is(err, accounts.ErrMissingToken) {
+		t.Fatalf("no header: got %v", err)
+	}
+	if _, err := accounts.Authenticate(ctx, f, bearer(t, bob.ID, "other-secret"), secret); !errors.Is(err, accounts.ErrInvalidToken) {
+		t.Fatalf("foreign token: got %v", err)
+	}
+}
+
+func TestPurgeRemovesAccountsPastTheGracePeriod(t *testing.T) {
+	ctx := context.Background()
+	policy := accounts.DeletionPolicy{Grace: 30 * 24 * time.Hour}
+	now := time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)
+	deletedAt := func(ago time.Duration) sql.NullTime {
+		return sql.NullTime{Time: now.Add(-ago), Valid: true}
+	}
+
+	expired := database.User{ID: uuid.New(), DeletedAt: deletedAt(31 * 24 * time.Hour)}
+	pending := database.User{ID: uuid.New(), DeletedAt: deletedAt(24 * time.Hour)}
+	active := database.User{ID: uuid.New()}
+	f := newFakeAccounts(expired, pending, active)
+	f.media[expired.ID] = []database.ListMediaKeysForPurgeRow{{StorageKey: "a.png", ThumbnailKey: "a_thumb.png"}}
+	f.media[pending.ID] = []database.ListMediaKeysForPurgeRow{{StorageKey: "b.png", ThumbnailKey: "b_thumb.png"}}
+
+	n, keys, err := policy.Purge(ctx, f, now)
+	if err != nil || n != 1 {
+		t.Fatalf("Purge = %d, %v", n, err)
+	}
+	if _, ok := f.users[expired.ID]; ok {
+		t.Fatal("expired account wasn't purged")
+	}
+	if _, ok := f.users[pending.ID]; !ok {
+		t.Fatal("account still in its grace period was purged")
+	}
+	if _, ok := f.users[active.ID]; !ok {
+		t.Fatal("active account was purged")
+	}
+	if len(keys) != 2 || keys[0] != "a.png" || keys[1] != "a_thumb.png" {
+		t.Fatalf("blob keys = %v, want the purged account's media only", keys)
+	}
+
+	if n, keys, err := policy.Purge(ctx, f, now); err != nil || n != 0 || len(keys) != 0 {
+		t.Fatalf("second run: %d, %v, %v", n, keys, err)
+	}
+}
@@ -28,6 +28,27 @@ func TestMakeAndValidateJWT_Success(t *testing.T) {
 	}
 }
 
+func TestParseJWT_ReturnsExpiry(t *testing.T) {
+	secret := "topsecret"
+	userID := uuid.New()
+	before := time.Now().Add(time.Hour).Truncate(time.Second)
+	token, err := auth.MakeJWT(userID, secret, time.Hour)
+	if err != nil {
+		t.Fatalf("MakeJWT error: %v", err)
+	}
+
+	gotID, expiresAt, err := auth.ParseJWT(token, secret)
+	if err != nil {
+		t.Fatalf("ParseJWT error: %v", err)
+	}
+	if gotID != userID {
+		t.Fatalf("expected %s, got %s", userID, gotID)
+	}
+	if expiresAt.Before(before) || expiresAt.After(before.Add(2*time.Second)) {
+		t.Fatalf("unexpected expiry %s", expiresAt)
+	}
+}
+
 func TestValidateJWT_Expired(t *testing.T) {
 	secret := "topsecret"
 	userID := uuid.New()
@@ -0,0 +1,158 @@
+package tests
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	"local/mda/internal/chirps"
+	"local/mda/internal/database"
+
+	"github.com/google/uuid"
+)
+
+func TestCleanBody(t *testing.T) {
+	cases := []struct {
+		in   string
+		want string
+	}{
+		{"I had something interesting for breakfast", "I had something interesting for breakfast"},
+		{"Chirpy is fine. sharbert I need to migrate", "Chirpy is fine. **** I need to migrate"},
+		{"What a Kerfuffle!", "What a ****!"},
+		{"fornax,kerfuffle", "****"},
+	}
+	for _, c := range cases {
+		if got := chirps.CleanBody(c.in); got != c.want {
+			t.Errorf("CleanBody(%q) = %q, want %q", c.in, got, c.want)
+		}
+	}
+}
+
+func TestNewChirpSchedule(t *testing.T) {
+	now := time.Date(2026, 5, 1, 12, 0, 0, 0, time.UTC)
+	userID := uuid.New()
+	maxAhead := 24 * time.Hour
+
+	p, err := chirps.New(userID, "hello kerfuffle", nil, now, maxAhead)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Body != "hello ****" || p.UserID != userID || !p.PublishAt.Equal(now) || !p.PublishedAt.Valid {
+		t.Fatalf("immediate chirp: got %+v", p)
+	}
+
+	past := now.Add(-time.Minute)
+	if p, _ := chirps.New(userID, "x", &past, now, maxAhead); !p.PublishAt.Equal(now) || !p.PublishedAt.Valid {
+		t.Fatalf("a publish_at in the past should publish now: %+v", p)
+	}
+
+	later := now.Add(time.Hour)
+	p, err = chirps.New(userID, "x", &later, now, maxAhead)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !p.PublishAt.Equal(later) || p.PublishedAt.Valid {
+		t.Fatalf("scheduled chirp: got %+v", p)
+	}
+
+	tooFar := now.Add(maxAhead + time.Second)
+	if _, err := chirps.New(userID, "x", &tooFar, now, maxAhead); !errors.Is(err, chirps.ErrScheduleTooFar) {
+		t.Fatalf("expected ErrScheduleTooFar, got %v", err)
+	}
+	if p, err := chirps.New(userID, "x", &tooFar, now, 0); err != nil || !p.PublishAt.Equal(tooFar) {
+		t.Fatalf("no limit: got %+v, %v", p, err)
+	}
+}
+
+// fakeDrafts records the calls PublishDraft makes, in order.
+type fakeDrafts struct {
+	draft     database.Draft
+	getErr    error
+	deleteErr error
+	calls     []string
+}
+
+func (f *fakeDrafts) GetDraftForUpdate(ctx context.Context, arg database.GetDraftForUpdateParams) (database.Draft, error) {
+	f.calls = append(f.calls, "get")
+	if f.getErr != nil {
+		return database.Draft{}, f.getErr
+	}
+	return f.draft, nil
+}
+
+func (f *fakeDrafts) DeleteDraft(ctx context.Context, arg database.DeleteDraftParams) (int64, error) {
+	f.calls = append(f.calls, "delete")
+	if f.deleteErr != nil {
+		return 0, f.deleteErr
+	}
+	return 1, nil
+}
+
+func TestPublishDraft(t *testing.T) {
+	now := time.Date(2026, 5, 1, 12, 0, 0, 0, time.UTC)
+	userID := uuid.New()
+	draftID := uuid.New()
+
+	// insert stands in for insertChirp: the same chirps.New every new chirp
+	// goes through
+	insert := func(f *fakeDrafts) func(string, *time.Time) (database.Chirp, error) {
+		return func(body string, publishAt *time.Time) (database.Chirp, error) {
+			f.calls = append(f.calls, "insert")
+			p, err := chirps.New(userID, body, publishAt, now, 24*time.Hour)
+			if err != nil {
+				return database.Chirp{}, err
+			}
+			return database.Chirp{ID: uuid.New(), Body: p.Body, UserID: p.UserID, PublishAt: p.PublishAt, PublishedAt: p.PublishedAt}, nil
+		}
+	}
+	t.Run("publishes through the chirp path and deletes the draft", func(t *testing.T) {
+		at := now.Add(time.Hour)
+		f := &fakeDrafts{draft: database.Draft{ID: draftID, UserID: userID, Body: "a fornax draft", PublishAt: sql.NullTime{Time: at, Valid: true}}}
+		chirp, err := chirps.PublishDraft(context.Background(), f, userID, draftID, insert(f))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if chirp.Body != "a **** draft" {
+			t.Errorf("body not cleaned: %q", chirp.Body)
+		}
+		if !chirp.PublishAt.Equal(at) || chirp.PublishedAt.Valid {
+			t.Errorf("draft schedule not kept: %+v", chirp)
+		}
+		if !slices.Equal(f.calls, []string{"get", "insert", "delete"}) {
+			t.Errorf("calls = %v", f.calls)
+		}
+	})
+
+	t.Run("a rejected chirp keeps the draft", func(t *testing.T) {
+		tooFar := now.Add(48 * time.Hour)
+		f := &fakeDrafts{draft: database.Draft{ID: draftID, UserID: userID, Body: "x", PublishAt: sql.NullTime{Time: tooFar, Valid: true}}}
+		if _, err := chirps.PublishDraft(context.Background(), f, userID, draftID, insert(f)); !errors.Is(err, chirps.ErrScheduleTooFar) {
+			t.Fatalf("expected ErrScheduleTooFar, got %v", err)
+		}
+		if !slices.Equal(f.calls, []string{"get", "insert"}) {
+			t.Errorf("calls = %v", f.calls)
+		}
+	})
+
+	t.Run("a failed delete fails the publish", func(t *testing.T) {
+		deleteErr := errors.New("connection reset")
+		f := &fakeDrafts{draft: database.Draft{ID: draftID, UserID: userID, Body: "x"}, deleteErr: deleteErr}
+		// the caller rolls back on any error, taking the chirp with it
+		if _, err := chirps.PublishDraft(context.Background(), f, userID, draftID, insert(f)); !errors.Is(err, deleteErr) {
+			t.Fatalf("expected the delete error, got %v", err)
+		}
+	})
+
+	t.Run("a missing draft inserts nothing", func(t *testing.T) {
+		f := &fakeDrafts{getErr: sql.ErrNoRows}
+		if _, err := chirps.PublishDraft(context.Background(), f, userID, draftID, insert(f)); !errors.Is(err, sql.ErrNoRows) {
+			t.Fatalf("expected sql.ErrNoRows, got %v", err)
+		}
+		if !slices.Equal(f.calls, []string{"get"}) {
+			t.Errorf("calls = %v", f.calls)
+		}
+	})
+}
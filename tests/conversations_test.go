@@ -0,0 +1,238 @@
+package tests
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"sync"
+	"testing"
+
+	"local/mda/internal/conversations"
+	"local/mda/internal/database"
+
+	"github.com/google/uuid"
+)
+
+// fakeConversations stands in for the conversation tables. Each fakeTx
+// holds its pair locks until commit, like pg_advisory_xact_lock.
+type fakeConversations struct {
+	mu      sync.Mutex
+	locks   map[string]*sync.Mutex
+	convs   map[uuid.UUID]database.Conversation
+	members map[uuid.UUID]map[uuid.UUID]bool
+}
+
+func newFakeConversations() *fakeConversations {
+	return &fakeConversations{
+		locks:   map[string]*sync.Mutex{},
+		convs:   map[uuid.UUID]database.Conversation{},
+		members: map[uuid.UUID]map[uuid.UUID]bool{},
+	}
+}
+
+type fakeConversationTx struct {
+	store *fakeConversations
+	held  []*sync.Mutex
+}
+
+func (tx *fakeConversationTx) commit() {
+	for _, l := range tx.held {
+		l.Unlock()
+	}
+}
+
+func (tx *fakeConversationTx) LockDirectPair(ctx context.Context, pairKey string) error {
+	s := tx.store
+	s.mu.Lock()
+	l, ok := s.locks[pairKey]
+	if !ok {
+		l = &sync.Mutex{}
+		s.locks[pairKey] = l
+	}
+	s.mu.Unlock()
+	l.Lock()
+	tx.held = append(tx.held, l)
+	return nil
+}
+
+func (tx *fakeConversationTx) FindDirectConversation(ctx context.Context, arg database.FindDirectConversationParams) (database.Conversation, error) {
+	s := tx.store
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for id, c := range s.convs {
+		if !c.IsGroup && s.members[id][arg.UserID] && s.members[id][arg.OtherID] {
+			return c, nil
+		}
+	}
+	return database.Conversation{}, sql.ErrNoRows
+}
+
+func (tx *fakeConversationTx) CreateConversation(ctx context.Context, arg database.CreateConversationParams) (database.Conversation, error) {
+	s := tx.store
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	c := database.Conversation{ID: uuid.New(), IsGroup: arg.IsGroup, CreatedBy: arg.CreatedBy}
+	s.convs[c.ID] = c
+	s.members[c.ID] = map[uuid.UUID]bool{}
+	return c, nil
+}
+
+func (tx *fakeConversationTx) AddConversationMember(ctx context.Context, arg database.AddConversationMemberParams) error {
+	s := tx.store
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.members[arg.ConversationID][arg.UserID] = true
+	return nil
+}
+
+func (s *fakeConversations) GetConversationForMember(ctx context.Context, arg database.GetConversationForMemberParams) (database.Conversation, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	c, ok := s.convs[arg.ID]
+	if !ok || !s.members[arg.ID][arg.UserID] {
+		return database.Conversation{}, sql.ErrNoRows
+	}
+	return c, nil
+}
+
+func TestPairKeyIsSymmetric(t *testing.T) {
+	a, b := uuid.New(), uuid.New()
+	if conversations.PairKey(a, b) != conversations.PairKey(b, a) {
+		t.Fatal("pair key depends on who starts the conversation")
+	}
+	if conversations.PairKey(a, b) == conversations.PairKey(a, uuid.New()) {
+		t.Fatal("different pairs share a key")
+	}
+}
+
+func TestOpenReusesDirectConversation(t *testing.T) {
+	ctx := context.Background()
+	s := newFakeConversations()
+	alice, bob, carol := uuid.New(), uuid.New(), uuid.New()
+
+	tx := &fakeConversationTx{store: s}
+	first, created, err := conversations.Open(ctx, tx, alice, []uuid.UUID{bob})
+	tx.commit()
+	if err != nil || !created {
+		t.Fatalf("first open: created=%v err=%v", created, err)
+	}
+
+	tx = &fakeConversationTx{store: s}
+	again, created, err := conversations.Open(ctx, tx, bob, []uuid.UUID{alice})
+	tx.commit()
+	if err != nil || created || again.ID != first.ID {
+		t.Fatalf("reply open: got %v created=%v err=%v, want %v", again.ID, created, err, first.ID)
+	}
+
+	tx = &fakeConversationTx{store: s}
+	group, created, err := conversations.Open(ctx, tx, alice, []uuid.UUID{bob, carol})
+	tx.commit()
+	if err != nil || !created || !group.IsGroup || group.ID == first.ID {
+		t.Fatalf("group open: %+v created=%v err=%v", group, created, err)
+	}
+	if len(tx.held) != 0 {
+		t.Fatal("group conversations shouldn't take a pair lock")
+	}
+}
+
+func TestOpenConcurrentDirectConversation(t *testing.T) {
+	ctx := context.Background()
+	s := newFakeConversations()
+	alice, bob := uuid.New(), uuid.New()
+
+	var wg sync.WaitGroup
+	ids := make([]uuid.UUID, 20)
+	for i := range ids {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			from, to := alice, bob
+			if i%2 == 1 {
+				from, to = bob, alice
+			}
+			tx := &fakeConversationTx{store: s}
+			defer tx.commit()
+			c, _, err := conversations.Open(ctx, tx, from, []uuid.UUID{to})
+			if err != nil {
+				t.Error(err)
+			}
+			ids[i] = c.ID
+		}()
+	}
+	wg.Wait()
+
+	if len(s.convs) != 1 {
+		t.Fatalf("concurrent opens created %d conversations", len(s.convs))
+	}
+	for _, id := range ids {
+		if id != ids[0] {
+			t.Fatal("requests got different conversations")
+		}
+	}
+}
+
+func TestForMemberHidesOthersConversations(t *testing.T) {
+	ctx := context.Background()
+	s := newFakeConversations()
+	alice, bob, mallory := uuid.New(), uuid.New(), uuid.New()
+
+	tx := &fakeConversationTx{store: s}
+	c, _, err := conversations.Open(ctx, tx, alice, []uuid.UUID{bob})
+	tx.commit()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, member := range []uuid.UUID{alice, bob} {
+		if got, err := conversations.ForMember(ctx, s, c.ID, member); err != nil || got.ID != c.ID {
+			t.Fatalf("member lookup: %v, %v", got.ID, err)
+		}
+	}
+	if _, err := conversations.ForMember(ctx, s, c.ID, mallory); !errors.Is(err, conversations.ErrNotFound) {
+		t.Fatalf("non-member: got %v, want ErrNotFound", err)
+	}
+	if _, err := conversations.ForMember(ctx, s, uuid.New(), alice); !errors.Is(err, conversations.ErrNotFound) {
+		t.Fatalf("missing conversation: got %v, want ErrNotFound", err)
+	}
+}
+
+// fakePermissions answers the block and history checks from fixed sets.
+type fakePermissions struct {
+	blocked map[[2]uuid.UUID]bool
+	written map[[2]uuid.UUID]bool
+}
+
+func (f fakePermissions) IsBlockedBetween(ctx context.Context, arg database.IsBlockedBetweenParams) (bool, error) {
+	return f.blocked[[2]uuid.UUID{arg.UserID, arg.TargetID}] || f.blocked[[2]uuid.UUID{arg.TargetID, arg.UserID}], nil
+}
+
+func (f fakePermissions) HasWrittenTo(ctx context.Context, arg database.HasWrittenToParams) (bool, error) {
+	return f.written[[2]uuid.UUID{arg.AuthorID, arg.ReaderID}], nil
+}
+
+func TestCanMessage(t *testing.T) {
+	ctx := context.Background()
+	alice, bob, carol := uuid.New(), uuid.New(), uuid.New()
+	open := database.User{ID: bob, AllowStrangerDms: true}
+	closed := database.User{ID: carol, AllowStrangerDms: false}
+
+	f := fakePermissions{blocked: map[[2]uuid.UUID]bool{}, written: map[[2]uuid.UUID]bool{}}
+	check := func(name string, recipient database.User, want bool) {
+		t.Helper()
+		got, err := conversations.CanMessage(ctx, f, alice, recipient)
+		if err != nil || got != want {
+			t.Errorf("%s: got %v, %v; want %v", name, got, err, want)
+		}
+	}
+
+	check("open inbox", open, true)
+	check("stranger to closed inbox", closed, false)
+
+	f.written[[2]uuid.UUID{carol, alice}] = true
+	check("closed inbox that wrote first", closed, true)
+
+	f.blocked[[2]uuid.UUID{bob, alice}] = true
+	check("recipient blocked sender", open, false)
+	f.blocked[[2]uuid.UUID{alice, carol}] = true
+	check("sender blocked recipient", closed, false)
+}
@@ -0,0 +1,72 @@
+package tests
+
+import (
+	"testing"
+	"time"
+
+	"local/mda/internal/entitlements"
+	"local/mda/internal/subscriptions"
+)
+
+func TestEntitlementsFreePlan(t *testing.T) {
+	p := entitlements.For(entitlements.PlanFree)
+	if p.Name != entitlements.PlanFree {
+		t.Fatalf("name = %q", p.Name)
+	}
+	if !p.Can(entitlements.ScheduleChirps) {
+		t.Error("free plan should schedule chirps")
+	}
+	if p.Can(entitlements.OutboundWebhooks) {
+		t.Error("free plan shouldn't have webhooks")
+	}
+	if p.Limits.MaxChirpLength != 140 {
+		t.Errorf("MaxChirpLength = %d, want 140", p.Limits.MaxChirpLength)
+	}
+	if p.Limits.ChirpsPerDay == 0 {
+		t.Error("free plan should have a daily chirp quota")
+	}
+}
+
+func TestEntitlementsChirpyRedPlan(t *testing.T) {
+	free := entitlements.For(entitlements.PlanFree)
+	red := entitlements.For(subscriptions.PlanChirpyRed)
+	if red.Name != subscriptions.PlanChirpyRed {
+		t.Fatalf("name = %q", red.Name)
+	}
+	for _, c := range []entitlements.Capability{entitlements.ScheduleChirps, entitlements.OutboundWebhooks} {
+		if !red.Can(c) {
+			t.Errorf("Chirpy Red should have %s", c)
+		}
+	}
+	if red.Limits.MaxChirpLength <= free.Limits.MaxChirpLength {
+		t.Errorf("MaxChirpLength = %d, should beat free's %d", red.Limits.MaxChirpLength, free.Limits.MaxChirpLength)
+	}
+	if red.Limits.ChirpsPerDay != 0 {
+		t.Errorf("ChirpsPerDay = %d, want unlimited", red.Limits.ChirpsPerDay)
+	}
+	if red.Limits.MaxScheduleAhead <= free.Limits.MaxScheduleAhead {
+		t.Error("Chirpy Red should schedule further ahead than free")
+	}
+}
+
+func TestEntitlementsForSubscription(t *testing.T) {
+	now := time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)
+	past := now.Add(-subscriptions.Grace - time.Hour)
+
+	cases := []struct {
+		name  string
+		state subscriptions.State
+		want  string
+	}{
+		{"none", subscriptions.State{}, entitlements.PlanFree},
+		{"active", subscriptions.State{Plan: subscriptions.PlanChirpyRed, Status: subscriptions.StatusActive}, subscriptions.PlanChirpyRed},
+		{"lapsed", subscriptions.State{Plan: subscriptions.PlanChirpyRed, Status: subscriptions.StatusActive, CurrentPeriodEnd: &past}, entitlements.PlanFree},
+		{"expired", subscriptions.State{Plan: subscriptions.PlanChirpyRed, Status: subscriptions.StatusExpired}, entitlements.PlanFree},
+		{"unknown plan", subscriptions.State{Plan: "gold", Status: subscriptions.StatusActive}, entitlements.PlanFree},
+	}
+	for _, c := range cases {
+		if got := entitlements.ForSubscription(c.state, now).Name; got != c.want {
+			t.Errorf("%s: plan %q, want %q", c.name, got, c.want)
+		}
+	}
+}
@@ -0,0 +1,305 @@
+package tests
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"local/mda/internal/events"
+
+	"github.com/google/uuid"
+)
+
+func TestBusDeliversToTypeAndWildcardSubscribers(t *testing.T) {
+	bus := events.NewBus()
+	var got []string
+	bus.Subscribe(events.ChirpCreated, func(ctx context.Context, e events.Event) error {
+		got = append(got, "typed:"+e.Type)
+		return nil
+	})
+	bus.Subscribe("*", func(ctx context.Context, e events.Event) error {
+		got = append(got, "all:"+e.Type)
+		return nil
+	})
+
+	userID := uuid.New()
+	e, err := events.New(events.ChirpCreated, userID, map[string]string{"body": "hello"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	bus.Publish(context.Background(), e)
+
+	deleted, _ := events.New(events.ChirpDeleted, userID, nil)
+	bus.Publish(context.Background(), deleted)
+
+	want := []string{"typed:chirp.created", "all:chirp.created", "all:chirp.deleted"}
+	if len(got) != len(want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("got %v, want %v", got, want)
+		}
+	}
+
+	var payload map[string]string
+	if err := json.Unmarshal(e.Payload, &payload); err != nil || payload["body"] != "hello" {
+		t.Fatalf("payload = %s", e.Payload)
+	}
+	if e.UserID != userID || e.ID == uuid.Nil {
+		t.Fatalf("unexpected event metadata: %+v", e)
+	}
+}
+
+func TestBusSurvivesPanickingHandler(t *testing.T) {
+	bus := events.NewBus()
+	called := false
+	bus.Subscribe("*", func(ctx context.Context, e events.Event) error { panic("boom") })
+	bus.Subscribe("*", func(ctx context.Context, e events.Event) error { called = true; return nil })
+
+	e, _ := events.New(events.ChirpCreated, uuid.New(), nil)
+	bus.Publish(context.Background(), e)
+	if !called {
+		t.Fatal("second handler was not called")
+	}
+}
+
+func TestRelayRepublishesRemoteEventsOnly(t *testing.T) {
+	localBus, remoteBus := events.NewBus(), events.NewBus()
+	local := events.NewRelay(nil, "", "chirpy_events", localBus)
+	remote := events.NewRelay(nil, "", "chirpy_events", remoteBus)
+
+	var got []events.Event
+	remoteBus.Subscribe("*", func(ctx context.Context, e events.Event) error {
+		got = append(got, e)
+		return nil
+	})
+	localBus.Subscribe("*", func(ctx context.Context, e events.Event) error {
+		t.Fatalf("instance received its own event %s", e.ID)
+		return nil
+	})
+
+	e, err := events.New(events.ChirpCreated, uuid.New(), map[string]string{"body": "hello"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	payload, err := local.Encode(e)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Postgres delivers the notification to every listener, the sender included
+	if err := local.Receive(context.Background(), payload); err != nil {
+		t.Fatal(err)
+	}
+	if err := remote.Receive(context.Background(), payload); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(got) != 1 {
+		t.Fatalf("got %d events, want 1", len(got))
+	}
+	if got[0].ID != e.ID || got[0].Type != e.Type || string(got[0].Payload) != string(e.Payload) {
+		t.Fatalf("got %+v, want %+v", got[0], e)
+	}
+	if got[0].Origin != local.Instance() {
+		t.Fatalf("origin = %q, want %q", got[0].Origin, local.Instance())
+	}
+}
+
+// fakeEventLoader serves recorded events by ID, like PostgresOutbox.Load.
+type fakeEventLoader map[uuid.UUID]events.Event
+
+func (f fakeEventLoader) Load(ctx context.Context, id uuid.UUID) (events.Event, error) {
+	e, ok := f[id]
+	if !ok {
+		return events.Event{}, sql.ErrNoRows
+	}
+	return e, nil
+}
+
+func TestRelaySendsOversizedEventsByReference(t *testing.T) {
+	big := make([]byte, 8000)
+	for i := range big {
+		big[i] = 'a'
+	}
+	e, err := events.New(events.ChirpCreated, uuid.New(), map[string]string{"body": string(big)})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	local := events.NewRelay(nil, "", "chirpy_events", events.NewBus())
+	payload, err := local.Encode(e)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(payload) > 7900 {
+		t.Fatalf("encoded %d bytes, over the NOTIFY limit", len(payload))
+	}
+
+	remoteBus := events.NewBus()
+	var got []events.Event
+	remoteBus.Subscribe("*", func(ctx context.Context, e events.Event) error {
+		got = append(got, e)
+		return nil
+	})
+	remote := events.NewRelay(nil, "", "chirpy_events", remoteBus).
+		WithLoader(fakeEventLoader{e.ID: e})
+	if err := remote.Receive(context.Background(), payload); err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 1 || got[0].ID != e.ID || string(got[0].Payload) != string(e.Payload) {
+		t.Fatalf("got %+v, want the full event", got)
+	}
+	if got[0].Origin != local.Instance() {
+		t.Fatalf("origin = %q, want %q", got[0].Origin, local.Instance())
+	}
+
+	// without a loader the event can't be recovered, which is an error
+	// rather than a silent drop
+	bare := events.NewRelay(nil, "", "chirpy_events", events.NewBus())
+	if err := bare.Receive(context.Background(), payload); err == nil {
+		t.Fatal("expected an error receiving a reference without a loader")
+	}
+}
+
+// fakeOutbox is an in-memory OutboxStore with the same lease semantics as
+// the Postgres one.
+type fakeOutbox struct {
+	events     []events.Event
+	leased     map[uuid.UUID]time.Time
+	dispatched map[uuid.UUID]bool
+	failMark   bool
+}
+
+func newFakeOutbox(es ...events.Event) *fakeOutbox {
+	return &fakeOutbox{events: es, leased: map[uuid.UUID]time.Time{}, dispatched: map[uuid.UUID]bool{}}
+}
+
+func (o *fakeOutbox) Claim(ctx context.Context, now time.Time, lease time.Duration, limit int) ([]events.Event, error) {
+	var out []events.Event
+	for _, e := range o.events {
+		if len(out) == limit {
+			break
+		}
+		if o.dispatched[e.ID] || now.Before(o.leased[e.ID]) {
+			continue
+		}
+		o.leased[e.ID] = now.Add(lease)
+		out = append(out, e)
+	}
+	return out, nil
+}
+
+func (o *fakeOutbox) MarkDispatched(ctx context.Context, e events.Event, at time.Time) error {
+	if o.failMark {
+		return errors.New("connection reset")
+	}
+	o.dispatched[e.ID] = true
+	return nil
+}
+
+func (o *fakeOutbox) Prune(ctx context.Context, before time.Time) error { return nil }
+
+func TestDispatcherPublishesInOrderOnce(t *testing.T) {
+	var recorded []events.Event
+	for i := 0; i < 5; i++ {
+		e, _ := events.New(events.ChirpCreated, uuid.New(), map[string]int{"n": i})
+		recorded = append(recorded, e)
+	}
+	bus := events.NewBus()
+	var got []uuid.UUID
+	bus.Subscribe("*", func(ctx context.Context, e events.Event) error { got = append(got, e.ID); return nil })
+
+	d := events.NewDispatcher(newFakeOutbox(recorded...), bus)
+	d.BatchSize = 2
+	n, err := d.DispatchOnce(context.Background())
+	if err != nil || n != 5 {
+		t.Fatalf("DispatchOnce = %d, %v", n, err)
+	}
+	for i, e := range recorded {
+		if got[i] != e.ID {
+			t.Fatalf("event %d out of order", i)
+		}
+	}
+	if n, _ := d.DispatchOnce(context.Background()); n != 0 {
+		t.Fatalf("dispatched %d events twice", n)
+	}
+}
+
+func TestDispatcherRedeliversUnmarkedEventsAfterLease(t *testing.T) {
+	e, _ := events.New(events.UserUpgraded, uuid.New(), nil)
+	store := newFakeOutbox(e)
+	store.failMark = true
+	bus := events.NewBus()
+	deliveries := 0
+	bus.Subscribe(events.UserUpgraded, func(ctx context.Context, got events.Event) error {
+		if got.ID != e.ID {
+			t.Fatalf("got event %s, want %s", got.ID, e.ID)
+		}
+		deliveries++
+		return nil
+	})
+
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	d := events.NewDispatcher(store, bus).WithClock(func() time.Time { return now })
+	d.DispatchOnce(context.Background())
+
+	// still leased: nobody else picks it up
+	now = now.Add(d.Lease / 2)
+	d.DispatchOnce(context.Background())
+	if deliveries != 1 {
+		t.Fatalf("deliveries = %d during the lease, want 1", deliveries)
+	}
+
+	store.failMark = false
+	now = now.Add(d.Lease)
+	d.DispatchOnce(context.Background())
+	now = now.Add(2 * d.Lease)
+	d.DispatchOnce(context.Background())
+	if deliveries != 2 {
+		t.Fatalf("deliveries = %d, want 2 (one redelivery, then marked)", deliveries)
+	}
+}
+
+func TestDispatcherRetriesEventsAHandlerFailed(t *testing.T) {
+	e, _ := events.New(events.ChirpCreated, uuid.New(), nil)
+	store := newFakeOutbox(e)
+	bus := events.NewBus()
+	attempts := 0
+	bus.Subscribe(events.ChirpCreated, func(ctx context.Context, got events.Event) error {
+		attempts++
+		if attempts == 1 {
+			return errors.New("database unavailable")
+		}
+		return nil
+	})
+
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	d := events.NewDispatcher(store, bus).WithClock(func() time.Time { return now })
+	d.DispatchOnce(context.Background())
+	if store.dispatched[e.ID] {
+		t.Fatal("event marked dispatched although its handler failed")
+	}
+
+	now = now.Add(d.Lease + time.Second)
+	d.DispatchOnce(context.Background())
+	if attempts != 2 || !store.dispatched[e.ID] {
+		t.Fatalf("attempts = %d, dispatched = %v; want a successful retry", attempts, store.dispatched[e.ID])
+	}
+}
+
+func TestBusReportsHandlerErrors(t *testing.T) {
+	bus := events.NewBus()
+	bus.Subscribe("*", func(ctx context.Context, e events.Event) error { return errors.New("first") })
+	bus.Subscribe("*", func(ctx context.Context, e events.Event) error { panic("boom") })
+
+	e, _ := events.New(events.ChirpCreated, uuid.New(), nil)
+	err := bus.Publish(context.Background(), e)
+	if err == nil || !strings.Contains(err.Error(), "first") || !strings.Contains(err.Error(), "panicked") {
+		t.Fatalf("Publish = %v, want both failures", err)
+	}
+}
@@ -0,0 +1,78 @@
+package tests
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"local/mda/internal/auth"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+func fastArgon2Hasher() auth.PasswordHasher {
+	h := auth.DefaultPasswordHasher()
+	h.Argon2.Memory = 64
+	h.Argon2.Iterations = 1
+	return h
+}
+
+func TestPasswordHasher_Argon2idRoundTrip(t *testing.T) {
+	h := fastArgon2Hasher()
+
+	hash, err := h.Hash("correct-Horse-7")
+	if err != nil {
+		t.Fatalf("Hash error: %v", err)
+	}
+	if !strings.HasPrefix(hash, "$argon2id$v=19$m=64,t=1,p=1$") {
+		t.Fatalf("unexpected hash format: %s", hash)
+	}
+
+	needsRehash, err := h.Verify("correct-Horse-7", hash)
+	if err != nil || needsRehash {
+		t.Fatalf("Verify = (%v, %v), want (false, nil)", needsRehash, err)
+	}
+	if _, err := h.Verify("wrong", hash); !errors.Is(err, auth.ErrPasswordMismatch) {
+		t.Fatalf("expected ErrPasswordMismatch, got %v", err)
+	}
+}
+
+func TestPasswordHasher_NeedsRehash(t *testing.T) {
+	legacy, err := bcrypt.GenerateFromPassword([]byte("pw"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatalf("bcrypt error: %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		hasher auth.PasswordHasher
+		want   bool
+	}{
+		{name: "bcrypt to argon2id", hasher: fastArgon2Hasher(), want: true},
+		{name: "bcrypt cost raised", hasher: auth.PasswordHasher{Algorithm: auth.HashBcrypt, BcryptCost: bcrypt.MinCost + 1}, want: true},
+		{name: "bcrypt unchanged", hasher: auth.PasswordHasher{Algorithm: auth.HashBcrypt, BcryptCost: bcrypt.MinCost}, want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.hasher.Verify("pw", string(legacy))
+			if err != nil {
+				t.Fatalf("Verify error: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("needsRehash = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	old := fastArgon2Hasher()
+	hash, err := old.Hash("pw")
+	if err != nil {
+		t.Fatalf("Hash error: %v", err)
+	}
+	stronger := fastArgon2Hasher()
+	stronger.Argon2.Iterations = 2
+	if got, err := stronger.Verify("pw", hash); err != nil || !got {
+		t.Fatalf("expected argon2id hash with old parameters to need rehash, got (%v, %v)", got, err)
+	}
+}
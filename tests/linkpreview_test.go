@@ -0,0 +1,122 @@
+package tests
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"net/url"
+	"testing"
+	"time"
+
+	"local/mda/internal/linkpreview"
+	"local/mda/internal/safehttp"
+)
+
+const ogPage = `<!doctype html>
+<html><head>
+<title>Fallback title</title>
+<meta property="og:title" content="Chirpy &amp; friends">
+<meta name="description" content="plain description">
+<meta property='og:description' content='  The   best place
+ to chirp '>
+<meta content="/img/card.png" property="og:image">
+</head><body></body></html>`
+
+func newOGServer(t *testing.T) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Write([]byte(ogPage))
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestFetcher_ParsesOpenGraph(t *testing.T) {
+	srv := newOGServer(t)
+	opts := safehttp.DefaultOptions()
+	opts.AllowPrivate = true
+	fetcher := linkpreview.NewFetcher(safehttp.NewClient(opts))
+
+	p, err := fetcher.Fetch(context.Background(), srv.URL+"/post")
+	if err != nil {
+		t.Fatalf("Fetch error: %v", err)
+	}
+	if p.Title != "Chirpy & friends" {
+		t.Errorf("Title = %q", p.Title)
+	}
+	if p.Description != "The best place to chirp" {
+		t.Errorf("Description = %q", p.Description)
+	}
+	if p.ImageURL != srv.URL+"/img/card.png" {
+		t.Errorf("ImageURL = %q", p.ImageURL)
+	}
+}
+
+func TestFetcher_BlocksPrivateAddresses(t *testing.T) {
+	srv := newOGServer(t)
+	fetcher := linkpreview.NewFetcher(safehttp.NewClient(safehttp.DefaultOptions()))
+
+	_, err := fetcher.Fetch(context.Background(), srv.URL)
+	if !errors.Is(err, safehttp.ErrBlocked) {
+		t.Fatalf("expected ErrBlocked for loopback server, got %v", err)
+	}
+}
+
+func TestIsPublicAddr(t *testing.T) {
+	tests := map[string]bool{
+		"8.8.8.8":         true,
+		"2606:4700::1111": true,
+		"127.0.0.1":       false,
+		"10.1.2.3":        false,
+		"169.254.169.254": false,
+		"100.64.0.1":      false,
+		"::1":             false,
+		"::ffff:10.0.0.1": false,
+		"fd00::1":         false,
+	}
+	for addr, want := range tests {
+		if got := safehttp.IsPublicAddr(netip.MustParseAddr(addr)); got != want {
+			t.Errorf("IsPublicAddr(%s) = %v, want %v", addr, got, want)
+		}
+	}
+}
+
+func TestService_CachesResults(t *testing.T) {
+	hits := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits++
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte(ogPage))
+	}))
+	defer srv.Close()
+
+	opts := safehttp.DefaultOptions()
+	opts.AllowPrivate = true
+	svc := linkpreview.NewService(linkpreview.NewFetcher(safehttp.NewClient(opts)), linkpreview.NewMemoryStore(), time.Hour)
+
+	for i := 0; i < 3; i++ {
+		if _, err := svc.Resolve(context.Background(), srv.URL); err != nil {
+			t.Fatalf("Resolve error: %v", err)
+		}
+	}
+	if hits != 1 {
+		t.Fatalf("expected one fetch, got %d", hits)
+	}
+}
+
+func TestExtractURL(t *testing.T) {
+	got, ok := linkpreview.ExtractURL("look at this (https://example.com/a?b=1).")
+	if !ok || got != "https://example.com/a?b=1" {
+		t.Fatalf("ExtractURL = %q, %v", got, ok)
+	}
+	if _, ok := linkpreview.ExtractURL("no links here"); ok {
+		t.Fatalf("expected no URL")
+	}
+	base, _ := url.Parse("https://example.com/")
+	if p := linkpreview.ParseOpenGraph(`<meta property="og:image" content="javascript:alert(1)">`, base); p.ImageURL != "" {
+		t.Fatalf("expected non-http image URL to be dropped, got %q", p.ImageURL)
+	}
+}
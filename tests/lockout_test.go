@@ -0,0 +1,180 @@
+package tests
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"local/mda/internal/lockout"
+)
+
+type fakeClock struct {
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time { return c.now }
+
+func newTestGuard(policy lockout.Policy) (*lockout.Guard, *fakeClock) {
+	clock := &fakeClock{now: time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)}
+	guard := lockout.NewGuard(lockout.NewMemoryStore(), policy).WithClock(clock.Now)
+	return guard, clock
+}
+
+func TestGuard_ExponentialBackoff(t *testing.T) {
+	policy := lockout.Policy{
+		FreeAttempts: 2,
+		BaseDelay:    time.Second,
+		MaxDelay:     10 * time.Second,
+		ResetAfter:   time.Hour,
+	}
+	guard, clock := newTestGuard(policy)
+	ctx := context.Background()
+
+	want := []time.Duration{0, 0, time.Second, 2 * time.Second, 4 * time.Second, 8 * time.Second, 10 * time.Second}
+	for i, w := range want {
+		got, err := guard.RecordFailure(ctx, "a@example.com", "")
+		if err != nil {
+			t.Fatalf("RecordFailure error: %v", err)
+		}
+		if got != w {
+			t.Fatalf("failure %d: expected delay %s, got %s", i+1, w, got)
+		}
+		clock.now = clock.now.Add(got)
+	}
+}
+
+func TestGuard_LockoutAndReset(t *testing.T) {
+	policy := lockout.Policy{
+		FreeAttempts:     100,
+		LockoutThreshold: 3,
+		LockoutDuration:  15 * time.Minute,
+		ResetAfter:       time.Hour,
+	}
+	guard, clock := newTestGuard(policy)
+	ctx := context.Background()
+
+	for i := 0; i < 3; i++ {
+		if _, err := guard.RecordFailure(ctx, "A@Example.com", ""); err != nil {
+			t.Fatalf("RecordFailure error: %v", err)
+		}
+	}
+
+	wait, err := guard.Check(ctx, "a@example.com", "")
+	if err != nil {
+		t.Fatalf("Check error: %v", err)
+	}
+	if wait != 15*time.Minute {
+		t.Fatalf("expected 15m lockout, got %s", wait)
+	}
+
+	clock.now = clock.now.Add(16 * time.Minute)
+	if wait, _ := guard.Check(ctx, "a@example.com", ""); wait != 0 {
+		t.Fatalf("expected lockout to expire, still waiting %s", wait)
+	}
+
+	if err := guard.RecordSuccess(ctx, "a@example.com"); err != nil {
+		t.Fatalf("RecordSuccess error: %v", err)
+	}
+	if delay, _ := guard.RecordFailure(ctx, "a@example.com", ""); delay != 0 {
+		t.Fatalf("expected failures to be cleared after success, got delay %s", delay)
+	}
+}
+
+func TestGuard_IPSlidingWindow(t *testing.T) {
+	policy := lockout.Policy{
+		FreeAttempts:  100,
+		IPWindow:      time.Minute,
+		IPMaxFailures: 3,
+	}
+	guard, clock := newTestGuard(policy)
+	ctx := context.Background()
+
+	for i := 0; i < 3; i++ {
+		if _, err := guard.RecordFailure(ctx, "user"+string(rune('a'+i))+"@example.com", "10.0.0.1"); err != nil {
+			t.Fatalf("RecordFailure error: %v", err)
+		}
+		clock.now = clock.now.Add(10 * time.Second)
+	}
+
+	wait, err := guard.Check(ctx, "other@example.com", "10.0.0.1")
+	if err != nil {
+		t.Fatalf("Check error: %v", err)
+	}
+	if wait != 30*time.Second {
+		t.Fatalf("expected 30s until the window frees up, got %s", wait)
+	}
+
+	if wait, _ := guard.Check(ctx, "other@example.com", "10.0.0.2"); wait != 0 {
+		t.Fatalf("expected other IPs to be unaffected, got %s", wait)
+	}
+
+	clock.now = clock.now.Add(31 * time.Second)
+	if wait, _ := guard.Check(ctx, "other@example.com", "10.0.0.1"); wait != 0 {
+		t.Fatalf("expected window to slide, still waiting %s", wait)
+	}
+}
+
+func TestGuard_ConcurrentFailuresAllCount(t *testing.T) {
+	policy := lockout.Policy{
+		FreeAttempts:     100,
+		LockoutThreshold: 10,
+		LockoutDuration:  15 * time.Minute,
+		ResetAfter:       time.Hour,
+	}
+	store := lockout.NewMemoryStore()
+	guard := lockout.NewGuard(store, policy)
+	ctx := context.Background()
+
+	const attempts = 50
+	var wg sync.WaitGroup
+	for i := 0; i < attempts; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := guard.RecordFailure(ctx, "a@example.com", ""); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	state, err := store.GetAccount(ctx, "a@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if state.Failures != attempts {
+		t.Fatalf("recorded %d failures, want %d", state.Failures, attempts)
+	}
+	if wait, _ := guard.Check(ctx, "a@example.com", ""); wait <= 0 {
+		t.Fatal("a burst of failures should lock the account")
+	}
+}
+
+func TestGuard_UnknownAccountOnlyChargesIP(t *testing.T) {
+	policy := lockout.Policy{
+		FreeAttempts:     0,
+		BaseDelay:        time.Second,
+		LockoutThreshold: 1,
+		LockoutDuration:  15 * time.Minute,
+		IPWindow:         time.Minute,
+		IPMaxFailures:    5,
+	}
+	store := lockout.NewMemoryStore()
+	guard := lockout.NewGuard(store, policy)
+	ctx := context.Background()
+
+	delay, err := guard.RecordFailure(ctx, "", "10.0.0.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if delay != 0 {
+		t.Fatalf("a failure for no account imposed %s", delay)
+	}
+	if state, _ := store.GetAccount(ctx, ""); state.Failures != 0 {
+		t.Fatalf("stored %d failures for no account", state.Failures)
+	}
+	if failures, _ := store.IPFailures(ctx, "10.0.0.1", time.Time{}); len(failures) != 1 {
+		t.Fatalf("got %d IP failures, want 1", len(failures))
+	}
+}
@@ -0,0 +1,122 @@
+package tests
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/color"
+	"image/color/palette"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"testing"
+
+	"local/mda/internal/media"
+)
+
+func testImage(w, h int) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			img.Set(x, y, color.RGBA{R: uint8(x), G: uint8(y), B: 100, A: 255})
+		}
+	}
+	return img
+}
+
+func TestProcess_StripsExifAndThumbnails(t *testing.T) {
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, testImage(640, 480), nil); err != nil {
+		t.Fatalf("encoding jpeg: %v", err)
+	}
+
+	// splice an APP1 EXIF segment in right after the SOI marker
+	payload := []byte("Exif\x00\x00GPS-SECRET")
+	segment := append([]byte{0xFF, 0xE1, 0x00, byte(len(payload) + 2)}, payload...)
+	raw := append([]byte{0xFF, 0xD8}, append(segment, buf.Bytes()[2:]...)...)
+
+	out, err := media.Process(raw, media.DefaultLimits())
+	if err != nil {
+		t.Fatalf("Process error: %v", err)
+	}
+	if out.ContentType != "image/jpeg" || out.Width != 640 || out.Height != 480 {
+		t.Fatalf("unexpected result: %s %dx%d", out.ContentType, out.Width, out.Height)
+	}
+	if bytes.Contains(out.Data, []byte("GPS-SECRET")) {
+		t.Fatalf("expected EXIF data to be stripped")
+	}
+
+	thumb, err := jpeg.Decode(bytes.NewReader(out.Thumbnail))
+	if err != nil {
+		t.Fatalf("decoding thumbnail: %v", err)
+	}
+	if b := thumb.Bounds(); b.Dx() != 320 || b.Dy() != 240 {
+		t.Fatalf("expected 320x240 thumbnail, got %dx%d", b.Dx(), b.Dy())
+	}
+}
+
+func TestProcess_RejectsByContentNotName(t *testing.T) {
+	_, err := media.Process([]byte("<html><script>alert(1)</script></html>"), media.DefaultLimits())
+	if !errors.Is(err, media.ErrUnsupportedType) {
+		t.Fatalf("expected ErrUnsupportedType, got %v", err)
+	}
+}
+
+func TestProcess_Limits(t *testing.T) {
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, testImage(100, 100)); err != nil {
+		t.Fatalf("encoding png: %v", err)
+	}
+
+	limits := media.DefaultLimits()
+	limits.MaxBytes = 10
+	if _, err := media.Process(buf.Bytes(), limits); !errors.Is(err, media.ErrTooLarge) {
+		t.Fatalf("expected ErrTooLarge, got %v", err)
+	}
+
+	limits = media.DefaultLimits()
+	limits.MaxPixels = 100 * 99
+	if _, err := media.Process(buf.Bytes(), limits); !errors.Is(err, media.ErrTooManyPixels) {
+		t.Fatalf("expected ErrTooManyPixels, got %v", err)
+	}
+}
+
+func testGIF(t *testing.T, w, h, frames int) []byte {
+	t.Helper()
+	anim := &gif.GIF{}
+	for i := 0; i < frames; i++ {
+		anim.Image = append(anim.Image, image.NewPaletted(image.Rect(0, 0, w, h), palette.Plan9))
+		anim.Delay = append(anim.Delay, 10)
+	}
+	var buf bytes.Buffer
+	if err := gif.EncodeAll(&buf, anim); err != nil {
+		t.Fatalf("encoding gif: %v", err)
+	}
+	return buf.Bytes()
+}
+
+func TestProcess_BoundsGIFFrames(t *testing.T) {
+	data := testGIF(t, 50, 40, 8)
+
+	limits := media.DefaultLimits()
+	limits.MaxPixels = 50 * 40 * 8
+	out, err := media.Process(data, limits)
+	if err != nil {
+		t.Fatalf("Process error: %v", err)
+	}
+	anim, err := gif.DecodeAll(bytes.NewReader(out.Data))
+	if err != nil || len(anim.Image) != 8 {
+		t.Fatalf("animation not kept: %v", err)
+	}
+
+	// each frame passes on its own, the whole animation doesn't
+	limits.MaxPixels = 50*40*8 - 1
+	if _, err := media.Process(data, limits); !errors.Is(err, media.ErrTooManyPixels) {
+		t.Fatalf("expected ErrTooManyPixels, got %v", err)
+	}
+
+	truncated := data[:len(data)-1]
+	if _, err := media.Process(truncated, media.DefaultLimits()); !errors.Is(err, media.ErrUnsupportedType) {
+		t.Fatalf("expected ErrUnsupportedType for a truncated gif, got %v", err)
+	}
+}
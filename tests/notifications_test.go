@@ -0,0 +1,59 @@
+package tests
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	"local/mda/internal/database"
+	"local/mda/internal/notifications"
+
+	"github.com/google/uuid"
+)
+
+// fakeNotifications applies MarkNotificationsRead's filter to unread ids.
+// pq.Array binds a nil slice as NULL, which the real query can't match
+// against, so the fake refuses it.
+type fakeNotifications struct {
+	unread map[uuid.UUID]bool
+	calls  int
+}
+
+func (f *fakeNotifications) MarkNotificationsRead(ctx context.Context, arg database.MarkNotificationsReadParams) (int64, error) {
+	f.calls++
+	if arg.Ids == nil {
+		return 0, errors.New("ids bound as NULL")
+	}
+	var n int64
+	for id := range f.unread {
+		if arg.MarkAll || slices.Contains(arg.Ids, id) {
+			delete(f.unread, id)
+			n++
+		}
+	}
+	return n, nil
+}
+
+func TestMarkReadWithoutIdsMarksAll(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2026, 6, 1, 12, 0, 0, 0, time.UTC)
+	a, b, c := uuid.New(), uuid.New(), uuid.New()
+	f := &fakeNotifications{unread: map[uuid.UUID]bool{a: true, b: true, c: true}}
+
+	n, err := notifications.MarkRead(ctx, f, uuid.New(), []uuid.UUID{a}, now)
+	if err != nil || n != 1 || f.unread[a] {
+		t.Fatalf("marking one: n=%d err=%v unread=%v", n, err, f.unread)
+	}
+
+	n, err = notifications.MarkRead(ctx, f, uuid.New(), []uuid.UUID{}, now)
+	if err != nil || n != 0 || len(f.unread) != 2 || f.calls != 1 {
+		t.Fatalf("empty ids: n=%d err=%v unread=%v calls=%d", n, err, f.unread, f.calls)
+	}
+
+	n, err = notifications.MarkRead(ctx, f, uuid.New(), nil, now)
+	if err != nil || n != 2 || len(f.unread) != 0 {
+		t.Fatalf("marking all: n=%d err=%v unread=%v", n, err, f.unread)
+	}
+}
@@ -0,0 +1,53 @@
+package tests
+
+import (
+	"net/url"
+	"testing"
+
+	"local/mda/internal/paging"
+)
+
+func TestPagingParse(t *testing.T) {
+	cases := []struct {
+		query string
+		want  paging.Params
+		ok    bool
+	}{
+		{"", paging.Params{}, true},
+		{"sort=desc&limit=20&offset=40", paging.Params{Desc: true, Limit: 20, Offset: 40}, true},
+		{"sort=asc", paging.Params{}, true},
+		{"sort=sideways", paging.Params{}, true},
+		{"limit=100", paging.Params{Limit: 100}, true},
+		{"limit=0", paging.Params{}, false},
+		{"limit=101", paging.Params{}, false},
+		{"limit=ten", paging.Params{}, false},
+		{"offset=-1", paging.Params{}, false},
+	}
+	for _, c := range cases {
+		q, _ := url.ParseQuery(c.query)
+		got, err := paging.Parse(q)
+		if (err == nil) != c.ok {
+			t.Errorf("%q: err = %v", c.query, err)
+			continue
+		}
+		if got != c.want {
+			t.Errorf("%q: got %+v, want %+v", c.query, got, c.want)
+		}
+	}
+}
+
+func TestPagingSQLArgs(t *testing.T) {
+	// without a limit the whole list comes back, as before paging moved into
+	// the queries
+	if l := (paging.Params{}).SQLLimit(); l.Valid {
+		t.Fatalf("no limit should bind NULL, got %+v", l)
+	}
+
+	p := paging.Params{Limit: 25, Offset: 50}
+	if l := p.SQLLimit(); !l.Valid || l.Int32 != 25 {
+		t.Fatalf("SQLLimit = %+v", l)
+	}
+	if p.SQLOffset() != 50 {
+		t.Fatalf("SQLOffset = %d", p.SQLOffset())
+	}
+}
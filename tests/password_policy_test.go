@@ -0,0 +1,74 @@
+package tests
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"local/mda/internal/auth"
+)
+
+func violationCodes(t *testing.T, err error) []string {
+	t.Helper()
+	if err == nil {
+		return nil
+	}
+	var policyErr *auth.PasswordPolicyError
+	if !errors.As(err, &policyErr) {
+		t.Fatalf("expected *PasswordPolicyError, got %v", err)
+	}
+	codes := make([]string, 0, len(policyErr.Violations))
+	for _, v := range policyErr.Violations {
+		codes = append(codes, v.Code)
+	}
+	return codes
+}
+
+func TestPasswordPolicy_Validate(t *testing.T) {
+	policy := auth.DefaultPasswordPolicy()
+
+	tests := []struct {
+		name     string
+		password string
+		want     []string
+	}{
+		{name: "empty", password: "", want: []string{"too_short"}},
+		{name: "short", password: "Ab1!xyz", want: []string{"too_short"}},
+		{name: "repetitive", password: "aaaaaaaaaa", want: []string{"too_weak"}},
+		{name: "too long", password: strings.Repeat("Ab1!", 20), want: []string{"too_long"}},
+		{name: "strong", password: "correct-Horse-7", want: nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := violationCodes(t, policy.Validate(tt.password))
+			if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("Validate(%q) violations = %v, want %v", tt.password, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPasswordPolicy_BreachedCorpus(t *testing.T) {
+	dir := t.TempDir()
+	sum := sha1.Sum([]byte("Tr0ub4dor&3"))
+	hash := strings.ToUpper(hex.EncodeToString(sum[:]))
+	content := "0000000000000000000000000000000000A:1\n" + hash[5:] + ":42\n"
+	if err := os.WriteFile(filepath.Join(dir, hash[:5]+".txt"), []byte(content), 0o644); err != nil {
+		t.Fatalf("writing corpus: %v", err)
+	}
+
+	policy := auth.DefaultPasswordPolicy()
+	policy.Breached = auth.NewBreachedCorpus(dir)
+
+	if got := violationCodes(t, policy.Validate("Tr0ub4dor&3")); len(got) != 1 || got[0] != "breached" {
+		t.Fatalf("expected breached violation, got %v", got)
+	}
+	if err := policy.Validate("correct-Horse-7"); err != nil {
+		t.Fatalf("expected password missing from corpus to pass, got %v", err)
+	}
+}
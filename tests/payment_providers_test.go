@@ -0,0 +1,153 @@
+package tests
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+
+	"local/mda/internal/subscriptions"
+	"local/mda/internal/webhooks"
+
+	"github.com/google/uuid"
+)
+
+func TestRegistryLookup(t *testing.T) {
+	reg := webhooks.NewRegistry()
+	polka := &webhooks.Polka{APIKey: "k"}
+	reg.Register("polka", polka)
+
+	if p, ok := reg.Lookup("polka"); !ok || p != polka {
+		t.Fatalf("Lookup(polka) = %v, %v", p, ok)
+	}
+	if _, ok := reg.Lookup("stripe"); ok {
+		t.Fatal("unregistered provider found")
+	}
+}
+
+func TestPolkaVerifyAPIKey(t *testing.T) {
+	p := &webhooks.Polka{APIKey: "polka-key"}
+	body := []byte(`{}`)
+
+	h := http.Header{}
+	h.Set("Authorization", "ApiKey polka-key")
+	if err := p.Verify(h, body, time.Now()); err != nil {
+		t.Fatalf("valid key rejected: %v", err)
+	}
+	h.Set("Authorization", "ApiKey nope")
+	if err := p.Verify(h, body, time.Now()); !errors.Is(err, webhooks.ErrInvalidAPIKey) {
+		t.Fatalf("wrong key: got %v", err)
+	}
+}
+
+func TestPolkaVerifySignature(t *testing.T) {
+	p := &webhooks.Polka{Secret: "polka-secret", ReplayWindow: 5 * time.Minute}
+	body := []byte(`{"event":"user.upgraded"}`)
+	now := time.Unix(1_700_000_000, 0)
+	// Polka sends the timestamp and hex signature in separate headers
+	v1 := webhooks.Sign("polka-secret", now, body)[len("t=1700000000,v1="):]
+
+	h := http.Header{}
+	h.Set(webhooks.PolkaTimestampHeader, strconv.FormatInt(now.Unix(), 10))
+	h.Set(webhooks.PolkaSignatureHeader, v1)
+	if err := p.Verify(h, body, now); !errors.Is(err, webhooks.ErrMissingDeliveryID) {
+		t.Fatalf("without delivery ID: got %v", err)
+	}
+	h.Set(webhooks.PolkaDeliveryIDHeader, "d-1")
+	if err := p.Verify(h, body, now); err != nil {
+		t.Fatalf("valid signature rejected: %v", err)
+	}
+	if err := p.Verify(h, body, now.Add(10*time.Minute)); !errors.Is(err, webhooks.ErrSignatureExpired) {
+		t.Fatalf("replayed delivery: got %v", err)
+	}
+}
+
+func TestPolkaParse(t *testing.T) {
+	p := &webhooks.Polka{}
+	userID := uuid.New()
+	h := http.Header{}
+	h.Set(webhooks.PolkaDeliveryIDHeader, "d-1")
+
+	e, err := p.Parse(h, []byte(`{"event":"subscription.renewed","data":{"user_id":"`+userID.String()+`","current_period_end":"2026-04-01T00:00:00Z"}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e.Type != subscriptions.EventRenewed || e.UserID != userID || e.DeliveryID != "d-1" {
+		t.Fatalf("got %+v", e)
+	}
+	if e.CurrentPeriodEnd == nil || !e.CurrentPeriodEnd.Equal(time.Date(2026, 4, 1, 0, 0, 0, 0, time.UTC)) {
+		t.Fatalf("period end = %v", e.CurrentPeriodEnd)
+	}
+
+	if _, err := p.Parse(h, []byte(`{"event":"user.payment_method_added","data":{}}`)); !errors.Is(err, webhooks.ErrIgnoredEvent) {
+		t.Fatalf("unknown event: got %v", err)
+	}
+}
+
+func TestStripeVerify(t *testing.T) {
+	s := &webhooks.Stripe{Secret: "whsec_stripe", Tolerance: 5 * time.Minute}
+	body := []byte(`{"id":"evt_1"}`)
+	now := time.Unix(1_700_000_000, 0)
+
+	h := http.Header{}
+	// Stripe adds v0 entries for test-mode signatures; they're ignored
+	h.Set(webhooks.StripeSignatureHeader, webhooks.Sign("whsec_stripe", now, body)+",v0=00")
+	if err := s.Verify(h, body, now); err != nil {
+		t.Fatalf("valid signature rejected: %v", err)
+	}
+	h.Set(webhooks.StripeSignatureHeader, webhooks.Sign("whsec_other", now, body))
+	if err := s.Verify(h, body, now); !errors.Is(err, webhooks.ErrSignatureMismatch) {
+		t.Fatalf("wrong secret: got %v", err)
+	}
+}
+
+func TestStripeParse(t *testing.T) {
+	s := &webhooks.Stripe{}
+	userID := uuid.New()
+	meta := `"metadata":{"user_id":"` + userID.String() + `"}`
+
+	cases := []struct {
+		name string
+		body string
+		want string
+	}{
+		{"created", `{"id":"evt_1","type":"customer.subscription.created","created":1772323200,"data":{"object":{"status":"active","current_period_end":1775001600,` + meta + `}}}`, subscriptions.EventUpgraded},
+		{"renewed", `{"id":"evt_2","type":"customer.subscription.updated","data":{"object":{"status":"active",` + meta + `}}}`, subscriptions.EventRenewed},
+		{"cancel at period end", `{"id":"evt_3","type":"customer.subscription.updated","data":{"object":{"status":"active","cancel_at_period_end":true,` + meta + `}}}`, subscriptions.EventCanceled},
+		{"past due", `{"id":"evt_4","type":"customer.subscription.updated","data":{"object":{"status":"past_due",` + meta + `}}}`, subscriptions.EventPaymentFailed},
+		{"deleted", `{"id":"evt_5","type":"customer.subscription.deleted","data":{"object":{"status":"canceled",` + meta + `}}}`, subscriptions.EventDowngraded},
+		{"invoice failed", `{"id":"evt_6","type":"invoice.payment_failed","data":{"object":{"subscription_details":{` + meta + `}}}}`, subscriptions.EventPaymentFailed},
+		{"refund", `{"id":"evt_7","type":"charge.refunded","data":{"object":{` + meta + `}}}`, subscriptions.EventRefunded},
+	}
+	for _, c := range cases {
+		e, err := s.Parse(nil, []byte(c.body))
+		if err != nil {
+			t.Fatalf("%s: %v", c.name, err)
+		}
+		if e.Type != c.want || e.UserID != userID {
+			t.Errorf("%s: got %+v, want %s", c.name, e, c.want)
+		}
+	}
+
+	e, _ := s.Parse(nil, []byte(cases[0].body))
+	if e.DeliveryID != "evt_1" {
+		t.Errorf("DeliveryID = %q, want the event ID", e.DeliveryID)
+	}
+	if e.CurrentPeriodEnd == nil || e.CurrentPeriodEnd.Unix() != 1775001600 {
+		t.Errorf("CurrentPeriodEnd = %v", e.CurrentPeriodEnd)
+	}
+	if e.OccurredAt.Unix() != 1772323200 {
+		t.Errorf("OccurredAt = %v, want the event's created time", e.OccurredAt)
+	}
+	if e, _ := s.Parse(nil, []byte(cases[1].body)); !e.OccurredAt.IsZero() {
+		t.Errorf("OccurredAt = %v for an event without created", e.OccurredAt)
+	}
+
+	if _, err := s.Parse(nil, []byte(`{"id":"evt_8","type":"customer.created","data":{"object":{}}}`)); !errors.Is(err, webhooks.ErrIgnoredEvent) {
+		t.Fatalf("unhandled type: got %v", err)
+	}
+	if _, err := s.Parse(nil, []byte(`{"id":"evt_9","type":"customer.subscription.deleted","data":{"object":{}}}`)); err == nil {
+		t.Fatal("event without user_id metadata accepted")
+	}
+}
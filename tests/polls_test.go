@@ -0,0 +1,181 @@
+package tests
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+	"time"
+
+	"local/mda/internal/database"
+	"local/mda/internal/polls"
+
+	"github.com/google/uuid"
+)
+
+func TestPollOptionCount(t *testing.T) {
+	publishAt := time.Date(2026, 6, 1, 12, 0, 0, 0, time.UTC)
+	all := []string{"a", "b", "c", "d", "e"}
+
+	for n := 0; n <= len(all); n++ {
+		req := polls.Request{Options: all[:n], ClosesAt: publishAt.Add(time.Hour)}
+		problems := req.Validate(publishAt)
+		wantOK := n >= polls.MinOptions && n <= polls.MaxOptions
+		if wantOK && len(problems) != 0 {
+			t.Errorf("%d options: unexpected problems %v", n, problems)
+		}
+		if !wantOK && (len(problems) != 1 || problems[0].Code != "count") {
+			t.Errorf("%d options: got %v, want a count problem", n, problems)
+		}
+	}
+}
+
+func TestPollOptionLabels(t *testing.T) {
+	publishAt := time.Date(2026, 6, 1, 12, 0, 0, 0, time.UTC)
+	req := polls.Request{
+		Options:  []string{" Yes ", "yes", "", "this option is far too long to fit"},
+		ClosesAt: publishAt.Add(time.Hour),
+	}
+	codes := map[string]string{}
+	for _, p := range req.Validate(publishAt) {
+		codes[p.Field] = p.Code
+	}
+	want := map[string]string{
+		"poll.options[1]": "duplicate",
+		"poll.options[2]": "required",
+		"poll.options[3]": "too_long",
+	}
+	if len(codes) != len(want) {
+		t.Fatalf("got %v, want %v", codes, want)
+	}
+	for field, code := range want {
+		if codes[field] != code {
+			t.Errorf("%s: got %q, want %q", field, codes[field], code)
+		}
+	}
+
+	labels := polls.Request{Options: []string{" kerfuffle ", "fine"}}.Labels()
+	if labels[0] != "****" || labels[1] != "fine" {
+		t.Errorf("Labels = %q", labels)
+	}
+}
+
+func TestPollClosingTime(t *testing.T) {
+	publishAt := time.Date(2026, 6, 1, 12, 0, 0, 0, time.UTC)
+	cases := []struct {
+		closesAt time.Time
+		ok       bool
+	}{
+		{publishAt.Add(polls.MinDuration - time.Second), false},
+		{publishAt.Add(polls.MinDuration), true},
+		{publishAt.Add(polls.MaxDuration), true},
+		{publishAt.Add(polls.MaxDuration + time.Second), false},
+		{publishAt.Add(-time.Hour), false},
+	}
+	for _, c := range cases {
+		req := polls.Request{Options: []string{"a", "b"}, ClosesAt: c.closesAt}
+		problems := req.Validate(publishAt)
+		if c.ok != (len(problems) == 0) {
+			t.Errorf("closes %v after publishing: got %v", c.closesAt.Sub(publishAt), problems)
+		}
+		if !c.ok && (len(problems) != 1 || problems[0].Field != "poll.closes_at") {
+			t.Errorf("closes %v after publishing: got %v", c.closesAt.Sub(publishAt), problems)
+		}
+	}
+}
+
+func TestPollTallyVisibility(t *testing.T) {
+	closesAt := time.Date(2026, 6, 2, 12, 0, 0, 0, time.UTC)
+	poll := database.Poll{ChirpID: uuid.New(), ClosesAt: closesAt}
+	yes := database.PollOption{ID: uuid.New(), ChirpID: poll.ChirpID, Position: 0, Label: "yes"}
+	no := database.PollOption{ID: uuid.New(), ChirpID: poll.ChirpID, Position: 1, Label: "no"}
+	options := []database.PollOption{yes, no}
+	votes := map[uuid.UUID]int64{yes.ID: 3, no.ID: 1}
+
+	open := polls.View(poll, options, votes, nil, closesAt.Add(-time.Minute))
+	if open.Closed || open.TotalVotes != nil {
+		t.Fatalf("open poll without a vote shows results: %+v", open)
+	}
+	for _, o := range open.Options {
+		if o.Votes != nil {
+			t.Fatalf("option %s shows votes before voting", o.Label)
+		}
+	}
+
+	voted := polls.View(poll, options, votes, &yes.ID, closesAt.Add(-time.Minute))
+	if voted.TotalVotes == nil || *voted.TotalVotes != 4 || *voted.ViewerVote != yes.ID {
+		t.Fatalf("voter should see results: %+v", voted)
+	}
+	if *voted.Options[0].Votes != 3 || *voted.Options[1].Votes != 1 {
+		t.Fatalf("wrong tallies: %+v", voted.Options)
+	}
+
+	closed := polls.View(poll, options, votes, nil, closesAt)
+	if !closed.Closed || closed.TotalVotes == nil || *closed.TotalVotes != 4 {
+		t.Fatalf("closed poll should show results to everyone: %+v", closed)
+	}
+
+	empty := polls.View(poll, options, nil, nil, closesAt)
+	if *empty.TotalVotes != 0 || *empty.Options[0].Votes != 0 {
+		t.Fatalf("options without votes should count zero: %+v", empty)
+	}
+}
+
+// fakePollVotes keeps votes keyed like poll_votes' primary key.
+type fakePollVotes struct {
+	poll  database.Poll
+	votes map[[2]uuid.UUID]uuid.UUID
+}
+
+func (f *fakePollVotes) GetPoll(ctx context.Context, chirpID uuid.UUID) (database.Poll, error) {
+	if chirpID != f.poll.ChirpID {
+		return database.Poll{}, sql.ErrNoRows
+	}
+	return f.poll, nil
+}
+
+func (f *fakePollVotes) CreatePollVote(ctx context.Context, arg database.CreatePollVoteParams) (int64, error) {
+	key := [2]uuid.UUID{arg.ChirpID, arg.UserID}
+	if _, ok := f.votes[key]; ok {
+		return 0, nil
+	}
+	f.votes[key] = arg.OptionID
+	return 1, nil
+}
+
+func TestPollOneVotePerUser(t *testing.T) {
+	closesAt := time.Date(2026, 6, 2, 12, 0, 0, 0, time.UTC)
+	f := &fakePollVotes{
+		poll:  database.Poll{ChirpID: uuid.New(), ClosesAt: closesAt},
+		votes: map[[2]uuid.UUID]uuid.UUID{},
+	}
+	ctx := context.Background()
+	alice, bob := uuid.New(), uuid.New()
+	yes, no := uuid.New(), uuid.New()
+	before := closesAt.Add(-time.Hour)
+
+	if err := polls.Vote(ctx, f, f.poll.ChirpID, alice, yes, before); err != nil {
+		t.Fatal(err)
+	}
+	if err := polls.Vote(ctx, f, f.poll.ChirpID, alice, no, before); !errors.Is(err, polls.ErrAlreadyVoted) {
+		t.Fatalf("second vote: got %v", err)
+	}
+	if f.votes[[2]uuid.UUID{f.poll.ChirpID, alice}] != yes {
+		t.Fatal("the second vote replaced the first")
+	}
+	if err := polls.Vote(ctx, f, f.poll.ChirpID, bob, no, before); err != nil {
+		t.Fatalf("another user's vote: %v", err)
+	}
+
+	carol := uuid.New()
+	if err := polls.Vote(ctx, f, f.poll.ChirpID, carol, yes, closesAt); !errors.Is(err, polls.ErrClosed) {
+		t.Fatalf("vote at closing time: got %v", err)
+	}
+	if _, ok := f.votes[[2]uuid.UUID{f.poll.ChirpID, carol}]; ok {
+		t.Fatal("a vote was recorded on a closed poll")
+	}
+
+	if err := polls.Vote(ctx, f, uuid.New(), alice, yes, before); !errors.Is(err, sql.ErrNoRows) {
+		t.Fatalf("chirp without a poll: got %v", err)
+	}
+}
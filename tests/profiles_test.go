@@ -0,0 +1,136 @@
+package tests
+
+import (
+	"database/sql"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"local/mda/internal/database"
+	"local/mda/internal/profiles"
+
+	"github.com/google/uuid"
+)
+
+func strPtr(s string) *string { return &s }
+
+func TestValidHandle(t *testing.T) {
+	cases := []struct {
+		handle string
+		valid  bool
+	}{
+		{"alice", true},
+		{"a_1", true},
+		{strings.Repeat("a", 30), true},
+		{"ab", false},
+		{strings.Repeat("a", 31), false},
+		{"Alice", false},
+		{"al-ice", false},
+		{"al ice", false},
+		{"me", false},
+	}
+	for _, c := range cases {
+		if got := profiles.ValidHandle(c.handle); got != c.valid {
+			t.Errorf("ValidHandle(%q) = %v, want %v", c.handle, got, c.valid)
+		}
+	}
+}
+
+func TestUpdateNormalizesHandle(t *testing.T) {
+	// the unique index is on the stored handle, so every spelling of a
+	// handle has to normalize to the same value to collide there
+	for _, in := range []string{"alice", "Alice", "@alice", " @ALICE "} {
+		u := profiles.Update{Handle: strPtr(in)}
+		if problems := u.Validate(); len(problems) != 0 {
+			t.Fatalf("%q: unexpected problems %v", in, problems)
+		}
+		if *u.Handle != "alice" {
+			t.Errorf("%q normalized to %q", in, *u.Handle)
+		}
+	}
+
+	clear := profiles.Update{Handle: strPtr("")}
+	if problems := clear.Validate(); len(problems) != 0 {
+		t.Fatalf("clearing the handle should be allowed: %v", problems)
+	}
+
+	bad := profiles.Update{Handle: strPtr("@me")}
+	problems := bad.Validate()
+	if len(problems) != 1 || problems[0].Field != "handle" {
+		t.Fatalf("reserved handle: got %v", problems)
+	}
+}
+
+func TestUpdateValidatesFields(t *testing.T) {
+	u := profiles.Update{
+		DisplayName: strPtr(strings.Repeat("x", profiles.MaxDisplayNameLength+1)),
+		Bio:         strPtr(strings.Repeat("x", profiles.MaxBioLength+1)),
+		AvatarUrl:   strPtr("javascript:alert(1)"),
+	}
+	fields := map[string]bool{}
+	for _, p := range u.Validate() {
+		fields[p.Field] = true
+	}
+	for _, f := range []string{"display_name", "bio", "avatar_url"} {
+		if !fields[f] {
+			t.Errorf("expected a problem for %s", f)
+		}
+	}
+
+	ok := profiles.Update{
+		DisplayName: strPtr("  Alice  "),
+		Bio:         strPtr(strings.Repeat("é", profiles.MaxBioLength)),
+		AvatarUrl:   strPtr("https://example.com/a.png"),
+	}
+	if problems := ok.Validate(); len(problems) != 0 {
+		t.Fatalf("unexpected problems %v", problems)
+	}
+	if *ok.DisplayName != "Alice" {
+		t.Errorf("display name not trimmed: %q", *ok.DisplayName)
+	}
+	if !(profiles.Update{}).Empty() || ok.Empty() {
+		t.Error("Empty reports the wrong thing")
+	}
+}
+
+func TestParseKey(t *testing.T) {
+	id := uuid.New()
+
+	if k := profiles.ParseKey("me"); !k.Me {
+		t.Errorf("me: got %+v", k)
+	}
+	if k := profiles.ParseKey(id.String()); k.Me || k.Handle != "" || k.ID != id {
+		t.Errorf("uuid: got %+v", k)
+	}
+	for _, in := range []string{"alice", "@alice", "@Alice"} {
+		if k := profiles.ParseKey(in); k.Me || k.ID != uuid.Nil || k.Handle != "alice" {
+			t.Errorf("%q: got %+v", in, k)
+		}
+	}
+}
+
+func TestPublicViewsOmitEmail(t *testing.T) {
+	u := database.User{
+		ID:          uuid.New(),
+		Email:       "alice@example.com",
+		Handle:      sql.NullString{String: "alice", Valid: true},
+		DisplayName: "Alice",
+		AvatarUrl:   "https://example.com/a.png",
+	}
+
+	for name, v := range map[string]any{
+		"profile": profiles.FromUser(u),
+		"author":  profiles.AuthorOf(u),
+	} {
+		data, err := json.Marshal(v)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if strings.Contains(string(data), "alice@example.com") || strings.Contains(string(data), `"email"`) {
+			t.Errorf("%s leaks the email: %s", name, data)
+		}
+		if !strings.Contains(string(data), `"handle":"alice"`) {
+			t.Errorf("%s is missing the handle: %s", name, data)
+		}
+	}
+}
@@ -0,0 +1,152 @@
+package tests
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"local/mda/internal/ratelimit"
+)
+
+func TestTake_RefillsOverTime(t *testing.T) {
+	rule := ratelimit.Rule{Capacity: 2, Per: 2 * time.Second}
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	var b ratelimit.Bucket
+	var res ratelimit.Result
+	for i := 0; i < 2; i++ {
+		b, res = ratelimit.Take(b, rule, now)
+		if !res.Allowed {
+			t.Fatalf("request %d: expected allowed", i+1)
+		}
+	}
+	if res.Remaining != 0 {
+		t.Fatalf("expected 0 remaining, got %d", res.Remaining)
+	}
+
+	b, res = ratelimit.Take(b, rule, now)
+	if res.Allowed {
+		t.Fatalf("expected third request to be rejected")
+	}
+	if res.RetryAfter != time.Second {
+		t.Fatalf("expected retry after 1s, got %s", res.RetryAfter)
+	}
+
+	_, res = ratelimit.Take(b, rule, now.Add(time.Second))
+	if !res.Allowed {
+		t.Fatalf("expected a token to be refilled after 1s")
+	}
+}
+
+func TestLimiter_GlobalAndRouteRules(t *testing.T) {
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	limiter := ratelimit.New(ratelimit.NewMemoryStore()).WithClock(func() time.Time { return now })
+	limiter.SetGlobal(ratelimit.Rule{Capacity: 5, Per: time.Minute})
+	limiter.SetRoute("POST /api/chirps", ratelimit.Rule{Capacity: 2, Per: time.Minute})
+	ctx := context.Background()
+
+	for i := 0; i < 2; i++ {
+		res, ok, err := limiter.Allow(ctx, "POST /api/chirps", "user:1")
+		if err != nil || !ok || !res.Allowed {
+			t.Fatalf("request %d: expected allowed, got %+v ok=%v err=%v", i+1, res, ok, err)
+		}
+	}
+	res, _, _ := limiter.Allow(ctx, "POST /api/chirps", "user:1")
+	if res.Allowed || res.Limit != 2 {
+		t.Fatalf("expected route limit of 2 to reject, got %+v", res)
+	}
+
+	// the rejected request didn't spend a global token, so other routes,
+	// which only see the global bucket, have 3 left
+	for i := 0; i < 3; i++ {
+		res, _, _ := limiter.Allow(ctx, "GET /api/chirps", "user:1")
+		if !res.Allowed || res.Limit != 5 {
+			t.Fatalf("expected global rule to allow, got %+v", res)
+		}
+	}
+	if res, _, _ := limiter.Allow(ctx, "GET /api/chirps", "user:1"); res.Allowed {
+		t.Fatalf("expected global limit to be exhausted")
+	}
+
+	if res, _, _ := limiter.Allow(ctx, "GET /api/chirps", "user:2"); !res.Allowed {
+		t.Fatalf("expected other keys to have their own buckets")
+	}
+}
+
+func TestLimiter_ReportsRejectingRule(t *testing.T) {
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	global := ratelimit.Rule{Capacity: 1, Per: time.Minute}
+	route := ratelimit.Rule{Capacity: 10, Per: 10 * time.Minute}
+	limiter := ratelimit.New(ratelimit.NewMemoryStore()).WithClock(func() time.Time { return now })
+	limiter.SetGlobal(global)
+	limiter.SetRoute("POST /api/chirps", route)
+	ctx := context.Background()
+
+	res, _, _ := limiter.Allow(ctx, "POST /api/chirps", "user:1")
+	if !res.Allowed || res.Rule != route || res.Remaining != 9 {
+		t.Fatalf("expected the route rule to describe an allowed request, got %+v", res)
+	}
+
+	res, _, _ = limiter.Allow(ctx, "POST /api/chirps", "user:1")
+	if res.Allowed || res.Rule != global || res.Limit != 1 || res.Rule.Policy() != "1;w=60" {
+		t.Fatalf("expected the global rule to reject, got %+v", res)
+	}
+
+	// the global rejection didn't spend a route token: a minute refills
+	// one, back to 10, and this request takes it
+	now = now.Add(time.Minute)
+	res, _, _ = limiter.Allow(ctx, "POST /api/chirps", "user:1")
+	if !res.Allowed || res.Remaining != 9 {
+		t.Fatalf("expected 9 route tokens left, got %+v", res)
+	}
+}
+
+// countingStore records the keys it is asked about.
+type countingStore struct {
+	ratelimit.Store
+	keys []string
+}
+
+func (s *countingStore) Take(ctx context.Context, limits []ratelimit.Limit, now time.Time) ([]ratelimit.Result, error) {
+	for _, l := range limits {
+		s.keys = append(s.keys, l.Key)
+	}
+	return s.Store.Take(ctx, limits, now)
+}
+
+func TestLimiter_LocalRulesSkipTheSharedStore(t *testing.T) {
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	shared := &countingStore{Store: ratelimit.NewMemoryStore()}
+	route := ratelimit.Rule{Capacity: 2, Per: time.Minute}
+	limiter := ratelimit.New(shared).
+		WithLocalStore(ratelimit.NewMemoryStore()).
+		WithClock(func() time.Time { return now })
+	limiter.SetGlobal(ratelimit.Rule{Capacity: 2, Per: time.Minute, Local: true})
+	limiter.SetRoute("/app/", ratelimit.Rule{Capacity: 10, Per: time.Minute, Local: true})
+	limiter.SetRoute("POST /api/chirps", route)
+	ctx := context.Background()
+
+	if res, _, _ := limiter.Allow(ctx, "/app/", "ip:1"); !res.Allowed || res.Limit != 10 {
+		t.Fatalf("expected the file server rule to allow, got %+v", res)
+	}
+	if len(shared.keys) != 0 {
+		t.Fatalf("local rules reached the shared store: %v", shared.keys)
+	}
+
+	res, _, _ := limiter.Allow(ctx, "POST /api/chirps", "ip:1")
+	if !res.Allowed || res.Rule != route || res.Remaining != 1 {
+		t.Fatalf("expected the route rule to describe an allowed request, got %+v", res)
+	}
+	if len(shared.keys) != 1 || shared.keys[0] != "POST /api/chirps|ip:1" {
+		t.Fatalf("shared store saw %v, want only the route bucket", shared.keys)
+	}
+
+	// the global bucket is out after two requests, before the route's
+	// turn comes, so the route keeps its last token
+	if res, _, _ := limiter.Allow(ctx, "POST /api/chirps", "ip:1"); res.Allowed || res.Limit != 2 || !res.Rule.Local {
+		t.Fatalf("expected the global rule to reject, got %+v", res)
+	}
+	if len(shared.keys) != 1 {
+		t.Fatalf("a locally rejected request reached the shared store: %v", shared.keys)
+	}
+}
@@ -0,0 +1,93 @@
+package tests
+
+import (
+	"slices"
+	"testing"
+
+	"local/mda/internal/database"
+	"local/mda/internal/events"
+	"local/mda/internal/relationships"
+	"local/mda/internal/stream"
+
+	"github.com/google/uuid"
+)
+
+func rel(from uuid.UUID, kind string, to uuid.UUID) database.UserRelationship {
+	return database.UserRelationship{UserID: from, TargetID: to, Kind: kind}
+}
+
+func TestHiddenInFeeds(t *testing.T) {
+	alice, bob, carol, dave := uuid.New(), uuid.New(), uuid.New(), uuid.New()
+	rels := []database.UserRelationship{
+		rel(alice, relationships.Mute, bob),
+		rel(carol, relationships.Block, alice),
+		rel(alice, relationships.Block, dave),
+	}
+
+	got := relationships.HiddenInFeeds(alice, rels)
+	if len(got) != 3 || !slices.Contains(got, bob) || !slices.Contains(got, carol) || !slices.Contains(got, dave) {
+		t.Fatalf("alice's feed hides %v, want bob, carol and dave", got)
+	}
+
+	// muting is one-way: bob still sees alice
+	if got := relationships.HiddenInFeeds(bob, rels[:1]); len(got) != 0 {
+		t.Fatalf("muted user's feed hides %v", got)
+	}
+	// blocking is two-way: dave doesn't see alice either
+	if got := relationships.HiddenInFeeds(dave, rels[2:]); !slices.Equal(got, []uuid.UUID{alice}) {
+		t.Fatalf("blocked user's feed hides %v, want the blocker", got)
+	}
+}
+
+func TestHiddenByLink(t *testing.T) {
+	alice, bob, carol := uuid.New(), uuid.New(), uuid.New()
+	rels := []database.UserRelationship{
+		rel(alice, relationships.Mute, bob),
+		rel(alice, relationships.Block, carol),
+		rel(bob, relationships.Block, alice),
+	}
+
+	if got := relationships.HiddenByLink(alice, rels); !slices.Equal(got, []uuid.UUID{bob}) {
+		t.Fatalf("alice can't open %v, want only bob, who blocked her", got)
+	}
+	if got := relationships.HiddenByLink(carol, rels[1:2]); !slices.Equal(got, []uuid.UUID{alice}) {
+		t.Fatalf("carol can't open %v, want alice", got)
+	}
+}
+
+func TestHiddenIsNeverNil(t *testing.T) {
+	alice, bob := uuid.New(), uuid.New()
+	for name, rule := range map[string]relationships.Rule{
+		"feeds": relationships.HiddenInFeeds,
+		"link":  relationships.HiddenByLink,
+	} {
+		if got := rule(alice, nil); got == nil || len(got) != 0 {
+			t.Errorf("%s: no relationships gave %#v, want an empty slice", name, got)
+		}
+	}
+
+	// both sides blocking shows up once
+	rels := []database.UserRelationship{
+		rel(alice, relationships.Block, bob),
+		rel(bob, relationships.Block, alice),
+	}
+	if got := relationships.HiddenInFeeds(alice, rels); !slices.Equal(got, []uuid.UUID{bob}) {
+		t.Fatalf("got %v, want bob once", got)
+	}
+}
+
+func TestStreamHidesFeedRule(t *testing.T) {
+	alice, bob, carol := uuid.New(), uuid.New(), uuid.New()
+	rels := []database.UserRelationship{rel(alice, relationships.Mute, bob)}
+
+	f := stream.Filter{Hidden: map[uuid.UUID]bool{}}
+	for _, id := range relationships.HiddenInFeeds(alice, rels) {
+		f.Hidden[id] = true
+	}
+	if f.Match(events.Event{Type: events.ChirpCreated, UserID: bob}) {
+		t.Fatal("stream shows a muted author")
+	}
+	if !f.Match(events.Event{Type: events.ChirpCreated, UserID: carol}) {
+		t.Fatal("stream hides an unrelated author")
+	}
+}
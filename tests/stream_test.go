@@ -0,0 +1,105 @@
+package tests
+
+import (
+	"context"
+	"testing"
+
+	"local/mda/internal/events"
+	"local/mda/internal/stream"
+
+	"github.com/google/uuid"
+)
+
+func chirpEvent(t *testing.T, kind string, author uuid.UUID, body string) events.Event {
+	t.Helper()
+	e, err := events.New(kind, author, map[string]any{"body": body, "user_id": author})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return e
+}
+
+func TestHubResumesFromLastEventID(t *testing.T) {
+	hub := stream.NewHub(8, 8)
+	author := uuid.New()
+	ctx := context.Background()
+
+	first, _, _ := hub.Subscribe(0)
+	for i := 0; i < 3; i++ {
+		hub.Publish(ctx, chirpEvent(t, events.ChirpCreated, author, "hello"))
+	}
+	seen := <-first.C
+	hub.Unsubscribe(first)
+
+	_, backlog, complete := hub.Subscribe(seen.ID)
+	if !complete {
+		t.Fatal("expected a complete resume")
+	}
+	if len(backlog) != 2 || backlog[0].ID != seen.ID+1 || backlog[1].ID != seen.ID+2 {
+		t.Fatalf("unexpected backlog: %+v", backlog)
+	}
+}
+
+func TestHubReportsEvictedEvents(t *testing.T) {
+	hub := stream.NewHub(2, 8)
+	author := uuid.New()
+	ctx := context.Background()
+
+	sub, _, _ := hub.Subscribe(0)
+	hub.Publish(ctx, chirpEvent(t, events.ChirpCreated, author, "one"))
+	first := <-sub.C
+	for i := 0; i < 3; i++ {
+		hub.Publish(ctx, chirpEvent(t, events.ChirpCreated, author, "more"))
+	}
+
+	_, backlog, complete := hub.Subscribe(first.ID)
+	if complete {
+		t.Fatal("expected an incomplete resume after eviction")
+	}
+	if len(backlog) != 2 {
+		t.Fatalf("backlog = %d messages, want the 2 still buffered", len(backlog))
+	}
+}
+
+func TestHubDropsSlowSubscribers(t *testing.T) {
+	hub := stream.NewHub(8, 1)
+	author := uuid.New()
+	ctx := context.Background()
+
+	sub, _, _ := hub.Subscribe(0)
+	hub.Publish(ctx, chirpEvent(t, events.ChirpCreated, author, "a"))
+	hub.Publish(ctx, chirpEvent(t, events.ChirpCreated, author, "b"))
+
+	<-sub.C
+	if _, ok := <-sub.C; ok {
+		t.Fatal("expected the subscription to be closed")
+	}
+	hub.Unsubscribe(sub) // must not panic after the hub dropped it
+}
+
+func TestFilterMatchesAuthorKeywordAndHidden(t *testing.T) {
+	alice, bob := uuid.New(), uuid.New()
+
+	f := stream.Filter{
+		Authors: map[uuid.UUID]bool{alice: true},
+		Keyword: "Go",
+	}
+	if !f.Match(chirpEvent(t, events.ChirpCreated, alice, "learning go today")) {
+		t.Error("expected keyword match ignoring case")
+	}
+	if f.Match(chirpEvent(t, events.ChirpCreated, alice, "nothing here")) {
+		t.Error("expected keyword mismatch")
+	}
+	if f.Match(chirpEvent(t, events.ChirpCreated, bob, "go go go")) {
+		t.Error("expected other authors to be filtered out")
+	}
+	deleted, _ := events.New(events.ChirpDeleted, alice, map[string]any{"id": uuid.New()})
+	if !f.Match(deleted) {
+		t.Error("deletions should pass the keyword filter")
+	}
+
+	hidden := stream.Filter{Hidden: map[uuid.UUID]bool{bob: true}}
+	if hidden.Match(chirpEvent(t, events.ChirpCreated, bob, "hi")) {
+		t.Error("expected hidden author to be filtered out")
+	}
+}
@@ -0,0 +1,99 @@
+package tests
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"local/mda/internal/subscriptions"
+)
+
+func TestSubscriptionLifecycle(t *testing.T) {
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	end := now.Add(30 * 24 * time.Hour)
+	later := end.Add(30 * 24 * time.Hour)
+
+	steps := []struct {
+		event     string
+		periodEnd *time.Time
+		status    string
+		end       *time.Time
+		entitled  bool
+	}{
+		{subscriptions.EventPaymentFailed, nil, "", nil, false},
+		{subscriptions.EventUpgraded, &end, subscriptions.StatusActive, &end, true},
+		{subscriptions.EventPaymentFailed, nil, subscriptions.StatusPastDue, &end, true},
+		{subscriptions.EventRenewed, &later, subscriptions.StatusActive, &later, true},
+		{subscriptions.EventCanceled, nil, subscriptions.StatusCanceled, &later, true},
+		{subscriptions.EventRefunded, nil, subscriptions.StatusExpired, &later, false},
+		{subscriptions.EventCanceled, nil, subscriptions.StatusExpired, &later, false},
+	}
+
+	var s subscriptions.State
+	for i, step := range steps {
+		next, err := subscriptions.Apply(s, step.event, step.periodEnd)
+		if err != nil {
+			t.Fatalf("step %d (%s): %v", i, step.event, err)
+		}
+		if next.Status != step.status {
+			t.Fatalf("step %d (%s): status %q, want %q", i, step.event, next.Status, step.status)
+		}
+		if (next.CurrentPeriodEnd == nil) != (step.end == nil) ||
+			next.CurrentPeriodEnd != nil && !next.CurrentPeriodEnd.Equal(*step.end) {
+			t.Fatalf("step %d (%s): period end %v, want %v", i, step.event, next.CurrentPeriodEnd, step.end)
+		}
+		if got := next.Entitled(now); got != step.entitled {
+			t.Fatalf("step %d (%s): entitled %v, want %v", i, step.event, got, step.entitled)
+		}
+		s = next
+	}
+
+	if _, err := subscriptions.Apply(s, "invoice.created", nil); !errors.Is(err, subscriptions.ErrUnknownEvent) {
+		t.Fatalf("unknown event: got %v", err)
+	}
+}
+
+func TestSubscriptionEntitledGrace(t *testing.T) {
+	end := time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)
+	inGrace := end.Add(subscriptions.Grace - time.Minute)
+	pastGrace := end.Add(subscriptions.Grace)
+
+	cases := []struct {
+		state subscriptions.State
+		at    time.Time
+		want  bool
+	}{
+		{subscriptions.State{Status: subscriptions.StatusActive, CurrentPeriodEnd: &end}, inGrace, true},
+		{subscriptions.State{Status: subscriptions.StatusActive, CurrentPeriodEnd: &end}, pastGrace, false},
+		{subscriptions.State{Status: subscriptions.StatusPastDue, CurrentPeriodEnd: &end}, inGrace, true},
+		// a cancellation runs to the end of the paid period, with no grace
+		{subscriptions.State{Status: subscriptions.StatusCanceled, CurrentPeriodEnd: &end}, end.Add(-time.Minute), true},
+		{subscriptions.State{Status: subscriptions.StatusCanceled, CurrentPeriodEnd: &end}, end, false},
+		// upgrades from before periods were tracked never lapse
+		{subscriptions.State{Status: subscriptions.StatusActive}, pastGrace, true},
+		{subscriptions.State{}, end, false},
+	}
+	for i, c := range cases {
+		if got := c.state.Entitled(c.at); got != c.want {
+			t.Errorf("case %d: Entitled = %v, want %v", i, got, c.want)
+		}
+	}
+}
+
+func TestSubscriptionStaleEvents(t *testing.T) {
+	applied := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	s := subscriptions.State{Status: subscriptions.StatusActive, LastEventAt: &applied}
+
+	if !s.Stale(applied.Add(-time.Second)) {
+		t.Error("an event created before the last one applied should be stale")
+	}
+	if s.Stale(applied) || s.Stale(applied.Add(time.Second)) {
+		t.Error("events created at or after the last one applied aren't stale")
+	}
+	if s.Stale(time.Time{}) {
+		t.Error("events without a time are never stale")
+	}
+	if (subscriptions.State{}).Stale(applied) {
+		t.Error("nothing is stale before an event has been applied")
+	}
+}
@@ -0,0 +1,124 @@
+package tests
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"local/mda/internal/safehttp"
+	"local/mda/internal/webhooks"
+)
+
+func TestSignAndVerify(t *testing.T) {
+	body := []byte(`{"type":"chirp.created"}`)
+	now := time.Unix(1_700_000_000, 0)
+	header := webhooks.Sign("whsec_a", now, body)
+
+	if err := webhooks.Verify("whsec_a", header, body, now.Add(time.Minute), 5*time.Minute); err != nil {
+		t.Fatalf("valid signature rejected: %v", err)
+	}
+	if err := webhooks.Verify("whsec_a", header, []byte(`{"type":"x"}`), now, 5*time.Minute); !errors.Is(err, webhooks.ErrSignatureMismatch) {
+		t.Fatalf("tampered body: got %v", err)
+	}
+	if err := webhooks.Verify("whsec_b", header, body, now, 5*time.Minute); !errors.Is(err, webhooks.ErrSignatureMismatch) {
+		t.Fatalf("wrong secret: got %v", err)
+	}
+	if err := webhooks.Verify("whsec_a", header, body, now.Add(10*time.Minute), 5*time.Minute); !errors.Is(err, webhooks.ErrSignatureExpired) {
+		t.Fatalf("stale timestamp: got %v", err)
+	}
+	if err := webhooks.Verify("whsec_a", "v1=zz", body, now, 5*time.Minute); !errors.Is(err, webhooks.ErrMalformedSignature) {
+		t.Fatalf("malformed header: got %v", err)
+	}
+
+	// during a secret rotation the header carries both signatures
+	rotated := header + ",v1=" + webhooks.Sign("whsec_b", now, body)[len("t=1700000000,v1="):]
+	if err := webhooks.Verify("whsec_b", rotated, body, now, 5*time.Minute); err != nil {
+		t.Fatalf("rotated secret rejected: %v", err)
+	}
+}
+
+func TestVerifyTimestamp(t *testing.T) {
+	body := []byte(`{"event":"user.upgraded"}`)
+	now := time.Unix(1_700_000_000, 0)
+	// Sign's v1 value is the same HMAC over "<timestamp>.<body>"
+	sig := webhooks.Sign("polka", now, body)[len("t=1700000000,v1="):]
+
+	if err := webhooks.VerifyTimestamp("polka", "1700000000", sig, body, now, 5*time.Minute); err != nil {
+		t.Fatalf("valid signature rejected: %v", err)
+	}
+	if err := webhooks.VerifyTimestamp("polka", "1700000001", sig, body, now, 5*time.Minute); !errors.Is(err, webhooks.ErrSignatureMismatch) {
+		t.Fatalf("changed timestamp: got %v", err)
+	}
+	if err := webhooks.VerifyTimestamp("polka", "1700000000", sig, body, now.Add(6*time.Minute), 5*time.Minute); !errors.Is(err, webhooks.ErrSignatureExpired) {
+		t.Fatalf("replayed outside window: got %v", err)
+	}
+	if err := webhooks.VerifyTimestamp("polka", "", sig, body, now, 5*time.Minute); !errors.Is(err, webhooks.ErrMalformedSignature) {
+		t.Fatalf("missing timestamp: got %v", err)
+	}
+	if err := webhooks.VerifyTimestamp("polka", "1700000000", "", body, now, 5*time.Minute); !errors.Is(err, webhooks.ErrMalformedSignature) {
+		t.Fatalf("missing signature: got %v", err)
+	}
+}
+
+func TestBackoffDoublesUpToCap(t *testing.T) {
+	if got := webhooks.Backoff(1); got != 30*time.Second {
+		t.Fatalf("Backoff(1) = %s", got)
+	}
+	if got := webhooks.Backoff(3); got != 2*time.Minute {
+		t.Fatalf("Backoff(3) = %s", got)
+	}
+	if got := webhooks.Backoff(40); got != 6*time.Hour {
+		t.Fatalf("Backoff(40) = %s", got)
+	}
+}
+
+func TestSenderSignsDeliveries(t *testing.T) {
+	now := time.Now()
+	var gotErr error
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		gotErr = webhooks.Verify("whsec_test", r.Header.Get(webhooks.SignatureHeader), body, now, time.Minute)
+		if r.Header.Get(webhooks.EventHeader) != "chirp.created" || r.Header.Get(webhooks.DeliveryHeader) != "d-1" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer srv.Close()
+
+	opts := safehttp.DefaultOptions()
+	opts.AllowPrivate = true
+	sender := &webhooks.Sender{Client: safehttp.NewClient(opts), Now: func() time.Time { return now }}
+	status, err := sender.Send(context.Background(), webhooks.Request{
+		DeliveryID: "d-1",
+		EventType:  "chirp.created",
+		URL:        srv.URL,
+		Secret:     "whsec_test",
+		Body:       []byte(`{"id":"1"}`),
+	})
+	if err != nil || status != http.StatusNoContent {
+		t.Fatalf("Send = %d, %v", status, err)
+	}
+	if gotErr != nil {
+		t.Fatalf("receiver couldn't verify the signature: %v", gotErr)
+	}
+}
+
+func TestSenderReportsFailedStatus(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+
+	opts := safehttp.DefaultOptions()
+	opts.AllowPrivate = true
+	sender := &webhooks.Sender{Client: safehttp.NewClient(opts)}
+	status, err := sender.Send(context.Background(), webhooks.Request{URL: srv.URL, Secret: "s", Body: []byte(`{}`)})
+	if err == nil || status != http.StatusServiceUnavailable {
+		t.Fatalf("Send = %d, %v; want 503 and an error", status, err)
+	}
+}
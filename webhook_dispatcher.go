@@ -0,0 +1,147 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"slices"
+	"sync"
+	"time"
+
+	"local/mda/internal/database"
+	"local/mda/internal/entitlements"
+	"local/mda/internal/events"
+	"local/mda/internal/webhooks"
+
+	"github.com/google/uuid"
+)
+
+const (
+	deliveryPending   = "pending"
+	deliverySucceeded = "succeeded"
+	deliveryFailed    = "failed"
+
+	webhookMaxAttempts = 8
+	webhookBatchSize   = 20
+	// a claimed delivery is retried after the lease if its instance dies
+	// before recording the attempt
+	webhookLease = 2 * time.Minute
+)
+
+// webhookBody is what endpoints receive.
+type webhookBody struct {
+	Id         uuid.UUID       `json:"id"`
+	Type       string          `json:"type"`
+	OccurredAt time.Time       `json:"occurred_at"`
+	Data       json.RawMessage `json:"data"`
+}
+
+// enqueueWebhooks is an events.Handler that writes a delivery to the outbox
+// for each active endpoint of the event's user that wants it, as long as
+// their plan still includes outbound webhooks. Only the instance where the
+// event happened enqueues it. Errors leave the event for the dispatcher to
+// retry; deliveries are keyed by event, so a retry doesn't duplicate them.
+func (cfg *apiConfig) enqueueWebhooks(ctx context.Context, e events.Event) error {
+	if e.Origin != "" || !slices.Contains(webhookEventTypes, e.Type) {
+		return nil
+	}
+	ctx = context.WithoutCancel(ctx)
+	plan, err := cfg.userPlan(ctx, cfg.db, e.UserID)
+	if err != nil {
+		return fmt.Errorf("loading plan for %s webhooks: %w", e.Type, err)
+	}
+	if !plan.Can(entitlements.OutboundWebhooks) {
+		return nil
+	}
+	body, err := json.Marshal(webhookBody{Id: e.ID, Type: e.Type, OccurredAt: e.OccurredAt, Data: e.Payload})
+	if err != nil {
+		return fmt.Errorf("encoding %s webhook: %w", e.Type, err)
+	}
+	_, err = cfg.db.EnqueueWebhookDeliveries(ctx, database.EnqueueWebhookDeliveriesParams{
+		EventID:   e.ID,
+		EventType: e.Type,
+		Payload:   body,
+		UserID:    e.UserID,
+	})
+	if err != nil {
+		return fmt.Errorf("enqueueing %s webhooks: %w", e.Type, err)
+	}
+	return nil
+}
+
+// runWebhookDispatcher sends due deliveries. Claiming uses FOR UPDATE SKIP
+// LOCKED, so several instances can dispatch side by side.
+func (cfg *apiConfig) runWebhookDispatcher(ctx context.Context, every time.Duration) {
+	ticker := time.NewTicker(every)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := cfg.dispatchWebhooks(ctx); err != nil {
+				log.Printf("dispatching webhooks: %s", err)
+			}
+		}
+	}
+}
+
+func (cfg *apiConfig) dispatchWebhooks(ctx context.Context) error {
+	now := time.Now().UTC()
+	due, err := cfg.db.ClaimDueWebhookDeliveries(ctx, database.ClaimDueWebhookDeliveriesParams{
+		LeaseUntil: now.Add(webhookLease),
+		Now:        now,
+		BatchSize:  webhookBatchSize,
+	})
+	if err != nil {
+		return err
+	}
+
+	var wg sync.WaitGroup
+	for _, d := range due {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			cfg.deliverWebhook(ctx, d)
+		}()
+	}
+	wg.Wait()
+	return nil
+}
+
+// deliverWebhook makes one attempt and records it: success ends the
+// delivery, failure schedules the next attempt with exponential backoff
+// until webhookMaxAttempts is reached.
+func (cfg *apiConfig) deliverWebhook(ctx context.Context, d database.ClaimDueWebhookDeliveriesRow) {
+	status, err := cfg.webhookSender.Send(ctx, webhooks.Request{
+		DeliveryID: d.ID.String(),
+		EventType:  d.EventType,
+		URL:        d.Url,
+		Secret:     d.Secret,
+		Body:       d.Payload,
+	})
+
+	now := time.Now().UTC()
+	attempts := int(d.Attempts) + 1
+	params := database.RecordWebhookAttemptParams{
+		ID:             d.ID,
+		Status:         deliverySucceeded,
+		AttemptedAt:    sql.NullTime{Time: now, Valid: true},
+		ResponseStatus: sql.NullInt32{Int32: int32(status), Valid: status != 0},
+		NextAttemptAt:  now,
+	}
+	if err != nil {
+		params.LastError = sql.NullString{String: err.Error(), Valid: true}
+		if attempts >= webhookMaxAttempts {
+			params.Status = deliveryFailed
+		} else {
+			params.Status = deliveryPending
+			params.NextAttemptAt = now.Add(webhooks.Backoff(attempts))
+		}
+	}
+	if err := cfg.db.RecordWebhookAttempt(ctx, params); err != nil {
+		log.Printf("recording webhook delivery %s: %s", d.ID, err)
+	}
+}